@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+	Long: `When VIBE_AUDIT_LOG names a file, every command vibe suggests is appended
+to it as a line of JSON: when, who, where, the query, the command, the
+provider and model, the safety level and what became of it (inserted,
+accepted, edited, regenerated, cancelled, blocked or tried; suggested for
+commands returned by vibe serve and vibe batch). The log rotates by size
+and, with VIBE_AUDIT_HASH_CHAIN=true, each entry's hash covers the one
+before it.`,
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Check the audit log's hash chain",
+	Long: `Read the audit log (VIBE_AUDIT_LOG, or the file given) and its rotated
+files, and check that each chained entry matches its hash and follows the
+entry before it. Exits 1 if an entry was edited, removed or reordered.
+
+Removing entries from the end of the log can't be detected from the log
+alone; compare the last hash printed here with one recorded earlier.
+
+Example:
+  vibe audit verify /var/log/vibe/audit.jsonl`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := cfg.AuditLog
+		if len(args) > 0 {
+			path = args[0]
+		}
+		verifyAudit(path)
+	},
+}
+
+func init() {
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+func verifyAudit(path string) {
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "Error: no audit log; set VIBE_AUDIT_LOG or give a file")
+		os.Exit(1)
+	}
+
+	r, err := audit.Verify(path)
+	if r != nil {
+		fmt.Printf("Files:   %s\n", strings.Join(r.Files, ", "))
+		fmt.Printf("Entries: %d (%d chained)\n", r.Entries, r.Chained)
+	}
+	if err != nil {
+		if errors.Is(err, audit.ErrTampered) {
+			fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+	if r.LastHash != "" {
+		fmt.Printf("Last:    %s\n", r.LastHash)
+	}
+	fmt.Println("OK")
+}
+
+// recordAudit appends a command to the audit log, if one is configured.
+// The log is meant as a complete record, so a command that can't be logged
+// isn't handed out: vibe exits instead.
+func recordAudit(query, command, safetyLevel, outcome string) {
+	err := client.Audit(cfg, audit.Entry{
+		Query:       query,
+		Command:     command,
+		Provider:    cfg.Provider,
+		Model:       cfg.ResolvedModel(),
+		SafetyLevel: safetyLevel,
+		Outcome:     outcome,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/skymoore/vibe-zsh/internal/batch"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchConcurrency int
+	batchOutput      string
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [file]",
+	Short: "Generate commands for many queries and write JSONL results",
+	Long: `Generate a command for every query in a file, or stdin when no file (or -)
+is given, and write one JSON result per query to stdout, in input order.
+
+Each line is either a plain query or a JSON record that can override settings
+for that query:
+
+  list all docker containers
+  {"id": "disk", "query": "show disk usage", "model": "qwen2.5:7b", "temperature": 0}
+
+Record fields: query (required), id, provider, api_url, model, temperature,
+max_tokens. Blank lines and lines starting with # are skipped.
+
+Each result holds the full response, the parsing layer that produced it
+("cache", "structured_output", "enhanced_parsing", "explicit_json_prompt",
+"syntax_repair" or "emergency_fallback"), the number of requests, the latency and, for failures,
+the error and exit code. Responses are cached as in the shell; pass
+--cache=false to always ask the model. Commands the policy file
+(VIBE_POLICY_FILE) blocks are reported as failures with exit code 19, without
+the response. vibe exits with status 1 when any query failed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "-"
+		if len(args) == 1 {
+			path = args[0]
+		}
+		runBatch(path)
+	},
+}
+
+func init() {
+	batchCmd.Flags().IntVarP(&batchConcurrency, "concurrency", "j", batch.DefaultConcurrency, "Queries to run at once")
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "Write results to this file instead of stdout")
+	rootCmd.AddCommand(batchCmd)
+}
+
+func runBatch(path string) {
+	// initConfig leaves these flags to the query command.
+	if rootCmd.PersistentFlags().Changed("cache") {
+		cfg.EnableCache = enableCache
+	}
+	if rootCmd.PersistentFlags().Changed("debug") {
+		cfg.EnableDebugLogs = debugLogs
+	}
+	logger.Init(cfg.EnableDebugLogs)
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var out io.Writer = os.Stdout
+	if batchOutput != "" {
+		f, err := os.Create(batchOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := batch.Run(ctx, cfg, in, out, batch.Options{Concurrency: batchConcurrency, Policy: mustLoadPolicy()})
+	fmt.Fprintf(os.Stderr, "%d queries, %d failed\n", summary.Total, summary.Failed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if summary.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/daemon"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/progress"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Serve queries from a background process to cut per-query startup",
+	Long: `Run a background process that keeps the API client, its connections, the
+response cache and the history in memory. While it runs, vibe hands queries to
+it over a Unix socket in the state directory (VIBE_STATE_DIR, default
+~/.local/state/vibe) instead of starting from scratch; when it isn't running,
+vibe generates in-process as usual. Set VIBE_USE_DAEMON=false to never use it.
+
+The daemon reloads its configuration when the config file (VIBE_CONFIG_FILE)
+changes and stops after VIBE_DAEMON_IDLE_TIMEOUT without queries. Environment
+variables are read once at start: a shell whose settings differ from the
+daemon's generates in-process until the daemon is restarted.
+
+Start it in the background, or let the plugin do it with VIBE_START_DAEMON=true:
+  vibe-zsh daemon &`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runDaemon()
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report whether a daemon is running",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		d, err := daemon.NewClient(cfg)
+		if err != nil {
+			fmt.Println("vibe daemon is not running")
+			os.Exit(1)
+		}
+		pid, err := d.Ping()
+		if err != nil {
+			fmt.Println("vibe daemon is not running")
+			os.Exit(1)
+		}
+		fmt.Printf("vibe daemon is running (pid %d)\n", pid)
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running daemon",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		d, err := daemon.NewClient(cfg)
+		if err == nil {
+			err = d.Shutdown()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "vibe daemon is not running")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemon() {
+	if rootCmd.PersistentFlags().Changed("debug") {
+		cfg.EnableDebugLogs = debugLogs
+	}
+	logger.Init(cfg.EnableDebugLogs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logf := log.New(os.Stderr, "vibe daemon: ", log.LstdFlags).Printf
+	s := daemon.NewServer(cfg, daemon.Options{
+		Load:        loadConfig,
+		IdleTimeout: cfg.DaemonIdleTimeout,
+		Logf:        logf,
+	})
+
+	logf("Serving %s with %s (pid %d)", cfg.Provider, cfg.Model, os.Getpid())
+	err := s.Serve(ctx)
+	if errors.Is(err, daemon.ErrRunning) {
+		// Shells may each try to start one; the first wins.
+		logf("%v", err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	logf("Stopped")
+}
+
+// daemonClient returns a client for the running daemon, or nil when there is
+// none or VIBE_USE_DAEMON is off.
+func daemonClient() *daemon.Client {
+	if !cfg.UseDaemon {
+		return nil
+	}
+	d, err := daemon.NewClient(cfg)
+	if err != nil {
+		logger.Debug("Not using the daemon: %v", err)
+		return nil
+	}
+	return d
+}
+
+// generate produces a command for query through d, falling back to an
+// in-process client when d is nil or can't serve the query. The returned
+// client is d if it produced the response, nil otherwise.
+func generate(ctx context.Context, d *daemon.Client, query string) (*schema.CommandResponse, *daemon.Client, error) {
+	if d != nil {
+		resp, err := generateWithDaemon(ctx, d, query)
+		if !errors.Is(err, daemon.ErrUnavailable) {
+			return resp, d, err
+		}
+		logger.Debug("Daemon unavailable, generating in-process: %v", err)
+	}
+
+	resp, err := client.New(cfg).GenerateCommand(ctx, query)
+	return resp, nil, err
+}
+
+// generateWithDaemon asks the daemon for a command, showing its progress on
+// a local spinner.
+func generateWithDaemon(ctx context.Context, d *daemon.Client, query string) (*schema.CommandResponse, error) {
+	if !cfg.ShowProgress || !progress.IsStderrTerminal() {
+		return d.Generate(ctx, cfg, query, nil)
+	}
+
+	spinner := progress.NewSpinner(cfg.ProgressStyle)
+	defer spinner.Stop()
+	started := false
+	return d.Generate(ctx, cfg, query, func(message string) {
+		if !started {
+			spinner.Start(ctx, message)
+			started = true
+			return
+		}
+		spinner.Update(message)
+	})
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	bprogress "github.com/charmbracelet/bubbles/progress"
+	"github.com/skymoore/vibe-zsh/internal/models"
+	"github.com/skymoore/vibe-zsh/internal/progress"
+	"github.com/spf13/cobra"
+)
+
+// completionTimeout bounds the live model listing done during shell
+// completion so a slow or unreachable server never hangs the prompt.
+const completionTimeout = 2 * time.Second
+
+var modelsCmd = &cobra.Command{
+	Use:   "models",
+	Short: "List the models available from the configured provider",
+	Long: `List the models the configured provider offers. The current model
+(VIBE_MODEL) is marked with '*'.
+
+Ollama is queried through /api/tags; OpenAI, LM Studio, vLLM and other
+OpenAI-compatible servers through /v1/models. The listing is cached and used
+for --model completion and to warn when VIBE_MODEL is not available.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listModels()
+	},
+}
+
+var modelsPullCmd = &cobra.Command{
+	Use:   "pull <name>",
+	Short: "Download a model into Ollama",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pullModel(args[0])
+	},
+}
+
+func init() {
+	modelsCmd.AddCommand(modelsPullCmd)
+	rootCmd.AddCommand(modelsCmd)
+}
+
+func listModels() {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+
+	list, err := models.List(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing models: %v\n", err)
+		os.Exit(1)
+	}
+	// Caching is best-effort; the listing itself succeeded.
+	_ = models.SaveCached(cfg, list)
+
+	if len(list) == 0 {
+		fmt.Fprintf(os.Stderr, "No models found on %s.\n", cfg.Provider)
+		return
+	}
+
+	for _, m := range list {
+		marker := " "
+		if models.Contains([]models.Model{m}, cfg.Model) {
+			marker = "*"
+		}
+		if m.Size > 0 {
+			fmt.Printf("%s %-40s %s\n", marker, m.Name, formatSize(m.Size))
+		} else {
+			fmt.Printf("%s %s\n", marker, m.Name)
+		}
+	}
+}
+
+func pullModel(name string) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	showBar := progress.IsStderrTerminal()
+	bar := bprogress.New(bprogress.WithDefaultGradient(), bprogress.WithWidth(40))
+	lastStatus := ""
+
+	err := models.Pull(ctx, cfg, name, func(p models.PullProgress) {
+		if !showBar {
+			// Without a terminal, print each distinct step once.
+			if p.Status != lastStatus {
+				fmt.Fprintln(os.Stderr, p.Status)
+				lastStatus = p.Status
+			}
+			return
+		}
+		if p.Total > 0 {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s %s", bar.ViewAs(float64(p.Completed)/float64(p.Total)), p.Status)
+			return
+		}
+		if p.Status != lastStatus {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s", p.Status)
+			lastStatus = p.Status
+		}
+	})
+	if showBar {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error pulling %s: %v\n", name, err)
+		os.Exit(1)
+	}
+
+	// Refresh the cached listing so the new model is known immediately.
+	listCtx, listCancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer listCancel()
+	if list, err := models.List(listCtx, cfg); err == nil {
+		_ = models.SaveCached(cfg, list)
+	}
+
+	fmt.Fprintf(os.Stderr, "Pulled %s\n", name)
+}
+
+// completeModels completes --model from the cached listing, falling back to a
+// quick live listing when nothing is cached.
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// cfg was built before the completion request's own flags were parsed;
+	// rebuild it so a --provider or --api-url on the line is honored.
+	initConfig()
+
+	list, ok := models.Cached(cfg)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+		defer cancel()
+
+		var err error
+		list, err = models.List(ctx, cfg)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		_ = models.SaveCached(cfg, list)
+	}
+	return models.Names(list), cobra.ShellCompDirectiveNoFileComp
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1000
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Inspect the command policy",
+	Long: `Rules in the policy file (VIBE_POLICY_FILE, default ~/.config/vibe/policy.json)
+allow, warn about, require confirmation for, or block generated commands.
+The first matching rule decides.`,
+}
+
+var policyTestCmd = &cobra.Command{
+	Use:   "test <command>",
+	Short: "Show which policy rule a command matches",
+	Long: `Evaluate a command against the policy file and print the rule that matches
+and its action, along with the local safety assessment. Nothing is generated
+or run.
+
+Example:
+  vibe policy test "kubectl --context prod-eu delete ns payments"`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		testPolicy(strings.Join(args, " "))
+	},
+}
+
+func init() {
+	policyCmd.AddCommand(policyTestCmd)
+	rootCmd.AddCommand(policyCmd)
+}
+
+func testPolicy(command string) {
+	pol, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if pol.Path == "" {
+		fmt.Printf("Policy:  none (no file at %s)\n", policy.DefaultPath())
+	} else {
+		fmt.Printf("Policy:  %s (%d rules)\n", pol.Path, len(pol.Rules))
+	}
+
+	d := pol.Evaluate(command)
+	if d.Rule == nil {
+		fmt.Println("Rule:    none matches")
+	} else {
+		fmt.Printf("Rule:    %s\n", d.Rule.Name)
+	}
+	fmt.Printf("Action:  %s\n", d.Action)
+	if d.Rule != nil {
+		fmt.Printf("Message: %s\n", d.Message)
+	}
+
+	a := safety.Analyze(command)
+	fmt.Printf("Safety:  %s\n", a.Level)
+	for _, reason := range a.Reasons {
+		fmt.Printf("  - %s\n", reason)
+	}
+}
+
+// mustLoadPolicy loads the policy file. A policy file that can't be read
+// stops vibe rather than letting commands through unchecked.
+func mustLoadPolicy() *policy.Policy {
+	pol, err := policy.Load(cfg.PolicyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: policy: %v\n", err)
+		os.Exit(1)
+	}
+	return pol
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -9,13 +10,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/skymoore/vibe-zsh/internal/audit"
 	"github.com/skymoore/vibe-zsh/internal/client"
 	"github.com/skymoore/vibe-zsh/internal/config"
 	"github.com/skymoore/vibe-zsh/internal/confirm"
+	"github.com/skymoore/vibe-zsh/internal/daemon"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
 	"github.com/skymoore/vibe-zsh/internal/history"
 	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/models"
+	"github.com/skymoore/vibe-zsh/internal/placeholder"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/preview"
 	"github.com/skymoore/vibe-zsh/internal/progress"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/skymoore/vibe-zsh/internal/schema"
 	"github.com/skymoore/vibe-zsh/internal/streamer"
+	"github.com/skymoore/vibe-zsh/internal/transport"
 	"github.com/skymoore/vibe-zsh/internal/updater"
 	"github.com/spf13/cobra"
 )
@@ -31,6 +42,7 @@ var (
 	temperature          float64
 	maxTokens            int
 	timeout              time.Duration
+	deadline             time.Duration
 	useStructuredOutput  bool
 	showExplanation      bool
 	showWarnings         bool
@@ -102,13 +114,15 @@ var checkUpdateCmd = &cobra.Command{
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVar(&provider, "provider", "", "LLM provider: ollama, openai, anthropic, groq, openrouter, vllm, openai-compatible (default: inferred from --api-url)")
+	rootCmd.PersistentFlags().StringVar(&provider, "provider", "", "LLM provider: ollama, openai, anthropic, groq, openrouter, vllm, llamacpp, openai-compatible, azure-openai (default: inferred from --api-url)")
 	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", "", "API endpoint URL (default: http://localhost:11434/v1)")
 	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "API authentication key")
 	rootCmd.PersistentFlags().StringVar(&model, "model", "", "Model to use (default: llama3:8b)")
+	_ = rootCmd.RegisterFlagCompletionFunc("model", completeModels)
 	rootCmd.PersistentFlags().Float64Var(&temperature, "temperature", -1, "Generation temperature 0.0-2.0 (default: 0.2)")
 	rootCmd.PersistentFlags().IntVar(&maxTokens, "max-tokens", -1, "Maximum response tokens (default: 500)")
 	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Request timeout (default: 30s)")
+	rootCmd.PersistentFlags().DurationVar(&deadline, "deadline", 0, "Overall time limit across all retries (default: 60s)")
 
 	rootCmd.PersistentFlags().BoolVar(&useStructuredOutput, "structured-output", true, "Use JSON schema for responses")
 	rootCmd.PersistentFlags().BoolVar(&showExplanation, "explanation", true, "Show command explanations")
@@ -134,36 +148,17 @@ func init() {
 }
 
 func initConfig() {
-	cfg = config.Load()
-
-	if provider != "" {
-		cfg.Provider = provider
-	}
-	if apiURL != "" {
-		cfg.APIURL = apiURL
-	}
-	if apiKey != "" {
-		cfg.APIKey = apiKey
-	}
-	if model != "" {
-		cfg.Model = model
-	}
-	if temperature >= 0 {
-		cfg.Temperature = temperature
-	}
-	if maxTokens > 0 {
-		cfg.MaxTokens = maxTokens
-	}
-	if timeout > 0 {
-		cfg.Timeout = timeout
-	}
-	if cacheTTL > 0 {
-		cfg.CacheTTL = cacheTTL
-	}
-	if maxRetries >= 0 {
-		cfg.MaxRetries = maxRetries
+	var err error
+	cfg, err = loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
+	// Every command may make HTTP requests (generation, models, updates), so
+	// the network settings apply before the subcommand check below.
+	configureTransport()
+
 	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil && cmd.Use != "vibe-zsh [query]" {
 		return
 	}
@@ -211,6 +206,70 @@ func initConfig() {
 	logger.Init(cfg.EnableDebugLogs)
 }
 
+// loadConfig reads the environment and config file and applies the
+// connection and generation flags every command honors. The daemon calls it
+// again when the config file changes.
+func loadConfig() (*config.Config, error) {
+	c := config.Load()
+	if c.FileError != nil {
+		return nil, fmt.Errorf("invalid config file: %w", c.FileError)
+	}
+
+	if provider != "" {
+		c.Provider = provider
+	}
+	if apiURL != "" {
+		c.APIURL = apiURL
+	}
+	if apiKey != "" {
+		c.APIKey = apiKey
+	}
+	if model != "" {
+		c.Model = model
+	}
+	if temperature >= 0 {
+		c.Temperature = temperature
+	}
+	if maxTokens > 0 {
+		c.MaxTokens = maxTokens
+	}
+	if timeout > 0 {
+		c.Timeout = timeout
+	}
+	if deadline > 0 {
+		c.Deadline = deadline
+	}
+	if cacheTTL > 0 {
+		c.CacheTTL = cacheTTL
+	}
+	if maxRetries >= 0 {
+		c.MaxRetries = maxRetries
+	}
+
+	return c, nil
+}
+
+// configureTransport applies the proxy, CA and client certificate settings to
+// every HTTP request vibe makes.
+func configureTransport() {
+	err := transport.Configure(transport.Options{
+		CAFile:     cfg.CAFile,
+		ClientCert: cfg.ClientCert,
+		ClientKey:  cfg.ClientKey,
+		Proxy:      cfg.HTTPSProxy,
+		Insecure:   cfg.InsecureSkipVerify,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid network configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.InsecureSkipVerify {
+		fmt.Fprintln(os.Stderr, "# ⚠️  WARNING: TLS certificate verification is DISABLED (VIBE_INSECURE_SKIP_VERIFY=true).")
+		fmt.Fprintln(os.Stderr, "# ⚠️  Anyone on the network path can read your queries and API key. Use VIBE_CA_FILE instead.")
+	}
+}
+
 func parseProgressStyle(style string) progress.SpinnerStyle {
 	switch strings.ToLower(style) {
 	case "dots":
@@ -313,18 +372,43 @@ func generateCommand(query string) {
 		os.Exit(130) // Standard exit code for SIGINT
 	}()
 
-	c := client.New(cfg)
+	pol := mustLoadPolicy()
 
-	resp, err := c.GenerateCommand(ctx, query)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	// Warn early about a model the provider doesn't have; the request is
+	// still attempted since the cached listing may be out of date.
+	if cfg.ShowWarnings {
+		if warning := models.MissingModelWarning(cfg); warning != "" {
+			fmt.Fprintf(os.Stderr, "# ⚠️  %s\n", warning)
+		}
+	}
+
+	// Hand the query to a running daemon, which has the client and cache
+	// warm; without one, generate in-process.
+	resp, d := mustGenerate(ctx, daemonClient(), query)
+
+	// Values the model left as placeholders are asked for first, so the
+	// policy and the dialog see the real command.
+	fillPlaceholders(query, resp)
+
+	// Apply the policy before anything is shown, so a blocked command never
+	// reaches the buffer or the history.
+	decision := applyPolicy(pol, query, resp)
+
+	// If interactive mode is enabled, or a policy rule requires it, show
+	// confirmation prompt
+	outcome := audit.Inserted
+	if cfg.InteractiveMode || decision.Action == policy.RequireConfirm {
+		resp, outcome = confirmCommand(ctx, pol, query, resp)
 	}
 
+	// The query and command as they may be logged or stored: secrets the
+	// client hid from the provider stay hidden here too.
+	storedQuery, storedCommand := client.Redactor(cfg).Scrub(query, resp.Command)
+
 	// Debug: Print full JSON response as comments
 	if cfg.EnableDebugLogs {
 		logger.Debug("=== Full Response ===")
-		logger.Debug("Command: %s", resp.Command)
+		logger.Debug("Command: %s", storedCommand)
 		logger.Debug("Explanation count: %d", len(resp.Explanation))
 		for i, exp := range resp.Explanation {
 			logger.Debug("Explanation[%d]: %q", i, exp)
@@ -365,19 +449,25 @@ func generateCommand(query string) {
 			fmt.Fprintln(os.Stderr, "# ⚠️  Model generated incomplete explanations")
 			fmt.Fprintln(os.Stderr, "# Try a different model or increase VIBE_MAX_TOKENS")
 		}
+	}
 
-		if cfg.ShowWarnings && resp.Warning != "" {
-			cleanWarning := cleanExplanation(resp.Warning)
-			if cleanWarning != "" {
-				if cfg.StreamOutput && cfg.ShowProgress {
-					fmt.Fprint(os.Stderr, "# WARNING: ")
-					if err := streamer.StreamWord(os.Stderr, cleanWarning, cfg.StreamDelay); err != nil {
-						fmt.Fprint(os.Stderr, cleanWarning)
-					}
-					fmt.Fprintln(os.Stderr)
-				} else {
-					fmt.Fprintf(os.Stderr, "# WARNING: %s\n", cleanWarning)
+	// The warning is shown even without explanations: the local safety
+	// analysis can add one the model never gave.
+	if cfg.ShowWarnings && resp.Warning != "" {
+		cleanWarning := cleanExplanation(resp.Warning)
+		if cleanWarning != "" {
+			label := "# WARNING: "
+			if resp.SafetyLevel != "" && resp.SafetyLevel != safety.Safe {
+				label = fmt.Sprintf("# WARNING (%s): ", resp.SafetyLevel)
+			}
+			if cfg.StreamOutput && cfg.ShowProgress {
+				fmt.Fprint(os.Stderr, label)
+				if err := streamer.StreamWord(os.Stderr, cleanWarning, cfg.StreamDelay); err != nil {
+					fmt.Fprint(os.Stderr, cleanWarning)
 				}
+				fmt.Fprintln(os.Stderr)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s%s\n", label, cleanWarning)
 			}
 		}
 	}
@@ -385,34 +475,161 @@ func generateCommand(query string) {
 	// Ensure all stderr output is flushed before writing to stdout
 	os.Stderr.Sync()
 
-	// If interactive mode is enabled, show confirmation prompt
-	if cfg.InteractiveMode {
-		confirmed, err := confirm.ShowConfirmation(resp.Command)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error showing confirmation: %v\n", err)
-			os.Exit(1)
-		}
-		if !confirmed {
-			// User cancelled, exit without outputting command
-			os.Exit(0)
-		}
-	}
+	// Logged before the command is output, so none goes unrecorded.
+	recordAudit(storedQuery, storedCommand, resp.SafetyLevel, outcome)
 
 	// Output only the command to stdout (this is what ZSH captures for the buffer)
 	fmt.Print(resp.Command)
 
 	// Save to history if enabled
 	if cfg.EnableHistory {
-		h, err := history.New(cfg.CacheDir, cfg.HistorySize)
-		if err == nil {
-			// Ignore errors when saving to history - don't fail the command
-			_ = h.Add(query, resp.Command)
+		// Ignore errors when saving to history - don't fail the command
+		if d == nil || d.AddHistory(storedQuery, storedCommand) != nil {
+			if h, err := history.New(cfg.CacheDir, cfg.HistorySize); err == nil {
+				_ = h.Add(storedQuery, storedCommand)
+			}
 		}
 	}
 
 	updater.ShowUpdateNotification(appVersion)
 }
 
+// mustGenerate is generate, exiting with the error's code when it fails.
+func mustGenerate(ctx context.Context, d *daemon.Client, query string) (*schema.CommandResponse, *daemon.Client) {
+	resp, d, err := generate(ctx, d, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if hint := apierrors.Hint(err); hint != "" {
+			fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+		}
+		// The exit code names the kind of failure for the zsh widget.
+		os.Exit(apierrors.ExitCode(err))
+	}
+	return resp, d
+}
+
+// fillPlaceholders asks for the values of the placeholders in resp's command
+// and puts them in, checking the command's safety afresh. Without a terminal
+// the placeholders stay, and are pointed out; cancelling the form exits.
+func fillPlaceholders(query string, resp *schema.CommandResponse) {
+	ps := placeholder.Detect(resp.Command, resp.Placeholders)
+	if !cfg.FillPlaceholders || len(ps) == 0 {
+		return
+	}
+	dir, _ := os.Getwd()
+	command, err := placeholder.Ask(resp.Command, ps, dir)
+	switch {
+	case errors.Is(err, placeholder.ErrCancelled):
+		storedQuery, storedCommand := client.Redactor(cfg).Scrub(query, resp.Command)
+		recordAudit(storedQuery, storedCommand, resp.SafetyLevel, audit.Cancelled)
+		os.Exit(0)
+	case errors.Is(err, placeholder.ErrNoTerminal):
+		if cfg.ShowWarnings {
+			fmt.Fprintf(os.Stderr, "# Fill in: %s\n", strings.Join(placeholder.Tokens(ps), ", "))
+		}
+		return
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error showing placeholder form: %v\n", err)
+		os.Exit(1)
+	}
+
+	if command != resp.Command {
+		resp.Command = command
+		resp.Placeholders = placeholder.Tokens(placeholder.Detect(command, resp.Placeholders))
+		safety.Apply(resp)
+	}
+}
+
+// applyPolicy evaluates resp's command against pol. A blocked command is
+// recorded in the audit log and vibe exits; a warning or required
+// confirmation is added to resp's warning and raises its safety level.
+func applyPolicy(pol *policy.Policy, query string, resp *schema.CommandResponse) policy.Decision {
+	decision, err := pol.Apply(resp)
+	if err != nil {
+		storedQuery, storedCommand := client.Redactor(cfg).Scrub(query, resp.Command)
+		recordAudit(storedQuery, storedCommand, resp.SafetyLevel, audit.Blocked)
+		fmt.Fprintf(os.Stderr, "# BLOCKED by policy rule %q: %s\n", decision.Rule.Name, decision.Message)
+		fmt.Fprintf(os.Stderr, "# %s\n", resp.Command)
+		os.Exit(apierrors.ExitPolicyBlocked)
+	}
+	return decision
+}
+
+// showConfirm shows the confirmation dialog; tests replace it.
+var showConfirm = confirm.Confirm
+
+// confirmCommand shows the confirmation dialog until the user accepts a
+// command, regenerating it or checking their edit against the policy as
+// they ask. An edit a policy rule matches is shown again. It returns the
+// accepted command and its audit outcome; a cancelled command exits.
+func confirmCommand(ctx context.Context, pol *policy.Policy, query string, resp *schema.CommandResponse) (*schema.CommandResponse, string) {
+	outcome := audit.Accepted
+	for {
+		req := confirm.Request{
+			Command:       resp.Command,
+			Warning:       cleanExplanation(resp.Warning),
+			SafetyLevel:   resp.SafetyLevel,
+			CanRegenerate: true,
+		}
+		for _, line := range resp.Explanation {
+			if line = cleanExplanation(line); line != "" {
+				req.Explanation = append(req.Explanation, line)
+			}
+		}
+		if cfg.PreviewFiles {
+			// Show which files a delete, move or chmod would touch.
+			if dir, err := os.Getwd(); err == nil {
+				req.Preview, req.PreviewError = preview.Run(ctx, resp.Command, dir)
+				if errors.Is(req.PreviewError, preview.ErrNotApplicable) {
+					req.PreviewError = nil
+				}
+			}
+		}
+		res, err := showConfirm(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error showing confirmation: %v\n", err)
+			os.Exit(1)
+		}
+		storedQuery, storedCommand := client.Redactor(cfg).Scrub(query, resp.Command)
+
+		switch {
+		case res.Regenerate:
+			recordAudit(storedQuery, storedCommand, resp.SafetyLevel, audit.Regenerated)
+			// In-process and without the cache, which would only hand back
+			// the same command.
+			cfg.EnableCache = false
+			resp, _ = mustGenerate(ctx, nil, query)
+			fillPlaceholders(query, resp)
+			applyPolicy(pol, query, resp)
+			outcome = audit.Accepted
+
+		case !res.Confirmed:
+			// User cancelled, exit without outputting command
+			recordAudit(storedQuery, storedCommand, resp.SafetyLevel, audit.Cancelled)
+			os.Exit(0)
+
+		case res.Edited:
+			// The explanation was for the generated command; the edit gets
+			// the local safety analysis and the policy.
+			a := safety.Analyze(res.Command)
+			edited := &schema.CommandResponse{
+				Command:     res.Command,
+				Warning:     strings.Join(a.Reasons, "; "),
+				SafetyLevel: a.Level,
+			}
+			if applyPolicy(pol, query, edited).Action == policy.Allow {
+				return edited, audit.Edited
+			}
+			// The rule's message is now in the warning; the user sees it
+			// before the edit is accepted.
+			resp, outcome = edited, audit.Edited
+
+		default:
+			return resp, outcome
+		}
+	}
+}
+
 func Execute(version string) {
 	appVersion = version
 	if err := rootCmd.Execute(); err != nil {
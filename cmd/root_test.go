@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/skymoore/vibe-zsh/internal/confirm"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// TestConfirmEditRequiringConfirmation checks that an edit a require-confirm
+// rule matches goes back to the dialog instead of being inserted.
+func TestConfirmEditRequiringConfirmation(t *testing.T) {
+	oldCfg, oldConfirm := cfg, showConfirm
+	t.Cleanup(func() { cfg, showConfirm = oldCfg, oldConfirm })
+	cfg = &config.Config{}
+
+	pol, err := policy.Parse([]byte(`{"rules": [{"name": "ask-rm", "command": "rm", "action": "require-confirm", "message": "deletes files"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		edit  string
+		shown int // How many times the dialog is shown
+	}{
+		{"ls -l", 1},
+		{"rm notes.txt", 2},
+	}
+	for _, tt := range tests {
+		var requests []confirm.Request
+		showConfirm = func(req confirm.Request) (confirm.Result, error) {
+			requests = append(requests, req)
+			if len(requests) == 1 {
+				return confirm.Result{Confirmed: true, Edited: true, Command: tt.edit}, nil
+			}
+			return confirm.Result{Confirmed: true, Command: req.Command}, nil
+		}
+
+		resp, outcome := confirmCommand(context.Background(), pol, "list files", &schema.CommandResponse{Command: "ls", SafetyLevel: "safe"})
+		if resp.Command != tt.edit || outcome != audit.Edited {
+			t.Errorf("edit %q: got %q, %s; want the edit, %s", tt.edit, resp.Command, outcome, audit.Edited)
+		}
+		if len(requests) != tt.shown {
+			t.Fatalf("edit %q: dialog shown %d times, want %d", tt.edit, len(requests), tt.shown)
+		}
+		if last := requests[len(requests)-1]; tt.shown > 1 && (last.Command != tt.edit || !strings.Contains(last.Warning, "policy: deletes files")) {
+			t.Errorf("edit %q shown again as %q with warning %q", tt.edit, last.Command, last.Warning)
+		}
+	}
+}
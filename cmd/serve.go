@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/httpapi"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/rpc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveStdio bool
+	serveHTTP  string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve --stdio | --http 127.0.0.1:PORT",
+	Short: "Serve the command generator to editors and other tools",
+	Long: `Serve the command generator to another program.
+
+With --stdio, vibe speaks JSON-RPC 2.0 on stdin and stdout, one message per
+line, for editor integrations (Neovim, VS Code). Methods:
+
+  generate      {"query": "..."}          the generated command
+  history.list  {"limit": 10}             recent history entries, newest first
+  cancel        {"id": <request id>}      stop a running generate request
+
+During generate the server sends "progress" notifications with status
+messages and "partial" notifications with the command and each explanation
+line. Only protocol messages are written to stdout; debug logs go to stderr.
+
+With --http, vibe serves a REST API on a loopback address for scripts and
+local tools. Requests need "Authorization: Bearer <token>", with the token
+vibe generates into the state directory (file api-token). Endpoints:
+
+  POST /v1/generate   {"query": "..."}   the generated command
+  GET  /v1/history    ?limit=N           recent history entries, newest first
+
+Send "Accept: text/event-stream" to /v1/generate to receive "progress" events
+followed by a "result" or "error" event.
+
+Both apply the policy file (VIBE_POLICY_FILE): a blocked command is answered
+with an error (JSON-RPC code -32001, HTTP 403) carrying exit code 19 instead
+of the command.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		serveSetup()
+		switch {
+		case serveStdio && serveHTTP != "":
+			fmt.Fprintln(os.Stderr, "Error: --stdio and --http are mutually exclusive")
+			os.Exit(1)
+		case serveStdio:
+			serveRPC()
+		case serveHTTP != "":
+			serveAPI(serveHTTP)
+		default:
+			fmt.Fprintln(os.Stderr, "Error: choose a transport: --stdio or --http 127.0.0.1:PORT")
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().BoolVar(&serveStdio, "stdio", false, "Speak JSON-RPC 2.0 on stdin/stdout")
+	serveCmd.Flags().StringVar(&serveHTTP, "http", "", "Serve the HTTP API on this loopback address, e.g. 127.0.0.1:8765")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func serveRPC() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := rpc.NewServer(client.New(cfg), serveHistory(), mustLoadPolicy())
+	if err := s.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func serveAPI(addr string) {
+	if err := requireLoopback(addr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	dir, err := cfg.EnsureStateDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	token, err := httpapi.LoadToken(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: creating the API token: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           httpapi.NewServer(client.New(cfg), serveHistory(), mustLoadPolicy(), token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving the vibe API on http://%s (token: %s)\n", addr, httpapi.TokenPath(dir))
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveSetup applies --debug, which initConfig leaves to the query command.
+func serveSetup() {
+	if rootCmd.PersistentFlags().Changed("debug") {
+		cfg.EnableDebugLogs = debugLogs
+	}
+	logger.Init(cfg.EnableDebugLogs)
+}
+
+// serveHistory returns the history generated commands are recorded in, or
+// nil when history is disabled or unavailable.
+func serveHistory() *history.History {
+	if !cfg.EnableHistory {
+		return nil
+	}
+	h, err := history.New(cfg.CacheDir, cfg.HistorySize)
+	if err != nil {
+		logger.Debug("History unavailable: %v", err)
+		return nil
+	}
+	return h
+}
+
+// requireLoopback rejects addresses other machines could reach: the API is
+// for local tools and generates with the user's credentials.
+func requireLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid --http address %q: %v", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("--http must listen on a loopback address such as 127.0.0.1:8765, not %q", addr)
+}
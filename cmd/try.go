@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/confirm"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/placeholder"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+	"github.com/skymoore/vibe-zsh/internal/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tryCommand string
+	tryMaxSize int64
+	tryTimeout time.Duration
+)
+
+var tryCmd = &cobra.Command{
+	Use:   "try [query]",
+	Short: "Run a generated command on a copy of the current directory and show what it changed",
+	Long: `Generate a command for the query, run it against a temporary copy of the
+current directory, and list the files it created, modified, renamed and
+deleted, with a diff of each changed text file. The real directory is not
+touched; the copy is removed afterwards.
+
+Pass --command to try a command you already have instead of generating one.
+A generated command's placeholders are filled in first, and one with a
+warning or a safety level other than safe is only run once its phrase is
+typed in the confirmation dialog.
+
+Commands that name paths outside the directory (absolute paths, ~, ..,
+$HOME), use the network, run as root, change to the home directory or run
+code the check can't read (interpreters such as python, perl or sh -c, eval,
+scripts, make) are refused, as are directories larger than --max-size or
+holding symlinks that lead out of them. The check reads the command's text:
+the copy is not a sandbox.
+
+Examples:
+  vibe try "rename every .jpeg file to .jpg"
+  vibe try --command "sed -i 's/foo/bar/g' *.conf"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if tryCommand == "" && len(args) == 0 {
+			return errors.New("give a query or --command")
+		}
+		if tryCommand != "" && len(args) > 0 {
+			return errors.New("give a query or --command, not both")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runTry(strings.Join(args, " "))
+	},
+}
+
+func init() {
+	tryCmd.Flags().StringVarP(&tryCommand, "command", "c", "", "Try this command instead of generating one")
+	tryCmd.Flags().Int64Var(&tryMaxSize, "max-size", snapshot.DefaultMaxSize>>20, "Largest directory to copy, in MiB")
+	tryCmd.Flags().DurationVar(&tryTimeout, "run-timeout", snapshot.DefaultTimeout, "How long the command may run in the copy")
+	rootCmd.AddCommand(tryCmd)
+}
+
+func runTry(query string) {
+	// initConfig leaves these flags to the query command.
+	if rootCmd.PersistentFlags().Changed("cache") {
+		cfg.EnableCache = enableCache
+	}
+	if rootCmd.PersistentFlags().Changed("debug") {
+		cfg.EnableDebugLogs = debugLogs
+	}
+	logger.Init(cfg.EnableDebugLogs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	generated := tryCommand == ""
+	resp := &schema.CommandResponse{Command: tryCommand}
+	if generated {
+		resp, _ = mustGenerate(ctx, daemonClient(), query)
+
+		// Placeholders are filled in as for the query command; one left in
+		// would be run as a redirection.
+		fillPlaceholders(query, resp)
+		if ps := placeholder.Detect(resp.Command, resp.Placeholders); len(ps) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: the command has placeholders to fill in: %s\n", strings.Join(placeholder.Tokens(ps), ", "))
+			fmt.Fprintf(os.Stderr, "# %s\n", resp.Command)
+			fmt.Fprintln(os.Stderr, "Hint: fill them in and try it with --command")
+			os.Exit(1)
+		}
+		if cfg.ShowWarnings && resp.Warning != "" {
+			fmt.Fprintf(os.Stderr, "# WARNING: %s\n", cleanExplanation(resp.Warning))
+		}
+	}
+	command, safetyLevel := confirmTry(query, resp, generated)
+	if generated {
+		auditTry(query, command, safetyLevel, audit.Tried)
+	}
+
+	fmt.Printf("$ %s\n", command)
+	res, err := snapshot.Try(ctx, command, dir, snapshot.Options{
+		Shell:   cfg.Shell,
+		MaxSize: tryMaxSize << 20,
+		Timeout: tryTimeout,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, snapshot.ErrTooLarge) {
+			fmt.Fprintln(os.Stderr, "Hint: raise the limit with --max-size, or try from a smaller directory")
+		}
+		os.Exit(1)
+	}
+
+	printTry(res)
+}
+
+// confirmTry applies the policy to resp's command before it is run, even on
+// a copy: a blocked command exits. A generated command that needs
+// its phrase typed in the query command's dialog, or that a rule requires
+// confirming, is shown in the dialog first, and an edit is checked again.
+// It returns the command to run and its safety level.
+func confirmTry(query string, resp *schema.CommandResponse, generated bool) (string, string) {
+	pol := mustLoadPolicy()
+	for {
+		decision, err := pol.Apply(resp)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "# BLOCKED by policy rule %q: %s\n", decision.Rule.Name, decision.Message)
+			fmt.Fprintf(os.Stderr, "# %s\n", resp.Command)
+			if generated {
+				auditTry(query, resp.Command, resp.SafetyLevel, audit.Blocked)
+			}
+			os.Exit(apierrors.ExitPolicyBlocked)
+		}
+
+		req := confirm.Request{
+			Command:     resp.Command,
+			Warning:     cleanExplanation(resp.Warning),
+			SafetyLevel: resp.SafetyLevel,
+		}
+		if !generated || (decision.Action != policy.RequireConfirm && !confirm.NeedsPhrase(req)) {
+			return resp.Command, resp.SafetyLevel
+		}
+
+		res, err := confirm.Confirm(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error showing confirmation: %v\n", err)
+			os.Exit(1)
+		}
+		if !res.Confirmed {
+			auditTry(query, resp.Command, resp.SafetyLevel, audit.Cancelled)
+			os.Exit(0)
+		}
+		if !res.Edited {
+			return resp.Command, resp.SafetyLevel
+		}
+		a := safety.Analyze(res.Command)
+		resp = &schema.CommandResponse{
+			Command:     res.Command,
+			Warning:     strings.Join(a.Reasons, "; "),
+			SafetyLevel: a.Level,
+		}
+	}
+}
+
+func printTry(res *snapshot.Result) {
+	fmt.Printf("# Ran in a copy of %d files (%s)\n", res.Files, formatSize(res.Size))
+	if out := strings.TrimRight(string(res.Output), "\n"); out != "" {
+		fmt.Println(out)
+	}
+	switch {
+	case res.TimedOut:
+		fmt.Printf("# Stopped after %s; the changes below may be partial\n", tryTimeout)
+	case res.ExitCode != 0:
+		fmt.Printf("# Exit status %d\n", res.ExitCode)
+	}
+	fmt.Println()
+
+	if len(res.Changes) == 0 {
+		fmt.Println("No files changed.")
+		return
+	}
+	fmt.Printf("%d changed:\n", len(res.Changes))
+	for _, c := range res.Changes {
+		line := fmt.Sprintf("  %-9s %s", c.Kind, c.Path)
+		if c.Kind == snapshot.Renamed {
+			line = fmt.Sprintf("  %-9s %s -> %s", c.Kind, c.From, c.Path)
+		}
+		if c.Detail != "" {
+			line += " (" + c.Detail + ")"
+		}
+		fmt.Println(line)
+	}
+	for _, c := range res.Changes {
+		if c.Diff != "" {
+			fmt.Println()
+			fmt.Print(c.Diff)
+		}
+	}
+}
+
+// auditTry records a generated command in the audit log, its secrets
+// hidden as in the history.
+func auditTry(query, command, safetyLevel, outcome string) {
+	storedQuery, storedCommand := client.Redactor(cfg).Scrub(query, command)
+	recordAudit(storedQuery, storedCommand, safetyLevel, outcome)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/models"
+	"github.com/spf13/cobra"
+)
+
+// warmTimeout bounds how long vibe warm waits for a model to load.
+const warmTimeout = 5 * time.Minute
+
+var warmCmd = &cobra.Command{
+	Use:   "warm",
+	Short: "Load the configured model so the next query starts immediately",
+	Long: `Load the configured model (VIBE_MODEL) into Ollama's memory and keep it
+there for VIBE_KEEP_ALIVE. The plugin runs this in the background when a shell
+starts (disable with VIBE_WARM_ON_START=false), so the first query doesn't wait
+for the model to load.
+
+Other providers load their models themselves; for them this does nothing.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		warmModel()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(warmCmd)
+}
+
+func warmModel() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := models.Warm(ctx, cfg)
+	if errors.Is(err, models.ErrUnsupported) {
+		fmt.Fprintf(os.Stderr, "Nothing to warm: provider %q loads models itself.\n", cfg.Provider)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error warming %s: %v\n", cfg.Model, err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is loaded (took %s, keep_alive %s).\n",
+		cfg.Model, time.Since(start).Round(100*time.Millisecond), keepAliveLabel(cfg.KeepAlive))
+}
+
+func keepAliveLabel(keepAlive string) string {
+	if keepAlive == "" {
+		return "server default"
+	}
+	return keepAlive
+}
@@ -0,0 +1,223 @@
+// Package audit keeps an append-only JSONL record of the commands vibe
+// suggests and what became of them. Unlike the history, which is capped and
+// rewritten on every save, the log only grows, rotating to numbered files
+// past a size limit. Entries can be hash-chained, each one's hash covering
+// the previous one's, so that editing or removing an entry shows up in
+// Verify.
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// Outcomes recorded in Entry.Outcome.
+const (
+	Inserted    = "inserted"    // Put in the buffer without a confirmation dialog
+	Accepted    = "accepted"    // Confirmed in the dialog
+	Edited      = "edited"      // Changed in the dialog, then confirmed
+	Regenerated = "regenerated" // Replaced with another from the dialog
+	Cancelled   = "cancelled"   // Cancelled in the dialog
+	Blocked     = "blocked"     // Blocked by a policy rule
+	Tried       = "tried"       // Run on a copy of the directory by vibe try
+	Suggested   = "suggested"   // Returned by vibe serve or vibe batch
+)
+
+// Defaults for Options.
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultKeep    = 5
+)
+
+// Entry is one line of the log.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Host        string    `json:"host"`
+	Cwd         string    `json:"cwd"`
+	Query       string    `json:"query"`
+	Command     string    `json:"command"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	SafetyLevel string    `json:"safety_level,omitempty"`
+	Outcome     string    `json:"outcome"`
+
+	// Set when the log is hash-chained. Hash is the SHA-256 of the line
+	// up to it, so it must stay the last field.
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Options configures a Log. Zero values use the defaults.
+type Options struct {
+	MaxSize int64 // Rotate once the file reaches this many bytes
+	Keep    int   // Rotated files to keep: path.1 (newest) to path.Keep
+	Chain   bool  // Hash-chain new entries
+}
+
+// Log appends entries to a file, rotating it by size. Several vibe
+// processes may append to the same log; a lock file serializes them.
+type Log struct {
+	path string
+	opts Options
+}
+
+// Open returns the log at path. The file is created on the first Append.
+func Open(path string, opts Options) *Log {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = DefaultKeep
+	}
+	return &Log{path: path, opts: opts}
+}
+
+// Append records e, filling in Time, and PrevHash and Hash for a chained
+// log.
+func (l *Log) Append(e Entry) error {
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lock(l.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size() >= l.opts.MaxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.PrevHash, e.Hash = "", ""
+	if l.opts.Chain {
+		// After a rotation the chain continues from the newest rotated
+		// file.
+		prev, ok, err := lastHash(l.path)
+		if err == nil && !ok {
+			prev, _, err = lastHash(rotated(l.path, 1))
+		}
+		if err != nil {
+			return err
+		}
+		e.PrevHash = prev
+	}
+
+	line, err := encode(e, l.opts.Chain)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest, and path to
+// path.1.
+func (l *Log) rotate() error {
+	os.Remove(rotated(l.path, l.opts.Keep))
+	for n := l.opts.Keep - 1; n >= 1; n-- {
+		if err := os.Rename(rotated(l.path, n), rotated(l.path, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.path, rotated(l.path, 1))
+}
+
+func rotated(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// encode renders e as a line of JSON. For a chained entry the hash covers
+// the line as it would be without the hash field.
+func encode(e Entry, chain bool) ([]byte, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	if chain {
+		sum := sha256.Sum256(body)
+		e.Hash = hex.EncodeToString(sum[:])
+		if body, err = json.Marshal(e); err != nil {
+			return nil, err
+		}
+	}
+	return append(body, '\n'), nil
+}
+
+// hashField matches the hash at the end of a chained line.
+var hashField = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// lastHash returns the hash of the last entry in path, "" if that entry
+// isn't chained. ok is false when path is missing or empty.
+func lastHash(path string) (hash string, ok bool, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", false, err
+	}
+
+	// Entries are short; the last one is in the file's tail.
+	const tail = 64 << 10
+	offset := max(info.Size()-tail, 0)
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return "", false, nil
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	if m := hashField.FindSubmatch(data); m != nil {
+		return string(m[1]), true, nil
+	}
+	return "", true, nil
+}
+
+// lock takes an exclusive lock on path, creating it if needed, and
+// returns the function that releases it.
+func lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
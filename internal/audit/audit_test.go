@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func appendN(t *testing.T, l *Log, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := l.Append(Entry{
+			User:    "alice",
+			Query:   fmt.Sprintf("query %d", i),
+			Command: fmt.Sprintf("echo %d", i),
+			Outcome: Inserted,
+		})
+		if err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	appendN(t, Open(path, Options{}), 2)
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var e Entry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Command != "echo 1" || e.Outcome != Inserted || e.Time.IsZero() || e.Hash != "" {
+		t.Errorf("entry = %+v", e)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %o, want 600", info.Mode().Perm())
+	}
+
+	r, err := Verify(path)
+	if err != nil || r.Entries != 2 || r.Chained != 0 {
+		t.Errorf("Verify = %+v, %v", r, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := Open(path, Options{MaxSize: 1, Keep: 2, Chain: true})
+	appendN(t, l, 4)
+
+	// Every append but the first rotates: the newest entry is in path,
+	// the two before it in path.1 and path.2, and the first is gone.
+	for file, want := range map[string]string{path: "echo 3", path + ".1": "echo 2", path + ".2": "echo 1"} {
+		lines := readLines(t, file)
+		if len(lines) != 1 || !strings.Contains(lines[0], want) {
+			t.Errorf("%s = %q, want %s", filepath.Base(file), lines, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s.3 exists", path)
+	}
+
+	// The chain carries across files.
+	r, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(r.Files) != 3 || r.Entries != 3 || r.Chained != 3 {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+	}{
+		{"edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], "echo 1", "echo 9", 1)
+			return lines
+		}},
+		{"removed", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}},
+		{"reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}},
+		{"hash stripped", func(lines []string) []string {
+			var e Entry
+			json.Unmarshal([]byte(lines[1]), &e)
+			e.PrevHash, e.Hash = "", ""
+			data, _ := json.Marshal(e)
+			lines[1] = string(data)
+			return lines
+		}},
+		{"garbage", func(lines []string) []string {
+			lines[1] = "not json"
+			return lines
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			appendN(t, Open(path, Options{Chain: true}), 4)
+			if _, err := Verify(path); err != nil {
+				t.Fatalf("Verify before tampering: %v", err)
+			}
+
+			lines := tt.tamper(readLines(t, path))
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Verify(path); !errors.Is(err, ErrTampered) {
+				t.Errorf("Verify = %v, want ErrTampered", err)
+			}
+		})
+	}
+}
+
+func TestChainAfterUnchainedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	appendN(t, Open(path, Options{}), 2)
+	appendN(t, Open(path, Options{Chain: true}), 2)
+
+	r, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r.Entries != 4 || r.Chained != 2 || r.LastHash == "" {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestVerifyMissing(t *testing.T) {
+	if _, err := Verify(filepath.Join(t.TempDir(), "audit.jsonl")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrTampered means an entry was edited, removed or reordered after it was
+// written.
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// Report summarizes a verified log.
+type Report struct {
+	Files    []string // Checked, oldest first
+	Entries  int      // Entries read
+	Chained  int      // Entries with a hash
+	LastHash string   // Hash of the last entry, if chained
+}
+
+// Verify reads the log at path and its rotated files, oldest first, and
+// checks that every line is an entry and that each chained entry's hash
+// matches its content and follows the entry before it. The first problem
+// is returned, wrapping ErrTampered for a broken chain; the report covers
+// what was read up to it.
+//
+// The oldest remaining file's first entry can't be checked against the
+// entry before it, which rotation deleted, and entries removed from the end
+// leave no trace; keeping LastHash elsewhere catches the latter.
+func Verify(path string) (*Report, error) {
+	files, err := logFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{}
+	prev, first := "", true
+	for _, file := range files {
+		r.Files = append(r.Files, file)
+		if err := r.verifyFile(file, &prev, &first); err != nil {
+			return r, err
+		}
+	}
+	r.LastHash = prev
+	return r, nil
+}
+
+func (r *Report) verifyFile(file string, prev *string, first *bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		where := fmt.Sprintf("%s:%d", filepath.Base(file), n)
+
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return fmt.Errorf("%w: %s is not an entry: %v", ErrTampered, where, err)
+		}
+		r.Entries++
+
+		if e.Hash == "" {
+			// An unchained entry ends the chain; the next chained one
+			// starts a new one.
+			*prev, *first = "", false
+			continue
+		}
+		r.Chained++
+
+		m := hashField.FindStringSubmatchIndex(line)
+		if m == nil {
+			return fmt.Errorf("%w: %s: the hash is not the last field", ErrTampered, where)
+		}
+		sum := sha256.Sum256([]byte(line[:m[0]] + "}"))
+		if hex.EncodeToString(sum[:]) != e.Hash {
+			return fmt.Errorf("%w: %s: the entry does not match its hash", ErrTampered, where)
+		}
+		if !*first && e.PrevHash != *prev {
+			return fmt.Errorf("%w: %s: the entry does not follow the one before it", ErrTampered, where)
+		}
+		*prev, *first = e.Hash, false
+	}
+	return scanner.Err()
+}
+
+// logFiles returns path and its rotated files, oldest first.
+func logFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	type numbered struct {
+		path string
+		n    int
+	}
+	var rotatedFiles []numbered
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err == nil && n > 0 {
+			rotatedFiles = append(rotatedFiles, numbered{m, n})
+		}
+	}
+	sort.Slice(rotatedFiles, func(i, j int) bool { return rotatedFiles[i].n > rotatedFiles[j].n })
+
+	var files []string
+	for _, f := range rotatedFiles {
+		files = append(files, f.path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	} else if len(files) == 0 {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,168 @@
+// Package auth implements the authentication schemes supported by the
+// openai-compatible provider.
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Supported values of VIBE_AUTH_SCHEME.
+const (
+	SchemeBearer = "bearer"  // Authorization: Bearer <key>
+	SchemeAPIKey = "api-key" // api-key: <key> (Azure-style gateways)
+	SchemeHeader = "header"  // <VIBE_AUTH_HEADER>: <key>
+	SchemeBasic  = "basic"   // Authorization: Basic <username:key>
+	SchemeOAuth2 = "oauth2"  // Authorization: Bearer <client-credentials token>
+	SchemeNone   = "none"    // Only the static extra headers
+)
+
+// DefaultHeader is the header used by SchemeHeader when none is configured.
+const DefaultHeader = "X-Api-Key"
+
+// Config describes how requests are authenticated.
+type Config struct {
+	Scheme   string
+	APIKey   string // Key for bearer/api-key/header; password for basic
+	Header   string // Header name for SchemeHeader
+	Username string // Username for SchemeBasic
+
+	// OAuth2 client-credentials settings.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+
+	// ExtraHeaders are sent with every request regardless of scheme.
+	ExtraHeaders map[string]string
+
+	// CacheDir is where OAuth2 tokens are kept between runs. Empty uses
+	// ~/.cache/vibe.
+	CacheDir string
+}
+
+// Authenticator produces the headers that authenticate a request. For OAuth2
+// it also fetches, caches and refreshes the access token.
+type Authenticator struct {
+	cfg Config
+
+	mu    sync.Mutex
+	token *token
+}
+
+// New validates cfg and returns an Authenticator for it.
+func New(cfg Config) (*Authenticator, error) {
+	if cfg.Scheme == "" {
+		cfg.Scheme = SchemeBearer
+	}
+	cfg.Scheme = strings.ToLower(cfg.Scheme)
+
+	switch cfg.Scheme {
+	case SchemeBearer, SchemeAPIKey, SchemeNone:
+	case SchemeHeader:
+		if cfg.Header == "" {
+			cfg.Header = DefaultHeader
+		}
+	case SchemeBasic:
+		if cfg.Username == "" {
+			return nil, fmt.Errorf("basic auth requires VIBE_AUTH_USERNAME (VIBE_API_KEY is the password)")
+		}
+	case SchemeOAuth2:
+		if cfg.TokenURL == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("oauth2 auth requires VIBE_OAUTH_TOKEN_URL, VIBE_OAUTH_CLIENT_ID and VIBE_OAUTH_CLIENT_SECRET")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth scheme %q (want bearer, api-key, header, basic, oauth2 or none)", cfg.Scheme)
+	}
+
+	return &Authenticator{cfg: cfg}, nil
+}
+
+// Scheme returns the configured scheme.
+func (a *Authenticator) Scheme() string {
+	return a.cfg.Scheme
+}
+
+// Prepare makes sure credentials are ready before a request. For OAuth2 it
+// loads a cached token or fetches a new one when the current token is about
+// to expire; other schemes need no preparation.
+func (a *Authenticator) Prepare(ctx context.Context) error {
+	if a.cfg.Scheme != SchemeOAuth2 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token.valid() {
+		return nil
+	}
+	if t, ok := a.loadToken(); ok {
+		a.token = t
+		return nil
+	}
+
+	t, err := a.fetchToken(ctx)
+	if err != nil {
+		return err
+	}
+	a.token = t
+	a.saveToken(t)
+	return nil
+}
+
+// Invalidate discards the current OAuth2 token, so the next Prepare fetches a
+// fresh one. It is called when the server rejects a token before its expiry.
+func (a *Authenticator) Invalidate() {
+	if a.cfg.Scheme != SchemeOAuth2 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = nil
+	a.removeToken()
+}
+
+// Refreshable reports whether Invalidate followed by Prepare can yield
+// different credentials, i.e. whether retrying after a 401 can help.
+func (a *Authenticator) Refreshable() bool {
+	return a.cfg.Scheme == SchemeOAuth2
+}
+
+// Headers returns the extra headers plus the authentication header. For
+// OAuth2, Prepare must have succeeded first.
+func (a *Authenticator) Headers() map[string]string {
+	headers := make(map[string]string, len(a.cfg.ExtraHeaders)+1)
+	for k, v := range a.cfg.ExtraHeaders {
+		headers[k] = v
+	}
+
+	key := a.cfg.APIKey
+	switch a.cfg.Scheme {
+	case SchemeBearer:
+		if key != "" {
+			headers["Authorization"] = "Bearer " + key
+		}
+	case SchemeAPIKey:
+		if key != "" {
+			headers["api-key"] = key
+		}
+	case SchemeHeader:
+		if key != "" {
+			headers[a.cfg.Header] = key
+		}
+	case SchemeBasic:
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(a.cfg.Username+":"+key))
+	case SchemeOAuth2:
+		a.mu.Lock()
+		if a.token != nil {
+			headers["Authorization"] = "Bearer " + a.token.AccessToken
+		}
+		a.mu.Unlock()
+	}
+	return headers
+}
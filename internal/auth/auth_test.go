@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHeaders(t *testing.T) {
+	extra := map[string]string{"X-Team": "infra"}
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		header string
+		want   string
+	}{
+		{"bearer", Config{Scheme: SchemeBearer, APIKey: "k"}, "Authorization", "Bearer k"},
+		{"default is bearer", Config{APIKey: "k"}, "Authorization", "Bearer k"},
+		{"api-key", Config{Scheme: SchemeAPIKey, APIKey: "k"}, "api-key", "k"},
+		{"custom header", Config{Scheme: SchemeHeader, APIKey: "k"}, "X-Api-Key", "k"},
+		{"named header", Config{Scheme: SchemeHeader, Header: "X-Gateway-Key", APIKey: "k"}, "X-Gateway-Key", "k"},
+		{"basic", Config{Scheme: SchemeBasic, Username: "user", APIKey: "pass"}, "Authorization", "Basic dXNlcjpwYXNz"},
+		{"none", Config{Scheme: SchemeNone, APIKey: "k"}, "Authorization", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ExtraHeaders = extra
+			a, err := New(tt.cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			headers := a.Headers()
+			if got := headers[tt.header]; got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.header, got, tt.want)
+			}
+			if headers["X-Team"] != "infra" {
+				t.Errorf("extra header missing: %v", headers)
+			}
+		})
+	}
+}
+
+func TestNewRejectsIncompleteConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Scheme: "kerberos"},
+		{Scheme: SchemeBasic, APIKey: "pass"},
+		{Scheme: SchemeOAuth2, TokenURL: "http://localhost/token"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+// tokenServer is a stub OAuth2 token endpoint that issues "token-1",
+// "token-2", ... valid for expiresIn seconds.
+func tokenServer(t *testing.T, expiresIn int, requireFormCredentials bool) (*httptest.Server, *int32) {
+	t.Helper()
+	var issued int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		id, secret, ok := r.BasicAuth()
+		if requireFormCredentials {
+			id, secret, ok = r.Form.Get("client_id"), r.Form.Get("client_secret"), r.Form.Get("client_id") != ""
+		}
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+
+		n := atomic.AddInt32(&issued, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &issued
+}
+
+func oauthConfig(tokenURL, cacheDir string) Config {
+	return Config{
+		Scheme:       SchemeOAuth2,
+		TokenURL:     tokenURL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scope:        "llm.invoke",
+		CacheDir:     cacheDir,
+	}
+}
+
+func TestOAuth2FetchesAndCachesToken(t *testing.T) {
+	srv, issued := tokenServer(t, 3600, false)
+	dir := t.TempDir()
+
+	a, _ := New(oauthConfig(srv.URL, dir))
+	if err := a.Prepare(context.Background()); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if got := a.Headers()["Authorization"]; got != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want Bearer token-1", got)
+	}
+
+	// A new process (new Authenticator) reuses the cached token.
+	b, _ := New(oauthConfig(srv.URL, dir))
+	if err := b.Prepare(context.Background()); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if got := b.Headers()["Authorization"]; got != "Bearer token-1" {
+		t.Errorf("Authorization after reload = %q, want the cached token-1", got)
+	}
+	if n := atomic.LoadInt32(issued); n != 1 {
+		t.Errorf("token endpoint called %d times, want 1", n)
+	}
+}
+
+func TestOAuth2RefreshesExpiringToken(t *testing.T) {
+	// Tokens that expire within expiryDelta are refreshed right away.
+	srv, issued := tokenServer(t, 30, false)
+
+	a, _ := New(oauthConfig(srv.URL, t.TempDir()))
+	for i := 0; i < 2; i++ {
+		if err := a.Prepare(context.Background()); err != nil {
+			t.Fatalf("Prepare: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(issued); n != 2 {
+		t.Errorf("token endpoint called %d times, want 2", n)
+	}
+	if got := a.Headers()["Authorization"]; got != "Bearer token-2" {
+		t.Errorf("Authorization = %q, want Bearer token-2", got)
+	}
+}
+
+func TestOAuth2Invalidate(t *testing.T) {
+	srv, issued := tokenServer(t, 3600, false)
+	dir := t.TempDir()
+
+	a, _ := New(oauthConfig(srv.URL, dir))
+	a.Prepare(context.Background())
+	a.Invalidate()
+	if err := a.Prepare(context.Background()); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if got := a.Headers()["Authorization"]; got != "Bearer token-2" {
+		t.Errorf("Authorization after Invalidate = %q, want Bearer token-2", got)
+	}
+	if n := atomic.LoadInt32(issued); n != 2 {
+		t.Errorf("token endpoint called %d times, want 2", n)
+	}
+}
+
+func TestOAuth2FormCredentialsFallback(t *testing.T) {
+	srv, _ := tokenServer(t, 3600, true)
+
+	a, _ := New(oauthConfig(srv.URL, t.TempDir()))
+	if err := a.Prepare(context.Background()); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if got := a.Headers()["Authorization"]; got != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want Bearer token-1", got)
+	}
+}
+
+func TestOAuth2BadCredentials(t *testing.T) {
+	srv, _ := tokenServer(t, 3600, false)
+	cfg := oauthConfig(srv.URL, t.TempDir())
+	cfg.ClientSecret = "wrong"
+
+	a, _ := New(cfg)
+	if err := a.Prepare(context.Background()); err == nil {
+		t.Error("Prepare succeeded with a wrong client secret")
+	}
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/transport"
+)
+
+const (
+	// expiryDelta refreshes tokens slightly early so a token never expires
+	// while a request is in flight.
+	expiryDelta = 60 * time.Second
+
+	tokenRequestTimeout = 15 * time.Second
+)
+
+// token is an OAuth2 access token as cached on disk.
+type token struct {
+	AccessToken string    `json:"access_token"`
+	Expiry      time.Time `json:"expiry,omitempty"` // Zero if the server gave no lifetime
+}
+
+func (t *token) valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.Expiry)
+}
+
+// fetchToken runs the client-credentials grant. Client credentials are sent
+// with HTTP Basic auth as RFC 6749 recommends; servers that only accept them
+// in the form body (e.g. Azure AD) are retried that way.
+func (a *Authenticator) fetchToken(ctx context.Context) (*token, error) {
+	t, status, err := a.requestToken(ctx, true)
+	if err != nil && (status == http.StatusBadRequest || status == http.StatusUnauthorized) {
+		t, _, err = a.requestToken(ctx, false)
+	}
+	return t, err
+}
+
+func (a *Authenticator) requestToken(ctx context.Context, basicAuth bool) (*token, int, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if a.cfg.Scope != "" {
+		form.Set("scope", a.cfg.Scope)
+	}
+	if !basicAuth {
+		form.Set("client_id", a.cfg.ClientID)
+		form.Set("client_secret", a.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(a.cfg.ClientID), url.QueryEscape(a.cfg.ClientSecret))
+	}
+
+	resp, err := transport.NewClient(tokenRequestTimeout).Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read OAuth2 token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("OAuth2 token endpoint returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var parsed struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.AccessToken == "" {
+		return nil, resp.StatusCode, fmt.Errorf("OAuth2 token endpoint returned no access_token")
+	}
+
+	t := &token{AccessToken: parsed.AccessToken}
+	if parsed.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(parsed.ExpiresIn) * time.Second)
+	}
+	return t, resp.StatusCode, nil
+}
+
+// tokenPath names the cache file for this token endpoint, client and scope,
+// so different gateways never share a token.
+func (a *Authenticator) tokenPath() (string, error) {
+	dir := a.cfg.CacheDir
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".cache", "vibe")
+	}
+	sum := sha256.Sum256([]byte(a.cfg.TokenURL + "\n" + a.cfg.ClientID + "\n" + a.cfg.Scope))
+	return filepath.Join(dir, "oauth2-"+hex.EncodeToString(sum[:8])+".token"), nil
+}
+
+// loadToken returns the cached token if it is still valid. Each vibe
+// invocation is a new process, so without this every query would fetch a
+// token.
+func (a *Authenticator) loadToken() (*token, bool) {
+	path, err := a.tokenPath()
+	if err != nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var t token
+	if err := json.Unmarshal(data, &t); err != nil || !t.valid() {
+		return nil, false
+	}
+	return &t, true
+}
+
+// saveToken caches t for later runs. Failing to cache is not an error; the
+// next run simply fetches a new token.
+func (a *Authenticator) saveToken(t *token) {
+	path, err := a.tokenPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	// The token is a credential: keep it private to the user.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
+
+func (a *Authenticator) removeToken() {
+	if path, err := a.tokenPath(); err == nil {
+		_ = os.Remove(path)
+	}
+}
@@ -0,0 +1,267 @@
+// Package batch generates commands for many queries at once, for building
+// and regression-testing runbooks.
+//
+// Input has one item per line: either a plain query, or a JSON object (see
+// Item) that may override the model and generation settings for that query.
+// Blank lines and lines starting with '#' are skipped. Output is one JSON
+// Result per item, in input order.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// DefaultConcurrency is how many queries run at once unless told otherwise.
+const DefaultConcurrency = 4
+
+// maxLineSize bounds a single input line.
+const maxLineSize = 1 << 20
+
+// Item is a JSONL input record. Zero-valued overrides keep the configured
+// setting.
+type Item struct {
+	ID          string   `json:"id,omitempty"` // Copied to the result
+	Query       string   `json:"query"`
+	Provider    string   `json:"provider,omitempty"`
+	APIURL      string   `json:"api_url,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// apply returns a copy of cfg with the item's overrides, the way the
+// matching command-line flags override the environment.
+func (it Item) apply(cfg *config.Config) *config.Config {
+	c := *cfg
+	if it.Provider != "" {
+		c.Provider = it.Provider
+	}
+	if it.APIURL != "" {
+		c.APIURL = it.APIURL
+	}
+	if it.Model != "" {
+		c.Model = it.Model
+	}
+	if it.Temperature != nil {
+		c.Temperature = *it.Temperature
+	}
+	if it.MaxTokens > 0 {
+		c.MaxTokens = it.MaxTokens
+	}
+	return &c
+}
+
+// Result is the output record for one input item. Response is set on
+// success; Error and ExitCode on failure.
+type Result struct {
+	Line      int                     `json:"line"`
+	ID        string                  `json:"id,omitempty"`
+	Query     string                  `json:"query"`
+	Model     string                  `json:"model"`
+	Response  *schema.CommandResponse `json:"response,omitempty"`
+	Layer     string                  `json:"layer,omitempty"` // See the client.Layer constants
+	Attempts  int                     `json:"attempts"`
+	LatencyMS int64                   `json:"latency_ms"`
+	Error     string                  `json:"error,omitempty"`
+	ExitCode  int                     `json:"exit_code,omitempty"`
+}
+
+// Summary counts the items a Run processed.
+type Summary struct {
+	Total  int
+	Failed int
+}
+
+// Options configure a Run.
+type Options struct {
+	// Concurrency bounds how many queries run at once. Zero means
+	// DefaultConcurrency.
+	Concurrency int
+
+	// Policy is applied to every command; a blocked command is reported as
+	// a failed item without the response. nil allows everything.
+	Policy *policy.Policy
+}
+
+// job is an input item with its line number, or the reason it could not be
+// read.
+type job struct {
+	index int // Position among the items, for ordering the output
+	line  int
+	item  Item
+	err   error
+}
+
+// Run generates a command for every item read from in and writes the results
+// to out. Each worker has its own clients, since a client handles one query
+// at a time; all of them share the on-disk response cache. A failed item is
+// reported in its result and does not stop the run; only failing to read in
+// or write out does.
+func Run(ctx context.Context, cfg *config.Config, in io.Reader, out io.Writer, opts Options) (Summary, error) {
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan job)
+	results := make(chan finished)
+
+	var readErr error
+	go func() {
+		defer close(jobs)
+		readErr = read(ctx, in, jobs)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &worker{cfg: cfg, policy: opts.Policy, clients: make(map[string]*client.Client)}
+			for j := range jobs {
+				results <- finished{index: j.index, result: w.process(ctx, j)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	summary, writeErr := write(out, results)
+	if writeErr != nil {
+		// Stop reading and generating, and drain so the workers can finish.
+		cancel()
+		for range results {
+		}
+		return summary, writeErr
+	}
+	return summary, readErr
+}
+
+// finished is a job's result and its position in the output.
+type finished struct {
+	index  int
+	result Result
+}
+
+// read sends every item in in to jobs.
+func read(ctx context.Context, in io.Reader, jobs chan<- job) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	index := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		j := job{index: index, line: line}
+		if strings.HasPrefix(text, "{") {
+			if err := json.Unmarshal([]byte(text), &j.item); err != nil {
+				j.err = fmt.Errorf("invalid JSON record: %w", err)
+			} else if strings.TrimSpace(j.item.Query) == "" {
+				j.err = fmt.Errorf(`record has no "query"`)
+			}
+		} else {
+			j.item.Query = text
+		}
+
+		select {
+		case jobs <- j:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		index++
+	}
+	return scanner.Err()
+}
+
+// write writes results in input order as they complete.
+func write(out io.Writer, results <-chan finished) (Summary, error) {
+	enc := json.NewEncoder(out)
+	pending := make(map[int]Result)
+	next := 0
+	var summary Summary
+
+	for r := range results {
+		pending[r.index] = r.result
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			summary.Total++
+			if res.Error != "" {
+				summary.Failed++
+			}
+			if err := enc.Encode(res); err != nil {
+				return summary, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+// worker processes jobs one at a time with a client per distinct set of
+// overrides.
+type worker struct {
+	cfg     *config.Config
+	policy  *policy.Policy
+	clients map[string]*client.Client
+}
+
+func (w *worker) process(ctx context.Context, j job) Result {
+	res := Result{Line: j.line, ID: j.item.ID, Query: j.item.Query, Model: w.cfg.Model}
+	if j.err != nil {
+		res.Error = j.err.Error()
+		res.ExitCode = apierrors.ExitFailure
+		return res
+	}
+
+	cfg := j.item.apply(w.cfg)
+	res.Model = cfg.Model
+
+	key := cfg.Fingerprint()
+	c, ok := w.clients[key]
+	if !ok {
+		c = client.New(cfg)
+		w.clients[key] = c
+	}
+
+	start := time.Now()
+	g, err := c.GenerateDetailed(ctx, j.item.Query, nil)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err == nil {
+		err = c.Suggest(w.policy, j.item.Query, g)
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.ExitCode = apierrors.ExitCode(err)
+		return res
+	}
+	res.Response = g.Response
+	res.Layer = g.Layer
+	res.Attempts = g.Attempts
+	return res
+}
@@ -0,0 +1,247 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+)
+
+// llmServer answers every chat request with a command naming the requested
+// model, and records how many requests ran at the same time.
+func llmServer(t *testing.T, delay time.Duration) (*httptest.Server, *int32, *int32) {
+	t.Helper()
+	var requests, running, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+
+		var body struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&body)
+		content := `{"command":"echo ` + body.Model + `","explanation":["echo: print the model"]}`
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": content}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests, &peak
+}
+
+func testConfig(t *testing.T, url string) *config.Config {
+	t.Helper()
+	t.Setenv("VIBE_CONFIG_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	return &config.Config{
+		Provider:             "vllm",
+		APIURL:               url,
+		Model:                "base-model",
+		Temperature:          0.2,
+		MaxTokens:            100,
+		Timeout:              5 * time.Second,
+		Deadline:             10 * time.Second,
+		MaxRetries:           1,
+		UseStructuredOutput:  true,
+		EnableJSONExtraction: true,
+		StrictValidation:     true,
+		EnableCache:          true,
+		CacheDir:             t.TempDir(),
+		CacheTTL:             time.Hour,
+	}
+}
+
+func run(t *testing.T, cfg *config.Config, input string, opts Options) ([]Result, Summary) {
+	t.Helper()
+	var out strings.Builder
+	summary, err := Run(context.Background(), cfg, strings.NewReader(input), &out, opts)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	var results []Result
+	dec := json.NewDecoder(strings.NewReader(out.String()))
+	for {
+		var r Result
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, r)
+	}
+	return results, summary
+}
+
+func TestRun(t *testing.T) {
+	srv, _, _ := llmServer(t, 0)
+	cfg := testConfig(t, srv.URL)
+
+	input := strings.Join([]string{
+		"# runbook",
+		"list files",
+		"",
+		`{"id":"other","query":"show disk usage","model":"other-model"}`,
+		`{"id":"broken","query":`,
+		`{"model":"no-query"}`,
+	}, "\n")
+	results, summary := run(t, cfg, input, Options{})
+
+	if summary.Total != 4 || summary.Failed != 2 {
+		t.Errorf("summary = %+v, want 4 total, 2 failed", summary)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+
+	first := results[0]
+	if first.Line != 2 || first.Query != "list files" || first.Response == nil || first.Response.Command != "echo base-model" {
+		t.Errorf("first result = %+v", first)
+	}
+	if first.Layer != client.LayerStructuredOutput || first.Attempts != 1 {
+		t.Errorf("first result layer = %q after %d attempts, want %q after 1", first.Layer, first.Attempts, client.LayerStructuredOutput)
+	}
+
+	other := results[1]
+	if other.ID != "other" || other.Model != "other-model" || other.Response == nil || other.Response.Command != "echo other-model" {
+		t.Errorf("override result = %+v, want the other model's command", other)
+	}
+
+	for _, r := range results[2:] {
+		if r.Error == "" || r.ExitCode == 0 || r.Response != nil {
+			t.Errorf("result for line %d = %+v, want an error", r.Line, r)
+		}
+	}
+}
+
+func TestRunUsesCache(t *testing.T) {
+	srv, requests, _ := llmServer(t, 0)
+	cfg := testConfig(t, srv.URL)
+
+	run(t, cfg, "list files\n", Options{})
+	results, _ := run(t, cfg, "list files\n", Options{})
+
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("LLM saw %d requests, want 1", got)
+	}
+	if results[0].Layer != client.LayerCache || results[0].Attempts != 0 {
+		t.Errorf("second run: layer %q, %d attempts; want a cache hit", results[0].Layer, results[0].Attempts)
+	}
+}
+
+// TestRunCacheSeparatesModels checks that an item asking another model
+// isn't answered from the cache entry of the first.
+func TestRunCacheSeparatesModels(t *testing.T) {
+	srv, requests, _ := llmServer(t, 0)
+	cfg := testConfig(t, srv.URL)
+
+	input := "list files\n" + `{"query":"list files","model":"other-model"}` + "\n"
+	results, _ := run(t, cfg, input, Options{Concurrency: 1})
+
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("LLM saw %d requests, want 2", got)
+	}
+	for i, want := range []string{"echo base-model", "echo other-model"} {
+		if r := results[i]; r.Response == nil || r.Response.Command != want {
+			t.Errorf("result %d = %+v, want %q", i, r, want)
+		}
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	srv, _, _ := llmServer(t, 0)
+	cfg := testConfig(t, srv.URL)
+	pol, err := policy.Parse([]byte(`{"rules": [
+		{"name": "no-other", "regex": "other-model", "action": "block"},
+		{"name": "echo", "command": "echo", "action": "warn", "message": "echoes"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := "list files\n" + `{"query":"list files","model":"other-model"}` + "\n"
+	results, summary := run(t, cfg, input, Options{Policy: pol})
+
+	if summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 1 failed", summary)
+	}
+	if r := results[0]; r.Response == nil || !strings.Contains(r.Response.Warning, "policy: echoes") {
+		t.Errorf("warned result = %+v, want the policy warning", r)
+	}
+	if r := results[1]; r.Response != nil || r.ExitCode != apierrors.ExitPolicyBlocked || !strings.Contains(r.Error, "no-other") {
+		t.Errorf("blocked result = %+v, want an error without the response", r)
+	}
+}
+
+// TestRunAudit checks that batch results are recorded in the audit log with
+// the model each item used.
+func TestRunAudit(t *testing.T) {
+	srv, _, _ := llmServer(t, 0)
+	cfg := testConfig(t, srv.URL)
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+
+	input := "list files\n" + `{"query":"show disk usage","model":"other-model"}` + "\n"
+	run(t, cfg, input, Options{Concurrency: 1})
+
+	data, err := os.ReadFile(cfg.AuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e audit.Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.Model+" "+e.Outcome+": "+e.Command)
+	}
+	want := []string{
+		"base-model suggested: echo base-model",
+		"other-model suggested: echo other-model",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit log = %q, want %q", got, want)
+	}
+}
+
+func TestRunConcurrency(t *testing.T) {
+	srv, _, peak := llmServer(t, 50*time.Millisecond)
+	cfg := testConfig(t, srv.URL)
+	cfg.EnableCache = false
+
+	var lines []string
+	for i := 0; i < 8; i++ {
+		lines = append(lines, "query "+string(rune('a'+i)))
+	}
+	results, _ := run(t, cfg, strings.Join(lines, "\n"), Options{Concurrency: 2})
+
+	if got := atomic.LoadInt32(peak); got != 2 {
+		t.Errorf("peak concurrent requests = %d, want 2", got)
+	}
+	for i, r := range results {
+		if r.Query != lines[i] {
+			t.Errorf("result %d is for %q, want %q (input order)", i, r.Query, lines[i])
+		}
+	}
+}
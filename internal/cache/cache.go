@@ -6,14 +6,28 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/skymoore/vibe-zsh/internal/schema"
 )
 
 type Cache struct {
-	dir string
-	ttl time.Duration
+	dir   string
+	ttl   time.Duration
+	scope string
+
+	// index keeps entries already read, so a long-lived process (the
+	// daemon) answers repeat queries without reading and decoding the file.
+	// An entry is only used while its file is unchanged on disk, so writes
+	// and clears by other vibe processes are still seen.
+	mu    sync.Mutex
+	index map[string]indexed
+}
+
+type indexed struct {
+	entry   CacheEntry
+	modTime time.Time
 }
 
 type CacheEntry struct {
@@ -22,7 +36,10 @@ type CacheEntry struct {
 	Timestamp time.Time               `json:"timestamp"`
 }
 
-func New(cacheDir string, ttl time.Duration) (*Cache, error) {
+// New opens the cache in cacheDir. scope separates entries generated with
+// different settings (provider, model and so on): a query only hits entries
+// stored under the same scope.
+func New(cacheDir string, ttl time.Duration, scope string) (*Cache, error) {
 	if cacheDir == "" {
 		home, err := os.UserHomeDir()
 		if err != nil {
@@ -36,8 +53,10 @@ func New(cacheDir string, ttl time.Duration) (*Cache, error) {
 	}
 
 	return &Cache{
-		dir: cacheDir,
-		ttl: ttl,
+		dir:   cacheDir,
+		ttl:   ttl,
+		scope: scope,
+		index: make(map[string]indexed),
 	}, nil
 }
 
@@ -45,17 +64,13 @@ func (c *Cache) Get(query string) (*schema.CommandResponse, bool) {
 	key := c.hashQuery(query)
 	path := filepath.Join(c.dir, key+".json")
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, false
-	}
-
-	var entry CacheEntry
-	if err := json.Unmarshal(data, &entry); err != nil {
+	entry, ok := c.load(key, path)
+	if !ok {
 		return nil, false
 	}
 
 	if time.Since(entry.Timestamp) > c.ttl {
+		c.forget(key)
 		os.Remove(path)
 		return nil, false
 	}
@@ -63,6 +78,44 @@ func (c *Cache) Get(query string) (*schema.CommandResponse, bool) {
 	return entry.Response, true
 }
 
+// load returns the entry stored under key, from the index when its file
+// hasn't changed since it was read.
+func (c *Cache) load(key, path string) (CacheEntry, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		c.forget(key)
+		return CacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	cached, ok := c.index[key]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.entry, true
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CacheEntry{}, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return CacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	c.index[key] = indexed{entry: entry, modTime: info.ModTime()}
+	c.mu.Unlock()
+	return entry, true
+}
+
+func (c *Cache) forget(key string) {
+	c.mu.Lock()
+	delete(c.index, key)
+	c.mu.Unlock()
+}
+
 func (c *Cache) Set(query string, response *schema.CommandResponse) error {
 	key := c.hashQuery(query)
 	path := filepath.Join(c.dir, key+".json")
@@ -78,15 +131,28 @@ func (c *Cache) Set(query string, response *schema.CommandResponse) error {
 		return err
 	}
 
-	return os.WriteFile(path, data, 0644)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		c.mu.Lock()
+		c.index[key] = indexed{entry: entry, modTime: info.ModTime()}
+		c.mu.Unlock()
+	}
+	return nil
 }
 
 func (c *Cache) hashQuery(query string) string {
-	hash := sha256.Sum256([]byte(query))
+	hash := sha256.Sum256([]byte(c.scope + "\x00" + query))
 	return hex.EncodeToString(hash[:])
 }
 
 func (c *Cache) Clear() error {
+	c.mu.Lock()
+	c.index = make(map[string]indexed)
+	c.mu.Unlock()
+
 	entries, err := os.ReadDir(c.dir)
 	if err != nil {
 		return err
@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// TestIndexSeesOtherWriters checks that a long-lived cache notices entries
+// rewritten or removed by another process instead of serving its index.
+func TestIndexSeesOtherWriters(t *testing.T) {
+	dir := t.TempDir()
+	daemon, err := New(dir, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(dir, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := daemon.Set("list files", &schema.CommandResponse{Command: "ls"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, ok := daemon.Get("list files"); !ok || resp.Command != "ls" {
+		t.Fatalf("Get = %v, %v; want ls", resp, ok)
+	}
+
+	// Make sure the rewrite gets a different modification time.
+	time.Sleep(10 * time.Millisecond)
+	if err := other.Set("list files", &schema.CommandResponse{Command: "ls -la"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, ok := daemon.Get("list files"); !ok || resp.Command != "ls -la" {
+		t.Errorf("Get after another process rewrote the entry = %v, %v; want ls -la", resp, ok)
+	}
+
+	if err := other.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := daemon.Get("list files"); ok {
+		t.Error("Get after another process cleared the cache still hit")
+	}
+}
+
+func TestExpiredEntryIsRemoved(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, time.Millisecond, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set("list files", &schema.CommandResponse{Command: "ls"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("list files"); ok {
+		t.Error("Get returned an expired entry")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("expired entry still on disk: %v", files)
+	}
+}
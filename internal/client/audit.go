@@ -0,0 +1,67 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+)
+
+// Audit appends e to the audit log cfg names, filling in who and where. It
+// does nothing when there is no log or e has no command. The log is meant
+// as a complete record, so callers must not hand out a command it could not
+// record.
+func Audit(cfg *config.Config, e audit.Entry) error {
+	if cfg.AuditLog == "" || e.Command == "" {
+		return nil
+	}
+	log := audit.Open(cfg.AuditLog, audit.Options{
+		MaxSize: int64(cfg.AuditMaxSizeMB) << 20,
+		Keep:    cfg.AuditKeep,
+		Chain:   cfg.AuditHashChain,
+	})
+	e.User = currentUser()
+	e.Host, _ = os.Hostname()
+	e.Cwd, _ = os.Getwd()
+	if err := log.Append(e); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	return nil
+}
+
+// Suggest prepares g, generated for query, to be handed out by a front end
+// other than the shell (vibe serve, vibe batch): it applies pol and records
+// the command in the audit log as suggested, or blocked. It returns an
+// error wrapping apierrors.ErrPolicyBlocked for a blocked command, or the
+// audit log's error; either way the command must not be handed out.
+func (c *Client) Suggest(pol *policy.Policy, query string, g *Generation) error {
+	outcome := audit.Suggested
+	_, blocked := pol.Apply(g.Response)
+	if blocked != nil {
+		outcome = audit.Blocked
+	}
+
+	storedQuery, storedCommand := c.Scrub(query, g.Response.Command)
+	err := Audit(c.config, audit.Entry{
+		Query:       storedQuery,
+		Command:     storedCommand,
+		Provider:    g.Provider,
+		Model:       g.Model,
+		SafetyLevel: g.Response.SafetyLevel,
+		Outcome:     outcome,
+	})
+	if err != nil {
+		return err
+	}
+	return blocked
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
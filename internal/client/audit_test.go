@@ -0,0 +1,90 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/audit"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+)
+
+func readAudit(t *testing.T, path string) []audit.Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// TestSuggestRecordsAudit checks that commands handed out by vibe serve and
+// vibe batch are recorded with the model that generated them: an alias is
+// recorded as the model it stands for.
+func TestSuggestRecordsAudit(t *testing.T) {
+	t.Setenv("MYCORP_KEY", "corp-secret")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = "mycorp"
+	cfg.Model = "fast"
+	cfg.Providers = map[string]config.CustomProvider{
+		"mycorp": {
+			Name:    "mycorp",
+			BaseURL: srv.URL + "/v1",
+			Dialect: config.DialectOpenAI,
+			Auth:    config.CustomAuth{Scheme: "header", Header: "X-Corp-Key", APIKeyEnv: "MYCORP_KEY"},
+			Models:  map[string]string{"fast": "llama-3.1-8b-instruct"},
+		},
+	}
+	cfg.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+	c := New(cfg)
+
+	g, err := c.GenerateDetailed(context.Background(), "list files", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Suggest(nil, "list files", g); err != nil {
+		t.Fatalf("Suggest: %v", err)
+	}
+
+	pol, err := policy.Parse([]byte(`{"rules": [{"name": "no-ls", "command": "ls", "action": "block"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Suggest(pol, "list files", g); !errors.Is(err, apierrors.ErrPolicyBlocked) {
+		t.Errorf("Suggest with a blocking policy = %v, want ErrPolicyBlocked", err)
+	}
+
+	entries := readAudit(t, cfg.AuditLog)
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	for i, want := range []string{audit.Suggested, audit.Blocked} {
+		e := entries[i]
+		if e.Outcome != want || e.Command != "ls -la" || e.Provider != "mycorp" || e.Model != "llama-3.1-8b-instruct" {
+			t.Errorf("entry %d = %+v, want %s by mycorp's llama-3.1-8b-instruct", i, e, want)
+		}
+	}
+}
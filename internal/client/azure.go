@@ -0,0 +1,98 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+	gollmconfig "github.com/teilomillet/gollm/config"
+	"github.com/teilomillet/gollm/providers"
+)
+
+// azureOpenAIProvider talks to Azure OpenAI. Azure speaks the OpenAI chat
+// dialect, so it wraps gollm's vllm provider like authedOpenAIProvider does,
+// but requests go to a per-deployment URL and authenticate with an api-key
+// header.
+type azureOpenAIProvider struct {
+	providers.Provider
+	apiKey   string
+	endpoint string // Full chat completions URL, including api-version
+}
+
+func (p *azureOpenAIProvider) Name() string {
+	return config.ProviderAzureOpenAI
+}
+
+// SetDefaultOptions applies gollm's defaults and picks up the deployment URL.
+// gollm only hands provider constructors an API key, so newLLM passes the URL
+// through the vLLM endpoint option.
+func (p *azureOpenAIProvider) SetDefaultOptions(cfg *gollmconfig.Config) {
+	p.Provider.SetDefaultOptions(cfg)
+	p.endpoint = cfg.VLLMEndpoint
+}
+
+// Endpoint returns the deployment URL as is. The embedded vllm provider would
+// append /v1/chat/completions to it.
+func (p *azureOpenAIProvider) Endpoint() string {
+	return p.endpoint
+}
+
+func (p *azureOpenAIProvider) Headers() map[string]string {
+	headers := p.Provider.Headers()
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["api-key"] = p.apiKey
+	return headers
+}
+
+var registerAzureOpenAIOnce sync.Once
+
+// registerAzureOpenAIProvider registers the azure-openai provider on gollm's
+// default registry, replacing gollm's own entry, which cannot be given a
+// deployment URL. It is safe to call multiple times.
+func registerAzureOpenAIProvider() {
+	registerAzureOpenAIOnce.Do(func() {
+		providers.GetDefaultRegistry().Register(
+			config.ProviderAzureOpenAI,
+			func(apiKey, model string, extraHeaders map[string]string) providers.Provider {
+				base := providers.NewVLLMProvider(apiKey, model, extraHeaders)
+				return &azureOpenAIProvider{Provider: base, apiKey: apiKey}
+			},
+		)
+	})
+}
+
+// azureEndpoint builds the chat completions URL for the configured
+// deployment:
+//
+//	https://{resource}.openai.azure.com/openai/deployments/{deployment}/chat/completions?api-version={version}
+//
+// VIBE_AZURE_RESOURCE names the resource; without it the scheme and host of
+// VIBE_API_URL are used, which also covers custom domains and API gateways in
+// front of Azure. The deployment defaults to VIBE_MODEL.
+func azureEndpoint(cfg *config.Config) (string, error) {
+	var base string
+	switch {
+	case cfg.AzureResource != "":
+		base = "https://" + cfg.AzureResource + ".openai.azure.com"
+	case cfg.APIURL != "" && cfg.APIURL != config.DefaultAPIURL:
+		u, err := url.Parse(cfg.APIURL)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid VIBE_API_URL %q for azure-openai", cfg.APIURL)
+		}
+		base = u.Scheme + "://" + u.Host
+	default:
+		return "", fmt.Errorf("azure-openai requires VIBE_AZURE_RESOURCE or VIBE_API_URL (https://<resource>.openai.azure.com)")
+	}
+
+	deployment := cfg.AzureDeployment
+	if deployment == "" {
+		deployment = cfg.Model
+	}
+
+	return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimSuffix(base, "/"), url.PathEscape(deployment), url.QueryEscape(cfg.AzureAPIVersion)), nil
+}
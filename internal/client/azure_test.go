@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+func TestAzureEndpoint(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  config.Config
+		want string
+	}{
+		{
+			"resource",
+			config.Config{AzureResource: "contoso", AzureDeployment: "gpt-4o", AzureAPIVersion: "2024-10-21", APIURL: config.DefaultAPIURL},
+			"https://contoso.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21",
+		},
+		{
+			"deployment defaults to model",
+			config.Config{AzureResource: "contoso", Model: "gpt-4o-mini", AzureAPIVersion: "2024-10-21"},
+			"https://contoso.openai.azure.com/openai/deployments/gpt-4o-mini/chat/completions?api-version=2024-10-21",
+		},
+		{
+			"api url host",
+			config.Config{APIURL: "https://gateway.corp.example/openai", AzureDeployment: "gpt-4o", AzureAPIVersion: "2024-10-21"},
+			"https://gateway.corp.example/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21",
+		},
+	}
+	for _, c := range cases {
+		got, err := azureEndpoint(&c.cfg)
+		if err != nil {
+			t.Errorf("%s: azureEndpoint returned error: %v", c.name, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: azureEndpoint = %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := azureEndpoint(&config.Config{APIURL: config.DefaultAPIURL}); err == nil {
+		t.Error("azureEndpoint without a resource or URL succeeded, want an error")
+	}
+}
+
+func TestAzureOpenAIProviderRequest(t *testing.T) {
+	const key = "0123456789abcdef0123456789abcdef"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-deployment/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("api-version"); got != "2024-10-21" {
+			t.Errorf("api-version = %q, want 2024-10-21", got)
+		}
+		if got := r.Header.Get("api-key"); got != key {
+			t.Errorf("api-key header = %q, want the API key", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = config.ProviderAzureOpenAI
+	cfg.APIKey = key
+	cfg.AzureDeployment = "my-deployment"
+	cfg.AzureAPIVersion = "2024-10-21"
+
+	resp, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+}
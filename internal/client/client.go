@@ -3,71 +3,163 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/skymoore/vibe-zsh/internal/auth"
 	"github.com/skymoore/vibe-zsh/internal/cache"
 	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
 	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/models"
 	"github.com/skymoore/vibe-zsh/internal/parser"
+	"github.com/skymoore/vibe-zsh/internal/placeholder"
 	"github.com/skymoore/vibe-zsh/internal/progress"
+	"github.com/skymoore/vibe-zsh/internal/redact"
+	"github.com/skymoore/vibe-zsh/internal/retry"
+	"github.com/skymoore/vibe-zsh/internal/safety"
 	"github.com/skymoore/vibe-zsh/internal/schema"
+	"github.com/skymoore/vibe-zsh/internal/transport"
 	"github.com/teilomillet/gollm"
 )
 
 // Client wraps a gollm LLM instance and the vibe response-parsing pipeline.
-// All provider-specific transport, auth, and retry logic is handled by gollm;
-// this layer is responsible only for prompt construction, the multi-strategy
-// JSON parsing fallback, and caching.
+// Provider-specific transport and auth are handled by gollm; this layer is
+// responsible for prompt construction, the multi-strategy JSON parsing
+// fallback, caching, and the single retry policy shared by every layer.
 type Client struct {
-	config  *config.Config
+	config   *config.Config
+	cache    *cache.Cache
+	redactor *redact.Redactor // nil when VIBE_REDACT is off
+
+	// The LLM is built on first use (see provider), so answering from the
+	// cache never constructs it. gollm may contact the server while
+	// constructing a provider (Ollama's validation does).
+	llmOnce sync.Once
 	llm     gollm.LLM
 	initErr error
-	cache   *cache.Cache
+	auth    *auth.Authenticator // openai-compatible and custom providers only
 }
 
-// New constructs a Client. It builds the underlying gollm LLM from the
-// resolved configuration (provider, model, key, generation params). If the
-// LLM cannot be constructed, a Client with a nil llm is returned and the
-// construction error is surfaced on the first GenerateCommand call.
+// New constructs a Client. It only opens the response cache; the underlying
+// gollm LLM is built from the resolved configuration (provider, model, key,
+// generation params) the first time a query misses the cache. If the LLM
+// cannot be constructed, the error is surfaced on that call.
 func New(cfg *config.Config) *Client {
 	client := &Client{config: cfg}
 
-	llm, err := newLLM(cfg)
-	if err != nil {
-		client.initErr = err
-		logger.Debug("Failed to initialize LLM provider: %v", err)
-	} else {
-		client.llm = llm
-	}
-
 	if cfg.EnableCache {
-		if c, err := cache.New(cfg.CacheDir, cfg.CacheTTL); err == nil {
+		if c, err := cache.New(cfg.CacheDir, cfg.CacheTTL, cacheScope(cfg)); err == nil {
 			client.cache = c
 		}
 	}
 
+	client.redactor = Redactor(cfg)
+
 	return client
 }
 
+// cacheScope identifies the settings that decide what the provider answers,
+// so a query asked of one model is never answered from another's entry.
+func cacheScope(cfg *config.Config) string {
+	return fmt.Sprintf("%s|%s|%s|%g|%d", cfg.Provider, cfg.APIURL, cfg.ResolvedModel(), cfg.Temperature, cfg.MaxTokens)
+}
+
+// Redactor returns the redactor cfg asks for, or nil when VIBE_REDACT is
+// off.
+func Redactor(cfg *config.Config) *redact.Redactor {
+	if !cfg.Redact {
+		return nil
+	}
+	r, err := redact.New(cfg.RedactPatterns)
+	if err != nil {
+		// The config file's patterns are checked when it is loaded; the
+		// built-in detectors still apply.
+		logger.Debug("Ignoring redact patterns: %v", err)
+		r, _ = redact.New(nil)
+	}
+	return r
+}
+
+// Scrub returns query and command with the secrets in query replaced by
+// placeholders, for storing them (in the history, say).
+func (c *Client) Scrub(query, command string) (string, string) {
+	return c.redactor.Scrub(query, command)
+}
+
+// provider builds the LLM and its authenticator on first use and returns the
+// LLM, or nil if it could not be constructed (see initErr).
+func (c *Client) provider() gollm.LLM {
+	c.llmOnce.Do(func() {
+		cfg := c.config
+
+		var err error
+		if def, ok := cfg.CustomProvider(); ok {
+			c.auth, err = newCustomAuthenticator(cfg, def)
+		} else if cfg.Provider == config.ProviderOpenAICompatible {
+			c.auth, err = newAuthenticator(cfg)
+		}
+
+		var llm gollm.LLM
+		if err == nil {
+			llm, err = newLLM(cfg, c.auth)
+		}
+		if err != nil {
+			c.initErr = err
+			logger.Debug("Failed to initialize LLM provider: %v", err)
+			return
+		}
+		c.llm = llm
+	})
+	return c.llm
+}
+
+// gollmPlaceholderKey is handed to gollm for the openai-compatible and custom
+// providers.
+// gollm insists on a key longer than 20 characters for providers it doesn't
+// know, but the real credentials (which may not be a key at all) are applied
+// by the authenticator.
+const gollmPlaceholderKey = "vibe-credentials-set-by-authenticator"
+
 // newLLM translates the vibe Config into gollm options and builds the LLM.
-func newLLM(cfg *config.Config) (gollm.LLM, error) {
+// authenticator is used by the openai-compatible and custom providers and may
+// be nil for every other provider.
+func newLLM(cfg *config.Config, authenticator *auth.Authenticator) (gollm.LLM, error) {
 	opts := []gollm.ConfigOption{
 		gollm.SetProvider(cfg.Provider),
-		gollm.SetModel(cfg.Model),
+		gollm.SetModel(cfg.ResolvedModel()),
 		gollm.SetTemperature(cfg.Temperature),
 		gollm.SetMaxTokens(cfg.MaxTokens),
 		gollm.SetTimeout(cfg.Timeout),
-		gollm.SetMaxRetries(cfg.MaxRetries),
-		gollm.SetRetryDelay(1 * time.Second),
+		// Retries are driven by vibe's own policy (see generate) so that one
+		// budget covers every parsing layer. Letting gollm retry as well would
+		// multiply the number of requests per query.
+		gollm.SetMaxRetries(0),
 		gollm.SetLogLevel(logLevel(cfg)),
 	}
 
+	transport.Install()
+
 	if cfg.APIKey != "" {
 		opts = append(opts, gollm.SetAPIKey(cfg.APIKey))
 	}
 
+	registerCustomProviders(cfg.Providers)
+	if _, ok := cfg.CustomProvider(); ok {
+		// The endpoint and credentials come from the config file; see
+		// customProvider.
+		opts = append(opts, gollm.SetAPIKey(gollmPlaceholderKey))
+		return withProviderAuth(authenticator, func() (gollm.LLM, error) {
+			return gollm.NewLLM(opts...)
+		})
+	}
+
 	// Local providers reach a user-configured endpoint rather than a fixed
 	// hosted URL. Pass VIBE_API_URL through so custom ports/hosts work.
 	switch cfg.Provider {
@@ -81,25 +173,64 @@ func newLLM(cfg *config.Config) (gollm.LLM, error) {
 		if cfg.APIURL != "" {
 			opts = append(opts, gollm.SetVLLMEndpoint(cfg.APIURL))
 		}
+	case config.ProviderLlamaCpp:
+		// llama-server needs no key unless started with --api-key, in which
+		// case it expects a Bearer token.
+		registerLlamaCppProvider()
+		a, err := auth.New(auth.Config{Scheme: auth.SchemeBearer, APIKey: cfg.APIKey})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, gollm.SetAPIKey(gollmPlaceholderKey))
+		if cfg.APIURL != "" {
+			opts = append(opts, gollm.SetVLLMEndpoint(cfg.APIURL))
+		}
+		llm, err := withProviderAuth(a, func() (gollm.LLM, error) {
+			return gollm.NewLLM(opts...)
+		})
+		if err == nil && cfg.UseStructuredOutput {
+			// Constrain every completion to the response schema, so the
+			// output is valid JSON by construction.
+			llm.SetOption(jsonSchemaOption, schema.GetJSONSchema())
+		}
+		return llm, err
+	case config.ProviderAzureOpenAI:
+		endpoint, err := azureEndpoint(cfg)
+		if err != nil {
+			return nil, err
+		}
+		registerAzureOpenAIProvider()
+		opts = append(opts, gollm.SetVLLMEndpoint(endpoint))
 	case config.ProviderOpenAICompatible:
-		// An OpenAI-compatible gateway that DOES require a Bearer token.
+		// An OpenAI-compatible gateway that DOES require authentication.
 		// We reuse gollm's vllm transport (OpenAI dialect + user endpoint)
-		// but wrap it with a provider that adds Authorization. The endpoint
-		// is read from cfg.VLLMEndpoint by the underlying vllm provider.
+		// but wrap it with a provider that adds the configured auth headers
+		// (VIBE_AUTH_SCHEME). The endpoint is read from cfg.VLLMEndpoint by
+		// the underlying vllm provider.
 		registerOpenAICompatibleProvider()
+		opts = append(opts, gollm.SetAPIKey(gollmPlaceholderKey))
 		if cfg.APIURL != "" {
 			opts = append(opts, gollm.SetVLLMEndpoint(cfg.APIURL))
 		}
+		return withProviderAuth(authenticator, func() (gollm.LLM, error) {
+			return gollm.NewLLM(opts...)
+		})
 	}
 
-	return gollm.NewLLM(opts...)
+	llm, err := gollm.NewLLM(opts...)
+	if err == nil && cfg.Provider == "ollama" && cfg.KeepAlive != "" {
+		// Ollama merges options into the request body. Sending keep_alive
+		// with every query keeps the model loaded between queries.
+		llm.SetOption("keep_alive", cfg.KeepAlive)
+	}
+	return llm, err
 }
 
 // isLocalProvider reports whether the provider runs locally and does not
 // require API-key authentication.
 func isLocalProvider(provider string) bool {
 	switch provider {
-	case "ollama", "lmstudio", "vllm":
+	case "ollama", "lmstudio", "vllm", config.ProviderLlamaCpp:
 		return true
 	default:
 		return false
@@ -136,13 +267,53 @@ func ollamaEndpoint(apiURL string) string {
 	return u
 }
 
-// generate runs a single completion through gollm and returns the raw text
-// content. temperature lets individual strategies tune sampling (e.g. the
-// explicit-JSON retry lowers it). Provider transport and retries are handled
-// inside gollm.
-func (c *Client) generate(ctx context.Context, systemPrompt, query string, temperature float64) (string, error) {
-	if c.llm == nil {
-		return "", c.notConfiguredError()
+// run holds the state of a single GenerateCommand invocation. Every parsing
+// layer draws from the same retry budget, so the total number of requests is
+// bounded by VIBE_MAX_RETRIES no matter which layer fails.
+type run struct {
+	budget      *retry.Budget
+	status      Status // nil when progress is not shown
+	recorder    *transport.Recorder
+	showStatus  bool   // VIBE_SHOW_RETRY_STATUS
+	lastFailure string // Why the previous attempt failed, for status display
+
+	reauthenticated bool // An OAuth2 token was already refreshed after a 401
+	loadingModel    bool // The next request has to wait for the model to load
+}
+
+// fatalError marks a failure that no later parsing layer can recover from
+// (authentication, exhausted budget, deadline), so GenerateCommand stops
+// instead of issuing more requests.
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+func isFatal(err error) bool {
+	var fatal *fatalError
+	return errors.As(err, &fatal)
+}
+
+// isProviderFailure reports whether err means the provider could not be used
+// at all, as opposed to the retry budget running out on unparseable responses.
+func isProviderFailure(err error) bool {
+	if !isFatal(err) {
+		return false
+	}
+	return apierrors.ExitCode(err) != apierrors.ExitFailure || !errors.Is(err, retry.ErrBudgetExhausted)
+}
+
+// generate runs a completion through gollm and returns the raw text content.
+// temperature lets individual strategies tune sampling (e.g. the explicit-JSON
+// retry lowers it). Transient failures (timeouts, 429, 5xx) are retried here
+// with backoff, honoring Retry-After, until the run's budget or the overall
+// deadline is exhausted.
+func (c *Client) generate(ctx context.Context, r *run, systemPrompt, query string, temperature float64) (string, error) {
+	llm := c.provider()
+	if llm == nil {
+		return "", &fatalError{c.notConfiguredError()}
 	}
 
 	prompt := gollm.NewPrompt(
@@ -152,107 +323,359 @@ func (c *Client) generate(ctx context.Context, systemPrompt, query string, tempe
 
 	// gollm exposes generation parameters as provider options rather than
 	// per-call GenerateOptions, so set temperature on the instance before the
-	// call. vibe runs a single sequential request per invocation, so mutating
-	// the shared option here is safe.
-	c.llm.SetOption("temperature", temperature)
+	// call. GenerateCommand calls never overlap (the daemon serializes them),
+	// so mutating the shared option here is safe.
+	llm.SetOption("temperature", temperature)
+
+	var lastErr error
+	for {
+		if err := r.budget.Take(); err != nil {
+			if lastErr != nil {
+				return "", &fatalError{fmt.Errorf("%w after %d attempts: %w", err, r.budget.Used(), lastErr)}
+			}
+			return "", &fatalError{err}
+		}
+
+		if c.auth != nil {
+			if err := c.auth.Prepare(ctx); err != nil {
+				return "", &fatalError{fmt.Errorf("%w: %v", apierrors.ErrUnauthorized, err)}
+			}
+		}
+
+		if r.loadingModel {
+			r.progress("Loading model...")
+		}
+
+		r.recorder.Reset()
+		content, err := llm.Generate(ctx, prompt)
+		r.loadingModel = false
+		if err == nil {
+			if strings.TrimSpace(content) != "" {
+				return content, nil
+			}
+			r.failed("empty response")
+			return "", fmt.Errorf("%w from provider %q", apierrors.ErrEmptyResponse, c.config.Provider)
+		}
+
+		if ctxErr := c.deadlineError(ctx); ctxErr != nil {
+			return "", &fatalError{ctxErr}
+		}
+
+		reqErr, retryAfter := requestError(err, r.recorder)
+		lastErr = reqErr
+		logger.Debug("Request error: %v", reqErr)
+		r.failed(retryReason(reqErr))
+
+		// An OAuth2 token can be revoked before its expiry; fetch a new one
+		// once before giving up on authentication.
+		if errors.Is(reqErr, apierrors.ErrUnauthorized) && c.auth != nil && c.auth.Refreshable() &&
+			!r.reauthenticated && r.budget.Remaining() > 0 {
+			r.reauthenticated = true
+			c.auth.Invalidate()
+			continue
+		}
+
+		if !apierrors.IsRetryable(reqErr) {
+			if errors.Is(reqErr, apierrors.ErrInvalidJSON) {
+				return "", reqErr
+			}
+			return "", &fatalError{reqErr}
+		}
+		if r.budget.Remaining() == 0 {
+			return "", &fatalError{fmt.Errorf("giving up after %d attempts: %w", r.budget.Used(), reqErr)}
+		}
+
+		if err := c.backoff(ctx, r, retryAfter); err != nil {
+			if errors.Is(err, retry.ErrDeadlineTooClose) {
+				return "", &fatalError{fmt.Errorf("%w (VIBE_DEADLINE=%s): %w", err, c.config.Deadline, reqErr)}
+			}
+			return "", &fatalError{err}
+		}
+	}
+}
+
+// coldCheckTimeout bounds the loaded-model check so it never noticeably
+// delays a query.
+const coldCheckTimeout = 500 * time.Millisecond
 
-	content, err := c.llm.Generate(ctx, prompt)
+// modelIsCold reports whether the first request will have to wait for Ollama
+// to load the model, so the spinner can say so instead of appearing to hang.
+// Any failure to tell counts as warm.
+func (c *Client) modelIsCold(ctx context.Context) bool {
+	if c.config.Provider != "ollama" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, coldCheckTimeout)
+	defer cancel()
+
+	loaded, err := models.Loaded(ctx, c.config, c.config.Model)
 	if err != nil {
-		return "", err
+		logger.Debug("Could not check whether %s is loaded: %v", c.config.Model, err)
+		return false
+	}
+	return !loaded
+}
+
+// backoff waits before the next attempt, counting down on the spinner.
+func (c *Client) backoff(ctx context.Context, r *run, retryAfter time.Duration) error {
+	delay := r.budget.Policy().Delay(r.budget.Used(), retryAfter)
+	logger.Debug("Retrying in %s", delay)
+	return retry.Wait(ctx, delay, r.waiting)
+}
+
+// deadlineError reports why ctx is done, naming VIBE_DEADLINE when the overall
+// deadline is the cause. It returns nil while ctx is still live.
+func (c *Client) deadlineError(ctx context.Context) error {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return fmt.Errorf("no command within VIBE_DEADLINE=%s: %w", c.config.Deadline, apierrors.ErrTimeout)
+	default:
+		return ctx.Err()
 	}
+}
 
-	if strings.TrimSpace(content) == "" {
-		return "", fmt.Errorf("empty response from provider %q", c.config.Provider)
+// requestError turns a failed gollm call into an error from the errors
+// package, using the outcome the transport recorded. gollm itself only reports
+// "failed to generate after N attempts", dropping the status code and cause.
+// The returned duration is the server's Retry-After, if it sent one.
+func requestError(err error, rec *transport.Recorder) (error, time.Duration) {
+	o, ok := rec.Last()
+	if !ok {
+		// The request was never sent (e.g. it could not be prepared).
+		return err, 0
+	}
+
+	switch {
+	case o.Err != nil:
+		var netErr net.Error
+		var dnsErr *net.DNSError
+		switch {
+		case errors.Is(o.Err, context.DeadlineExceeded) || (errors.As(o.Err, &netErr) && netErr.Timeout()):
+			return fmt.Errorf("%w: %v", apierrors.ErrTimeout, o.Err), 0
+		case errors.Is(o.Err, syscall.ECONNREFUSED) || errors.As(o.Err, &dnsErr):
+			return fmt.Errorf("%w: %v", apierrors.ErrConnectionRefused, o.Err), 0
+		default:
+			return fmt.Errorf("%w: %v", apierrors.ErrNoResponse, o.Err), 0
+		}
+	case o.StatusCode != http.StatusOK:
+		return apierrors.NewAPIError(o.StatusCode, o.Body), o.RetryAfter
+	default:
+		// A 200 response gollm could not parse.
+		return fmt.Errorf("%w: %v", apierrors.ErrInvalidJSON, err), 0
 	}
+}
 
-	return content, nil
+// Status receives the progress of a GenerateCommand call. *progress.Spinner
+// implements it; the daemon forwards the messages to the waiting CLI.
+type Status interface {
+	Start(ctx context.Context, message string)
+	Update(message string)
+	Stop()
 }
 
+// GenerateCommand turns query into a command, showing progress on a spinner
+// when enabled and stderr is a terminal.
 func (c *Client) GenerateCommand(ctx context.Context, query string) (*schema.CommandResponse, error) {
-	// Initialize spinner if progress is enabled and stderr is a terminal
-	var spinner *progress.Spinner
 	if c.config.ShowProgress && progress.IsStderrTerminal() {
-		spinner = progress.NewSpinner(c.config.ProgressStyle)
-		defer spinner.Stop()
+		return c.GenerateCommandWithStatus(ctx, query, progress.NewSpinner(c.config.ProgressStyle))
 	}
+	return c.GenerateCommandWithStatus(ctx, query, nil)
+}
 
-	// Check cache first
-	if spinner != nil {
-		spinner.Start(ctx, "Checking cache...")
+// GenerateCommandWithStatus is GenerateCommand reporting progress to status,
+// which may be nil. Calls must not overlap: the LLM's generation options are
+// set per call.
+func (c *Client) GenerateCommandWithStatus(ctx context.Context, query string, status Status) (*schema.CommandResponse, error) {
+	g, err := c.GenerateDetailed(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	return g.Response, nil
+}
+
+// Layers that can produce a response, as reported in Generation.Layer.
+const (
+	LayerCache            = "cache"
+	LayerStructuredOutput = "structured_output"
+	LayerEnhancedParsing  = "enhanced_parsing"
+	LayerExplicitJSON     = "explicit_json_prompt"
+	LayerFallback         = "emergency_fallback"
+	LayerSyntaxRepair     = "syntax_repair" // The model fixed a command that didn't parse
+)
+
+// Generation is a response together with how it was produced.
+type Generation struct {
+	Response *schema.CommandResponse
+	Layer    string // One of the Layer constants
+	Attempts int    // Requests sent to the provider; 0 for a cache hit
+	Redacted int    // Secrets hidden from the provider and put back into the command
+	Provider string // The provider and model that generated the response
+	Model    string
+}
+
+// GenerateDetailed is GenerateCommandWithStatus also reporting which layer
+// produced the response and how many requests it took.
+//
+// Secrets in query are replaced by placeholders before it is sent, cached or
+// logged; only the returned command has the real values.
+func (c *Client) GenerateDetailed(ctx context.Context, query string, status Status) (*Generation, error) {
+	query, secrets := c.redactor.Redact(query)
+	if secrets.Len() > 0 {
+		logger.Debug("Redacted %d secrets from the query", secrets.Len())
+	}
+
+	if status != nil {
+		defer status.Stop()
+		status.Start(ctx, "Checking cache...")
 	}
 
 	if c.cache != nil {
 		if cached, ok := c.cache.Get(query); ok {
 			// Cache hit - stop spinner immediately
-			if spinner != nil {
-				spinner.Stop()
+			if status != nil {
+				status.Stop()
 			}
-			return cached, nil
+			annotate(cached)
+			return c.restore(&Generation{Response: cached, Layer: LayerCache}, secrets), nil
 		}
 	}
 
+	// One deadline bounds the whole call, across every layer and retry.
+	if c.config.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Deadline)
+		defer cancel()
+	}
+
+	ctx, recorder := transport.WithRecorder(ctx)
+	r := &run{
+		budget:     retry.NewPolicy(c.config.MaxRetries).NewBudget(),
+		status:     status,
+		recorder:   recorder,
+		showStatus: c.config.ShowRetryStatus,
+	}
+
 	// Update spinner for API call
-	if spinner != nil {
-		spinner.Update("Contacting API...")
+	if status != nil {
+		status.Update("Contacting API...")
+		r.loadingModel = c.modelIsCold(ctx)
+	}
+
+	resp, layer, err := c.generateWithLayers(ctx, r, query)
+	if err == nil {
+		// A command that is still broken after repair isn't cached, so
+		// asking again gets a fresh attempt.
+		resp, layer, valid := c.repairSyntax(ctx, r, query, resp, layer)
+		annotate(resp)
+		if valid {
+			c.cacheIfEnabled(query, resp)
+		}
+		return c.restore(&Generation{Response: resp, Layer: layer, Attempts: r.budget.Used()}, secrets), nil
 	}
 
+	// A provider failure (auth, unreachable server, deadline, ...) is
+	// returned as is so the caller can explain it and exit with a matching
+	// code. Only failures to parse what the model said fall back.
+	if isProviderFailure(err) {
+		return nil, err
+	}
+
+	r.progress("Using fallback...")
+
+	// Pass the last error to the fallback so it can provide better feedback
+	resp, fallbackErr := c.generateWithEmergencyFallback(ctx, r, err)
+	if fallbackErr == nil {
+		logger.LogLayerSuccess(LayerFallback, 4)
+		annotate(resp)
+		return c.restore(&Generation{Response: resp, Layer: LayerFallback, Attempts: r.budget.Used()}, secrets), nil
+	}
+	logger.LogParsingFailure(4, LayerFallback, "", fallbackErr)
+
+	return nil, fmt.Errorf("all parsing strategies failed: %w", err)
+}
+
+// annotate adds what vibe works out locally to a response: the safety
+// analysis, and the placeholders left for the user to fill in, whether the
+// model declared them or not.
+func annotate(resp *schema.CommandResponse) {
+	resp.Placeholders = placeholder.Tokens(placeholder.Detect(resp.Command, resp.Placeholders))
+	safety.Apply(resp)
+}
+
+// restore puts the secrets hidden from the provider back into the command
+// and records which provider and model generated it. The response is
+// copied, since the cache keeps the one with placeholders.
+func (c *Client) restore(g *Generation, secrets *redact.Secrets) *Generation {
+	g.Provider, g.Model = c.generatedBy()
+	if secrets.Len() == 0 {
+		return g
+	}
+	resp := *g.Response
+	resp.Command = secrets.Restore(resp.Command)
+	g.Response = &resp
+	g.Redacted = secrets.Len()
+	return g
+}
+
+// generatedBy returns the provider and model answering queries: the model
+// the LLM was built with once it has been, or else the configured one, which
+// the cache keys its entries by.
+func (c *Client) generatedBy() (string, string) {
+	model := c.config.ResolvedModel()
+	if c.llm != nil && c.llm.GetModel() != "" {
+		model = c.llm.GetModel()
+	}
+	return c.config.Provider, model
+}
+
+// generateWithLayers runs parsing layers 1-3 in order and reports which one
+// succeeded. It stops early when a layer fails in a way later layers cannot
+// fix (see fatalError).
+func (c *Client) generateWithLayers(ctx context.Context, r *run, query string) (*schema.CommandResponse, string, error) {
 	var resp *schema.CommandResponse
 	var err error
 
 	if c.config.UseStructuredOutput {
-		if spinner != nil {
-			spinner.Update("Generating command...")
-		}
-		resp, err = c.generateWithStructuredOutput(ctx, query)
+		r.progress("Generating command...")
+		resp, err = c.generateWithStructuredOutput(ctx, r, query)
 		if err == nil && c.config.StrictValidation {
 			if validErr := resp.Validate(); validErr == nil {
-				c.cacheIfEnabled(query, resp)
-				logger.LogLayerSuccess("structured_output", 1)
-				return resp, nil
+				logger.LogLayerSuccess(LayerStructuredOutput, 1)
+				return resp, LayerStructuredOutput, nil
 			}
+			r.failed(reasonIncomplete)
 		} else if err == nil {
-			c.cacheIfEnabled(query, resp)
-			logger.LogLayerSuccess("structured_output", 1)
-			return resp, nil
+			logger.LogLayerSuccess(LayerStructuredOutput, 1)
+			return resp, LayerStructuredOutput, nil
+		}
+		logger.LogParsingFailure(1, LayerStructuredOutput, "", err)
+		if isFatal(err) {
+			return nil, "", err
 		}
-		logger.LogParsingFailure(1, "structured_output", "", err)
-	}
-
-	if spinner != nil {
-		spinner.Update("Parsing response...")
-	}
-	resp, err = c.generateWithEnhancedParsing(ctx, query, spinner)
-	if err == nil {
-		c.cacheIfEnabled(query, resp)
-		logger.LogLayerSuccess("enhanced_parsing", 2)
-		return resp, nil
 	}
-	logger.LogParsingFailure(2, "enhanced_parsing", "", err)
 
-	if spinner != nil {
-		spinner.Update("Retrying with explicit JSON...")
-	}
-	resp, err = c.generateWithExplicitJSONPrompt(ctx, query)
+	r.progress("Parsing response...")
+	resp, err = c.generateWithEnhancedParsing(ctx, r, query)
 	if err == nil {
-		c.cacheIfEnabled(query, resp)
-		logger.LogLayerSuccess("explicit_json_prompt", 3)
-		return resp, nil
+		logger.LogLayerSuccess(LayerEnhancedParsing, 2)
+		return resp, LayerEnhancedParsing, nil
 	}
-	logger.LogParsingFailure(3, "explicit_json_prompt", "", err)
-
-	if spinner != nil {
-		spinner.Update("Using fallback...")
+	logger.LogParsingFailure(2, LayerEnhancedParsing, "", err)
+	if isFatal(err) {
+		return nil, "", err
 	}
 
-	// Pass the last error to the fallback so it can provide better feedback
-	resp, fallbackErr := c.generateWithEmergencyFallback(ctx, query, err)
-	if fallbackErr == nil {
-		logger.LogLayerSuccess("emergency_fallback", 4)
-		return resp, nil
+	r.progress("Retrying with explicit JSON...")
+	resp, err = c.generateWithExplicitJSONPrompt(ctx, r, query)
+	if err == nil {
+		logger.LogLayerSuccess(LayerExplicitJSON, 3)
+		return resp, LayerExplicitJSON, nil
 	}
-	logger.LogParsingFailure(4, "emergency_fallback", "", fallbackErr)
+	logger.LogParsingFailure(3, LayerExplicitJSON, "", err)
 
-	return nil, fmt.Errorf("all parsing strategies failed: %w", err)
+	return nil, "", err
 }
 
 func (c *Client) cacheIfEnabled(query string, resp *schema.CommandResponse) {
@@ -263,32 +686,42 @@ func (c *Client) cacheIfEnabled(query string, resp *schema.CommandResponse) {
 	}
 }
 
-func (c *Client) generateWithStructuredOutput(ctx context.Context, query string) (*schema.CommandResponse, error) {
-	content, err := c.generate(ctx, schema.GetSystemPrompt(c.config.OSName, c.config.Shell), query, c.config.Temperature)
+func (c *Client) generateWithStructuredOutput(ctx context.Context, r *run, query string) (*schema.CommandResponse, error) {
+	content, err := c.generate(ctx, r, schema.GetSystemPrompt(c.config.OSName, c.config.Shell), query, c.config.Temperature)
 	if err != nil {
 		return nil, err
 	}
 
 	var cmdResp schema.CommandResponse
 	if err := json.Unmarshal([]byte(content), &cmdResp); err != nil {
+		r.failed(reasonInvalidJSON)
 		return nil, fmt.Errorf("failed to parse JSON content: %w", err)
 	}
 
 	return &cmdResp, nil
 }
 
-func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string, spinner *progress.Spinner) (*schema.CommandResponse, error) {
+func (c *Client) generateWithEnhancedParsing(ctx context.Context, r *run, query string) (*schema.CommandResponse, error) {
 	var lastErr error
 
-	for attempt := 1; attempt <= c.config.MaxRetries; attempt++ {
-		if spinner != nil && c.config.MaxRetries > 1 {
-			spinner.Update(fmt.Sprintf("Parsing response (attempt %d/%d)...", attempt, c.config.MaxRetries))
+	for attempt := 1; r.budget.Remaining() > 0; attempt++ {
+		// Once this layer has had a go, leave the final attempt for the
+		// explicit-JSON layer, which uses a stricter prompt.
+		if attempt > 1 && r.budget.Remaining() == 1 {
+			break
 		}
 
-		content, err := c.generate(ctx, schema.GetSystemPrompt(c.config.OSName, c.config.Shell), query, c.config.Temperature)
+		if attempt > 1 {
+			r.progress("Parsing response...")
+		}
+
+		content, err := c.generate(ctx, r, schema.GetSystemPrompt(c.config.OSName, c.config.Shell), query, c.config.Temperature)
 		if err != nil {
 			lastErr = fmt.Errorf("attempt %d: request failed: %w", attempt, err)
 			logger.LogParsingFailure(attempt, "enhanced_parsing_request", "", lastErr)
+			if isFatal(err) {
+				return nil, lastErr
+			}
 			continue
 		}
 
@@ -297,6 +730,7 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 			if err != nil {
 				lastErr = fmt.Errorf("attempt %d: JSON extraction failed: %w", attempt, err)
 				logger.LogParsingFailure(attempt, "enhanced_parsing_extraction", content, lastErr)
+				r.failed(reasonInvalidJSON)
 				continue
 			}
 
@@ -304,6 +738,7 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 			if err := json.Unmarshal([]byte(cleanedJSON), &cmdResp); err != nil {
 				lastErr = fmt.Errorf("attempt %d: unmarshal failed: %w", attempt, err)
 				logger.LogParsingFailure(attempt, "enhanced_parsing_unmarshal", cleanedJSON, lastErr)
+				r.failed(reasonInvalidJSON)
 				continue
 			}
 
@@ -311,6 +746,7 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 				if err := cmdResp.Validate(); err != nil {
 					lastErr = fmt.Errorf("attempt %d: validation failed: %w", attempt, err)
 					logger.LogParsingFailure(attempt, "enhanced_parsing_validation", cleanedJSON, lastErr)
+					r.failed(reasonIncomplete)
 					continue
 				}
 			}
@@ -322,6 +758,7 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 		if err != nil {
 			lastErr = fmt.Errorf("attempt %d: text parsing failed: %w", attempt, err)
 			logger.LogParsingFailure(attempt, "enhanced_parsing_text", content, lastErr)
+			r.failed(reasonUnparseable)
 			continue
 		}
 
@@ -329,6 +766,7 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 			if err := cmdResp.Validate(); err != nil {
 				lastErr = fmt.Errorf("attempt %d: validation failed: %w", attempt, err)
 				logger.LogParsingFailure(attempt, "enhanced_parsing_validation", content, lastErr)
+				r.failed(reasonIncomplete)
 				continue
 			}
 		}
@@ -336,13 +774,16 @@ func (c *Client) generateWithEnhancedParsing(ctx context.Context, query string,
 		return cmdResp, nil
 	}
 
-	return nil, fmt.Errorf("failed after %d attempts: %w", c.config.MaxRetries, lastErr)
+	if lastErr == nil {
+		return nil, fmt.Errorf("no attempts left: %w", retry.ErrBudgetExhausted)
+	}
+	return nil, fmt.Errorf("failed after %d attempts: %w", r.budget.Used(), lastErr)
 }
 
-func (c *Client) generateWithExplicitJSONPrompt(ctx context.Context, query string) (*schema.CommandResponse, error) {
+func (c *Client) generateWithExplicitJSONPrompt(ctx context.Context, r *run, query string) (*schema.CommandResponse, error) {
 	explicitPrompt := schema.GetSystemPrompt(c.config.OSName, c.config.Shell) + "\n\nREMINDER: Your response must START with { and END with }. Nothing else."
 
-	content, err := c.generate(ctx, explicitPrompt, query, c.config.Temperature*0.5)
+	content, err := c.generate(ctx, r, explicitPrompt, query, c.config.Temperature*0.5)
 	if err != nil {
 		return nil, err
 	}
@@ -351,18 +792,21 @@ func (c *Client) generateWithExplicitJSONPrompt(ctx context.Context, query strin
 		cleanedJSON, err := parser.ExtractJSON(content)
 		if err != nil {
 			logger.LogParsingFailure(1, "explicit_json_extraction", content, err)
+			r.failed(reasonInvalidJSON)
 			return nil, fmt.Errorf("JSON extraction failed: %w", err)
 		}
 
 		var cmdResp schema.CommandResponse
 		if err := json.Unmarshal([]byte(cleanedJSON), &cmdResp); err != nil {
 			logger.LogParsingFailure(1, "explicit_json_unmarshal", cleanedJSON, err)
+			r.failed(reasonInvalidJSON)
 			return nil, fmt.Errorf("unmarshal failed: %w", err)
 		}
 
 		if c.config.StrictValidation {
 			if err := cmdResp.Validate(); err != nil {
 				logger.LogParsingFailure(1, "explicit_json_validation", cleanedJSON, err)
+				r.failed(reasonIncomplete)
 				return nil, fmt.Errorf("validation failed: %w", err)
 			}
 		}
@@ -384,9 +828,9 @@ func (c *Client) generateWithExplicitJSONPrompt(ctx context.Context, query strin
 	return &cmdResp, nil
 }
 
-func (c *Client) generateWithEmergencyFallback(_ context.Context, _ string, lastErr error) (*schema.CommandResponse, error) {
+func (c *Client) generateWithEmergencyFallback(_ context.Context, r *run, lastErr error) (*schema.CommandResponse, error) {
 	explanation := []string{
-		fmt.Sprintf("Vibe failed to generate a valid command after %d attempts.", c.config.MaxRetries),
+		fmt.Sprintf("Vibe failed to generate a valid command after %d attempts.", r.budget.Used()),
 	}
 
 	// Add specific error information if available
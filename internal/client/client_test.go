@@ -0,0 +1,433 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/cache"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+const validCompletion = `{"command":"ls -la","explanation":["ls: list directory contents","-la: include hidden files in long format"]}`
+
+// chatResponse wraps content in an OpenAI-style chat completion body.
+func chatResponse(content string) []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"choices": []map[string]interface{}{
+			{"message": map[string]string{"role": "assistant", "content": content}},
+		},
+	})
+	return body
+}
+
+// testConfig returns a config pointing the vllm provider at a stub server.
+func testConfig(url string) *config.Config {
+	return &config.Config{
+		Provider:             "vllm",
+		APIURL:               url,
+		Model:                "test-model",
+		Temperature:          0.2,
+		MaxTokens:            100,
+		Timeout:              5 * time.Second,
+		Deadline:             20 * time.Second,
+		MaxRetries:           2,
+		UseStructuredOutput:  true,
+		EnableJSONExtraction: true,
+		StrictValidation:     true,
+	}
+}
+
+func TestGenerateCommandHonorsRetryAfter(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := New(testConfig(srv.URL)).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retry happened after %v, want at least the 1s Retry-After", elapsed)
+	}
+}
+
+// TestGenerateCommandBoundsTotalRequests guards against retries compounding
+// across gollm and the parsing layers: MaxRetries=1 must mean two requests.
+func TestGenerateCommandBoundsTotalRequests(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.MaxRetries = 1
+
+	_, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if !errors.Is(err, apierrors.ErrServerError) {
+		t.Errorf("GenerateCommand error = %v, want ErrServerError", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestGenerateCommandDoesNotRetryAuthFailure(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := New(testConfig(srv.URL)).GenerateCommand(context.Background(), "list files")
+	if !errors.Is(err, apierrors.ErrUnauthorized) {
+		t.Errorf("GenerateCommand error = %v, want ErrUnauthorized", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
+
+func TestGenerateCommandRespectsDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.MaxRetries = 10
+	cfg.Deadline = 1500 * time.Millisecond
+
+	start := time.Now()
+	if _, err := New(cfg).GenerateCommand(context.Background(), "list files"); err == nil {
+		t.Fatal("GenerateCommand succeeded against a failing server")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("GenerateCommand took %v, want it bounded by the 1.5s deadline", elapsed)
+	}
+}
+
+func TestGenerateCommandReportsModelNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"message":"The model ` + "`test-model`" + ` does not exist.","code":"model_not_found"}}`))
+	}))
+	defer srv.Close()
+
+	_, err := New(testConfig(srv.URL)).GenerateCommand(context.Background(), "list files")
+	if !errors.Is(err, apierrors.ErrModelNotFound) {
+		t.Errorf("GenerateCommand error = %v, want ErrModelNotFound", err)
+	}
+	if apierrors.ExitCode(err) != apierrors.ExitModelNotFound {
+		t.Errorf("ExitCode = %d, want %d", apierrors.ExitCode(err), apierrors.ExitModelNotFound)
+	}
+}
+
+func TestGenerateCommandReportsConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	_, err := New(testConfig(url)).GenerateCommand(context.Background(), "list files")
+	if !errors.Is(err, apierrors.ErrConnectionRefused) {
+		t.Errorf("GenerateCommand error = %v, want ErrConnectionRefused", err)
+	}
+}
+
+// TestGenerateCommandFallsBackOnUnparseableOutput checks that a model which
+// answers but never produces usable output still gets the fallback response
+// rather than an error.
+func TestGenerateCommandFallsBackOnUnparseableOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(chatResponse("   "))
+	}))
+	defer srv.Close()
+
+	resp, err := New(testConfig(srv.URL)).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "" || resp.Warning == "" {
+		t.Errorf("resp = %+v, want the empty fallback with a warning", resp)
+	}
+}
+
+func TestGenerateRepairsSyntax(t *testing.T) {
+	var requests int32
+	var repairPrompt string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Write(chatResponse(`{"command":"echo 'hello","explanation":["echo: print a greeting"]}`))
+			return
+		}
+		var body struct {
+			Messages []struct{ Content string }
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if n := len(body.Messages); n > 0 {
+			repairPrompt = body.Messages[n-1].Content
+		}
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Shell = "bash"
+	g, err := New(cfg).GenerateDetailed(context.Background(), "say hello", nil)
+	if err != nil {
+		t.Fatalf("GenerateDetailed returned error: %v", err)
+	}
+	if g.Response.Command != "ls -la" || g.Layer != LayerSyntaxRepair {
+		t.Errorf("got %q from layer %q, want the repaired command from %q", g.Response.Command, g.Layer, LayerSyntaxRepair)
+	}
+	if !strings.Contains(repairPrompt, "echo 'hello") || !strings.Contains(repairPrompt, "quote") {
+		t.Errorf("repair prompt %q doesn't quote the command and the syntax error", repairPrompt)
+	}
+}
+
+func TestGenerateWarnsAboutUnrepairedSyntax(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(chatResponse(`{"command":"echo $(date","explanation":["echo: print the date"]}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Shell = "/bin/zsh"
+	resp, err := New(cfg).GenerateCommand(context.Background(), "print the date")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "echo $(date" || !strings.Contains(resp.Warning, "syntax error") {
+		t.Errorf("resp = %+v, want the broken command with a syntax warning", resp)
+	}
+	if got := atomic.LoadInt32(&requests); got != int32(cfg.MaxRetries+1) {
+		t.Errorf("server saw %d requests, want the whole budget of %d", got, cfg.MaxRetries+1)
+	}
+}
+
+func TestGenerateRedactsSecrets(t *testing.T) {
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sent = string(body)
+		w.Write(chatResponse(`{"command":"psql 'postgres://admin:__SECRET_1__@db/app'","explanation":["psql: connect to the database"]}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Redact = true
+	cfg.EnableCache = true
+	cfg.CacheDir = t.TempDir()
+	cfg.CacheTTL = time.Hour
+	query := "connect to postgres://admin:hunter2@db/app"
+	g, err := New(cfg).GenerateDetailed(context.Background(), query, nil)
+	if err != nil {
+		t.Fatalf("GenerateDetailed returned error: %v", err)
+	}
+	if strings.Contains(sent, "hunter2") || !strings.Contains(sent, "__SECRET_1__") {
+		t.Errorf("request sent the secret: %s", sent)
+	}
+	if g.Response.Command != "psql 'postgres://admin:hunter2@db/app'" || g.Redacted != 1 {
+		t.Errorf("got %q (%d redacted), want the secret put back", g.Response.Command, g.Redacted)
+	}
+
+	files, _ := os.ReadDir(cfg.CacheDir)
+	for _, f := range files {
+		data, _ := os.ReadFile(filepath.Join(cfg.CacheDir, f.Name()))
+		if strings.Contains(string(data), "hunter2") {
+			t.Errorf("cache file %s holds the secret: %s", f.Name(), data)
+		}
+	}
+
+	// The cached response keeps its placeholder; a hit restores it again.
+	g, err = New(cfg).GenerateDetailed(context.Background(), query, nil)
+	if err != nil || g.Layer != LayerCache || g.Response.Command != "psql 'postgres://admin:hunter2@db/app'" {
+		t.Errorf("cache hit = %+v, %v", g, err)
+	}
+}
+
+func TestGenerateDetectsPlaceholders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(chatResponse(`{"command":"docker logs -f <container_id> > YOUR_FILE","explanation":["docker logs: show a container's logs"],"placeholders":["<container_id>","<missing>"]}`))
+	}))
+	defer srv.Close()
+
+	resp, err := New(testConfig(srv.URL)).GenerateCommand(context.Background(), "follow a container's logs")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	// Declared placeholders the command lacks are dropped, and ones the
+	// model left undeclared are found.
+	if got := strings.Join(resp.Placeholders, " "); got != "<container_id> YOUR_FILE" {
+		t.Errorf("Placeholders = %q", resp.Placeholders)
+	}
+}
+
+// TestGeneratePlaceholdersAreNotSyntaxErrors checks that <container_id>,
+// which zsh would read as a redirection, is masked for the syntax check:
+// there is no repair turn, no syntax warning, and the answer is cached.
+func TestGeneratePlaceholdersAreNotSyntaxErrors(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(chatResponse(`{"command":"docker stop <container_id>","explanation":["docker stop: stop a container"],"safety_level":"safe","placeholders":["<container_id>"]}`))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Shell = "zsh"
+	cfg.MaxRetries = 3
+	cfg.EnableCache = true
+	cfg.CacheDir = t.TempDir()
+	cfg.CacheTTL = time.Hour
+	g, err := New(cfg).GenerateDetailed(context.Background(), "stop a container", nil)
+	if err != nil {
+		t.Fatalf("GenerateDetailed returned error: %v", err)
+	}
+	if resp := g.Response; resp.Warning != "" || resp.SafetyLevel != "safe" {
+		t.Errorf("got warning %q, level %q; want none, safe", resp.Warning, resp.SafetyLevel)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+	if g, err := New(cfg).GenerateDetailed(context.Background(), "stop a container", nil); err != nil || g.Layer != LayerCache {
+		t.Errorf("second call = %+v, %v; want a cache hit", g, err)
+	}
+}
+
+// ollamaServer is a stub Ollama server. loaded lists the models /api/ps
+// reports; body receives the last /api/generate request.
+func ollamaServer(t *testing.T, loaded string, body *map[string]interface{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+		case "/api/ps":
+			fmt.Fprintf(w, `{"models":[{"name":%q}]}`, loaded)
+		case "/api/generate":
+			json.NewDecoder(r.Body).Decode(body)
+			json.NewEncoder(w).Encode(map[string]interface{}{"response": validCompletion, "done": true})
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOllamaRequestsSendKeepAlive(t *testing.T) {
+	var body map[string]interface{}
+	srv := ollamaServer(t, "test-model", &body)
+
+	cfg := testConfig(srv.URL + "/v1")
+	cfg.Provider = "ollama"
+	cfg.KeepAlive = "1h"
+
+	if _, err := New(cfg).GenerateCommand(context.Background(), "list files"); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if body["keep_alive"] != "1h" {
+		t.Errorf("keep_alive = %v, want 1h", body["keep_alive"])
+	}
+}
+
+func TestModelIsCold(t *testing.T) {
+	srv := ollamaServer(t, "other-model:latest", nil)
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = "ollama"
+	c := &Client{config: cfg}
+	if !c.modelIsCold(context.Background()) {
+		t.Error("modelIsCold = false for a model /api/ps does not list")
+	}
+
+	cfg.Model = "other-model"
+	if c.modelIsCold(context.Background()) {
+		t.Error("modelIsCold = true for a loaded model")
+	}
+}
+
+// cachedClient returns a client for an Ollama server that fails the test on
+// any request, with "list files" already in its cache.
+func cachedClient(tb testing.TB) *Client {
+	tb.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tb.Errorf("cache hit made a request to %s", r.URL.Path)
+	}))
+	tb.Cleanup(srv.Close)
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = "ollama"
+	cfg.EnableCache = true
+	cfg.CacheDir = tb.TempDir()
+	cfg.CacheTTL = time.Hour
+
+	c, err := cache.New(cfg.CacheDir, cfg.CacheTTL, cacheScope(cfg))
+	if err != nil {
+		tb.Fatalf("cache.New: %v", err)
+	}
+	if err := c.Set("list files", &schema.CommandResponse{Command: "ls -la", Explanation: []string{"list"}}); err != nil {
+		tb.Fatalf("cache.Set: %v", err)
+	}
+	return New(cfg)
+}
+
+// TestCacheHitIsOffline verifies that a cached answer is returned without
+// constructing the provider, which for Ollama would probe the server.
+func TestCacheHitIsOffline(t *testing.T) {
+	c := cachedClient(t)
+
+	resp, err := c.GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	if c.llm != nil || c.initErr != nil {
+		t.Error("cache hit constructed the LLM")
+	}
+}
+
+func BenchmarkGenerateCommandCacheHit(b *testing.B) {
+	c := cachedClient(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GenerateCommand(ctx, "list files"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"os"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/auth"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/teilomillet/gollm/providers"
+)
+
+// customProvider is a provider defined in the config file. It reuses the
+// gollm provider for its dialect for request and response handling, and
+// overrides the name, endpoint and authentication.
+type customProvider struct {
+	providers.Provider
+	name     string
+	endpoint string
+	auth     *auth.Authenticator
+}
+
+func (p *customProvider) Name() string {
+	return p.name
+}
+
+func (p *customProvider) Endpoint() string {
+	return p.endpoint
+}
+
+// Headers drops the headers the embedded provider derives from gollm's
+// placeholder key (e.g. Anthropic's x-api-key) and adds the configured
+// authentication and extra headers instead.
+func (p *customProvider) Headers() map[string]string {
+	headers := make(map[string]string)
+	for k, v := range p.Provider.Headers() {
+		if !strings.Contains(v, gollmPlaceholderKey) {
+			headers[k] = v
+		}
+	}
+	for k, v := range p.auth.Headers() {
+		headers[k] = v
+	}
+	return headers
+}
+
+// registerCustomProviders registers every provider from the config file on
+// gollm's default registry. Registering again replaces the previous entry,
+// so this is safe to call for each client.
+func registerCustomProviders(defs map[string]config.CustomProvider) {
+	for name, def := range defs {
+		def := def
+		providers.GetDefaultRegistry().Register(name,
+			func(apiKey, model string, extraHeaders map[string]string) providers.Provider {
+				var base providers.Provider
+				switch def.Dialect {
+				case config.DialectAnthropic:
+					base = providers.NewAnthropicProvider(apiKey, model, extraHeaders)
+				case config.DialectOllama:
+					base = providers.NewOllamaProvider(apiKey, model, extraHeaders)
+				default:
+					base = providers.NewVLLMProvider(apiKey, model, extraHeaders)
+				}
+				a := providerAuth
+				if a == nil {
+					a, _ = auth.New(auth.Config{Scheme: auth.SchemeNone, ExtraHeaders: def.Headers})
+				}
+				return &customProvider{Provider: base, name: def.Name, endpoint: customEndpoint(def), auth: a}
+			},
+		)
+	}
+}
+
+// customEndpoint derives the request URL from base_url and the dialect. A
+// base_url that already names the full path is used as is.
+func customEndpoint(def config.CustomProvider) string {
+	base := strings.TrimSuffix(def.BaseURL, "/")
+	switch def.Dialect {
+	case config.DialectAnthropic:
+		if strings.HasSuffix(base, "/messages") {
+			return base
+		}
+		return base + "/messages"
+	case config.DialectOllama:
+		if strings.HasSuffix(base, "/api/generate") {
+			return base
+		}
+		return ollamaEndpoint(base) + "/api/generate"
+	default:
+		if strings.HasSuffix(base, "/chat/completions") {
+			return base
+		}
+		return base + "/chat/completions"
+	}
+}
+
+// newCustomAuthenticator builds the authenticator for a custom provider. The
+// dialect decides the default scheme: Anthropic-style gateways expect an
+// x-api-key header, Ollama-style servers usually need nothing.
+func newCustomAuthenticator(cfg *config.Config, def config.CustomProvider) (*auth.Authenticator, error) {
+	a := def.Auth
+	if a.Scheme == "" {
+		switch def.Dialect {
+		case config.DialectAnthropic:
+			a.Scheme, a.Header = auth.SchemeHeader, "x-api-key"
+		case config.DialectOllama:
+			a.Scheme = auth.SchemeNone
+		default:
+			a.Scheme = auth.SchemeBearer
+		}
+	}
+
+	key := cfg.APIKey
+	if a.APIKeyEnv != "" {
+		key = os.Getenv(a.APIKeyEnv)
+	}
+
+	headers := make(map[string]string, len(def.Headers)+len(cfg.ExtraHeaders))
+	for k, v := range def.Headers {
+		headers[k] = v
+	}
+	for k, v := range cfg.ExtraHeaders {
+		headers[k] = v
+	}
+
+	return auth.New(auth.Config{
+		Scheme:       a.Scheme,
+		APIKey:       key,
+		Header:       a.Header,
+		Username:     a.Username,
+		TokenURL:     a.TokenURL,
+		ClientID:     a.ClientID,
+		ClientSecret: a.ClientSecret,
+		Scope:        a.Scope,
+		ExtraHeaders: headers,
+		CacheDir:     cfg.CacheDir,
+	})
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+func TestCustomEndpoint(t *testing.T) {
+	cases := []struct {
+		dialect, baseURL, want string
+	}{
+		{config.DialectOpenAI, "https://llm.corp.example/v1/", "https://llm.corp.example/v1/chat/completions"},
+		{config.DialectOpenAI, "https://llm.corp.example/v1/chat/completions", "https://llm.corp.example/v1/chat/completions"},
+		{config.DialectAnthropic, "https://claude.corp.example/v1", "https://claude.corp.example/v1/messages"},
+		{config.DialectOllama, "http://gpu-box:11434/v1", "http://gpu-box:11434/api/generate"},
+	}
+	for _, c := range cases {
+		got := customEndpoint(config.CustomProvider{Dialect: c.dialect, BaseURL: c.baseURL})
+		if got != c.want {
+			t.Errorf("customEndpoint(%s, %q) = %q, want %q", c.dialect, c.baseURL, got, c.want)
+		}
+	}
+}
+
+func TestCustomOpenAIProvider(t *testing.T) {
+	t.Setenv("MYCORP_KEY", "corp-secret")
+
+	var model string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Corp-Key"); got != "corp-secret" {
+			t.Errorf("X-Corp-Key = %q, want corp-secret", got)
+		}
+		if got := r.Header.Get("X-Team"); got != "infra" {
+			t.Errorf("X-Team = %q, want infra", got)
+		}
+		if got := r.Header.Get("Authorization"); got != "" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		model = body.Model
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = "mycorp"
+	cfg.Model = "fast"
+	cfg.Providers = map[string]config.CustomProvider{
+		"mycorp": {
+			Name:    "mycorp",
+			BaseURL: srv.URL + "/v1",
+			Dialect: config.DialectOpenAI,
+			Auth:    config.CustomAuth{Scheme: "header", Header: "X-Corp-Key", APIKeyEnv: "MYCORP_KEY"},
+			Headers: map[string]string{"X-Team": "infra"},
+			Models:  map[string]string{"fast": "llama-3.1-8b-instruct"},
+		},
+	}
+
+	resp, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	if model != "llama-3.1-8b-instruct" {
+		t.Errorf("model = %q, want the alias target llama-3.1-8b-instruct", model)
+	}
+}
+
+func TestCustomAnthropicProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "sk-corp" {
+			t.Errorf("x-api-key = %q, want the API key", got)
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Error("anthropic-version header missing")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"content": []map[string]string{{"type": "text", "text": validCompletion}},
+		})
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = "claude-gw"
+	cfg.APIKey = "sk-corp"
+	cfg.Providers = map[string]config.CustomProvider{
+		"claude-gw": {Name: "claude-gw", BaseURL: srv.URL + "/v1", Dialect: config.DialectAnthropic},
+	}
+
+	resp, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+}
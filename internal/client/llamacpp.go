@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/skymoore/vibe-zsh/internal/auth"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	gollmconfig "github.com/teilomillet/gollm/config"
+	"github.com/teilomillet/gollm/providers"
+)
+
+// jsonSchemaOption is the gollm option holding the JSON schema that
+// constrains llama.cpp output. newLLM sets it when structured output is on.
+const jsonSchemaOption = "json_schema"
+
+// llamaCppProvider talks to llama.cpp's llama-server through its native
+// /completion endpoint. Unlike the OpenAI-compatible endpoints, /completion
+// takes a JSON schema that llama-server compiles into a grammar, so the model
+// can only produce JSON matching it. The embedded vllm provider supplies the
+// parts of the provider interface vibe does not use.
+type llamaCppProvider struct {
+	providers.Provider
+	endpoint string
+	options  map[string]interface{}
+	auth     *auth.Authenticator
+}
+
+func (p *llamaCppProvider) Name() string {
+	return config.ProviderLlamaCpp
+}
+
+// SetDefaultOptions records the generation defaults and the server URL, which
+// newLLM passes through the vLLM endpoint option.
+func (p *llamaCppProvider) SetDefaultOptions(cfg *gollmconfig.Config) {
+	p.Provider.SetDefaultOptions(cfg)
+	p.endpoint = cfg.VLLMEndpoint
+	p.SetOption("temperature", cfg.Temperature)
+	p.SetOption("max_tokens", cfg.MaxTokens)
+	if cfg.Seed != nil {
+		p.SetOption("seed", *cfg.Seed)
+	}
+}
+
+func (p *llamaCppProvider) SetOption(key string, value interface{}) {
+	p.Provider.SetOption(key, value)
+	p.options[key] = value
+}
+
+// Endpoint returns {server}/completion. A trailing /v1, as used for the
+// OpenAI-compatible endpoints, is dropped.
+func (p *llamaCppProvider) Endpoint() string {
+	base := strings.TrimSuffix(p.endpoint, "/")
+	if strings.HasSuffix(base, "/completion") {
+		return base
+	}
+	return strings.TrimSuffix(base, "/v1") + "/completion"
+}
+
+func (p *llamaCppProvider) SupportsJSONSchema() bool {
+	return true
+}
+
+func (p *llamaCppProvider) Headers() map[string]string {
+	headers := map[string]string{"Content-Type": "application/json"}
+	for k, v := range p.auth.Headers() {
+		headers[k] = v
+	}
+	return headers
+}
+
+// PrepareRequest builds a /completion request. /completion takes a single
+// prompt; gollm's rendering of the prompt already includes the system prompt.
+func (p *llamaCppProvider) PrepareRequest(prompt string, options map[string]interface{}) ([]byte, error) {
+	merged := make(map[string]interface{}, len(p.options)+len(options))
+	for k, v := range p.options {
+		merged[k] = v
+	}
+	for k, v := range options {
+		merged[k] = v
+	}
+
+	request := map[string]interface{}{
+		"prompt":       prompt,
+		"stream":       false,
+		"cache_prompt": true, // Reuse the evaluated system prompt across queries
+	}
+	for k, v := range merged {
+		switch k {
+		case "system_prompt":
+			// Already part of prompt.
+		case "max_tokens":
+			request["n_predict"] = v
+		case jsonSchemaOption:
+			if v != nil {
+				request["json_schema"] = v
+			}
+		case "temperature", "seed", "top_p", "top_k", "min_p", "stop", "repeat_penalty":
+			request[k] = v
+		}
+	}
+	return json.Marshal(request)
+}
+
+func (p *llamaCppProvider) PrepareRequestWithSchema(prompt string, options map[string]interface{}, schema interface{}) ([]byte, error) {
+	withSchema := make(map[string]interface{}, len(options)+1)
+	for k, v := range options {
+		withSchema[k] = v
+	}
+	withSchema[jsonSchemaOption] = schema
+	return p.PrepareRequest(prompt, withSchema)
+}
+
+func (p *llamaCppProvider) ParseResponse(body []byte) (string, error) {
+	var response struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	if response.Content == "" {
+		return "", fmt.Errorf("empty response from API")
+	}
+	return response.Content, nil
+}
+
+var registerLlamaCppOnce sync.Once
+
+// registerLlamaCppProvider registers the llamacpp provider on gollm's default
+// registry. It is safe to call multiple times.
+func registerLlamaCppProvider() {
+	registerLlamaCppOnce.Do(func() {
+		providers.GetDefaultRegistry().Register(
+			config.ProviderLlamaCpp,
+			func(apiKey, model string, extraHeaders map[string]string) providers.Provider {
+				a := providerAuth
+				if a == nil {
+					a, _ = auth.New(auth.Config{Scheme: auth.SchemeNone})
+				}
+				return &llamaCppProvider{
+					Provider: providers.NewVLLMProvider(apiKey, model, extraHeaders),
+					options:  make(map[string]interface{}),
+					auth:     a,
+				}
+			},
+		)
+	})
+}
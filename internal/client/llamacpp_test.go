@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+// llamaServer is a stub llama-server /completion endpoint that records the
+// last request body.
+func llamaServer(t *testing.T, requests *int32, last *map[string]interface{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.URL.Path != "/completion" {
+			t.Errorf("path = %q, want /completion", r.URL.Path)
+		}
+		body := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&body)
+		*last = body
+		json.NewEncoder(w).Encode(map[string]interface{}{"content": validCompletion, "stop": true})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLlamaCppSendsJSONSchema(t *testing.T) {
+	var requests int32
+	var body map[string]interface{}
+	srv := llamaServer(t, &requests, &body)
+
+	cfg := testConfig(srv.URL + "/v1")
+	cfg.Provider = config.ProviderLlamaCpp
+	cfg.UseStructuredOutput = true
+
+	resp, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("requests = %d, want 1", n)
+	}
+
+	schema, ok := body["json_schema"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("json_schema missing from request: %v", body)
+	}
+	if required, _ := schema["required"].([]interface{}); len(required) != 2 {
+		t.Errorf("json_schema.required = %v, want command and explanation", schema["required"])
+	}
+	prompt, _ := body["prompt"].(string)
+	if !strings.Contains(prompt, "VibeCLI") || !strings.Contains(prompt, "list files") {
+		t.Errorf("prompt does not contain the system prompt and query: %q", prompt)
+	}
+	if body["n_predict"] != float64(cfg.MaxTokens) {
+		t.Errorf("n_predict = %v, want %d", body["n_predict"], cfg.MaxTokens)
+	}
+}
+
+func TestLlamaCppWithoutStructuredOutput(t *testing.T) {
+	var requests int32
+	var body map[string]interface{}
+	srv := llamaServer(t, &requests, &body)
+
+	cfg := testConfig(srv.URL)
+	cfg.Provider = config.ProviderLlamaCpp
+	cfg.UseStructuredOutput = false
+
+	if _, err := New(cfg).GenerateCommand(context.Background(), "list files"); err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if _, ok := body["json_schema"]; ok {
+		t.Error("json_schema sent with structured output disabled")
+	}
+}
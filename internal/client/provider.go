@@ -3,17 +3,20 @@ package client
 import (
 	"sync"
 
+	"github.com/skymoore/vibe-zsh/internal/auth"
 	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/teilomillet/gollm"
 	"github.com/teilomillet/gollm/providers"
 )
 
 // authedOpenAIProvider wraps gollm's vllm provider, which speaks the
 // OpenAI-compatible dialect against a user-configured endpoint but
 // deliberately omits authentication. We promote every method from the
-// embedded provider and override only Headers to inject the Bearer token.
+// embedded provider and override only Headers to inject the configured
+// authentication (see internal/auth).
 type authedOpenAIProvider struct {
 	providers.Provider
-	apiKey string
+	auth *auth.Authenticator
 }
 
 // Name identifies this provider in logs and errors. The embedded vllm
@@ -22,20 +25,28 @@ func (p *authedOpenAIProvider) Name() string {
 	return config.ProviderOpenAICompatible
 }
 
-// Headers returns the embedded provider's headers plus an Authorization
-// header when an API key is configured.
+// Headers returns the embedded provider's headers plus the authentication
+// and extra headers from the authenticator.
 func (p *authedOpenAIProvider) Headers() map[string]string {
 	headers := p.Provider.Headers()
 	if headers == nil {
 		headers = make(map[string]string)
 	}
-	if p.apiKey != "" {
-		headers["Authorization"] = "Bearer " + p.apiKey
+	for k, v := range p.auth.Headers() {
+		headers[k] = v
 	}
 	return headers
 }
 
-var registerOpenAICompatibleOnce sync.Once
+var (
+	registerOpenAICompatibleOnce sync.Once
+
+	// providerAuth is the authenticator handed to openai-compatible and
+	// custom providers while withProviderAuth runs. gollm's provider
+	// constructors only receive an API key, so it is passed out of band.
+	providerAuthMu sync.Mutex
+	providerAuth   *auth.Authenticator
+)
 
 // registerOpenAICompatibleProvider registers the openai-compatible provider on
 // gollm's default registry (the one gollm.NewLLM consults). It is safe to call
@@ -46,8 +57,42 @@ func registerOpenAICompatibleProvider() {
 			config.ProviderOpenAICompatible,
 			func(apiKey, model string, extraHeaders map[string]string) providers.Provider {
 				base := providers.NewVLLMProvider(apiKey, model, extraHeaders)
-				return &authedOpenAIProvider{Provider: base, apiKey: apiKey}
+				a := providerAuth
+				if a == nil {
+					// Constructed outside withProviderAuth: fall
+					// back to Bearer auth with the key gollm passed.
+					a, _ = auth.New(auth.Config{Scheme: auth.SchemeBearer, APIKey: apiKey})
+				}
+				return &authedOpenAIProvider{Provider: base, auth: a}
 			},
 		)
 	})
 }
+
+// withProviderAuth runs build, which constructs a gollm LLM, so that any
+// openai-compatible or custom provider it creates uses a. Constructions are
+// serialized so concurrent clients never pick up each other's credentials.
+func withProviderAuth(a *auth.Authenticator, build func() (gollm.LLM, error)) (gollm.LLM, error) {
+	providerAuthMu.Lock()
+	defer providerAuthMu.Unlock()
+
+	providerAuth = a
+	defer func() { providerAuth = nil }()
+	return build()
+}
+
+// newAuthenticator builds the openai-compatible authenticator from cfg.
+func newAuthenticator(cfg *config.Config) (*auth.Authenticator, error) {
+	return auth.New(auth.Config{
+		Scheme:       cfg.AuthScheme,
+		APIKey:       cfg.APIKey,
+		Header:       cfg.AuthHeader,
+		Username:     cfg.AuthUsername,
+		TokenURL:     cfg.OAuthTokenURL,
+		ClientID:     cfg.OAuthClientID,
+		ClientSecret: cfg.OAuthClientSecret,
+		Scope:        cfg.OAuthScope,
+		ExtraHeaders: cfg.ExtraHeaders,
+		CacheDir:     cfg.CacheDir,
+	})
+}
@@ -1,6 +1,11 @@
 package client
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
 	"github.com/skymoore/vibe-zsh/internal/config"
@@ -40,3 +45,47 @@ func TestVLLMProviderHasNoAuth(t *testing.T) {
 		t.Error("vllm provider unexpectedly set an Authorization header")
 	}
 }
+
+// TestOpenAICompatibleOAuth2 runs a query through the openai-compatible
+// provider against a stub token endpoint. The first token is rejected as if
+// it had been revoked; the client must fetch a new one and retry once.
+func TestOpenAICompatibleOAuth2(t *testing.T) {
+	var issued int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":3600}`, n)
+	}))
+	defer tokens.Close()
+
+	var seen []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization")+" "+r.Header.Get("X-Team"))
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(chatResponse(validCompletion))
+	}))
+	defer gateway.Close()
+
+	cfg := testConfig(gateway.URL)
+	cfg.Provider = config.ProviderOpenAICompatible
+	cfg.AuthScheme = "oauth2"
+	cfg.OAuthTokenURL = tokens.URL
+	cfg.OAuthClientID = "client"
+	cfg.OAuthClientSecret = "secret"
+	cfg.ExtraHeaders = map[string]string{"X-Team": "infra"}
+	cfg.CacheDir = t.TempDir()
+
+	resp, err := New(cfg).GenerateCommand(context.Background(), "list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand returned error: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	want := []string{"Bearer token-1 infra", "Bearer token-2 infra"}
+	if fmt.Sprint(seen) != fmt.Sprint(want) {
+		t.Errorf("gateway saw %q, want %q", seen, want)
+	}
+}
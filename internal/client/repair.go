@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/parser"
+	"github.com/skymoore/vibe-zsh/internal/placeholder"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// reasonSyntax is the retry status reason for a command that doesn't parse.
+const reasonSyntax = "syntax error"
+
+// repairSyntax checks that resp.Command, with its placeholders masked,
+// parses for the configured shell: <container_id> is not a redirection. If
+// it doesn't, the parser's error is sent back to the model for a fix while
+// the retry budget lasts. It returns the response to use, the layer that
+// produced it, and whether its syntax is valid; a command that is still
+// broken carries a warning saying so, so it never reaches the buffer
+// silently.
+func (c *Client) repairSyntax(ctx context.Context, r *run, query string, resp *schema.CommandResponse, layer string) (*schema.CommandResponse, string, bool) {
+	err := c.checkSyntax(resp)
+	for err != nil && r.budget.Remaining() > 0 {
+		logger.Debug("Syntax error in %q: %v", resp.Command, err)
+		r.failed(reasonSyntax)
+		r.progress("Repairing syntax...")
+
+		fixed, genErr := c.generateRepair(ctx, r, query, resp.Command, err)
+		if genErr != nil {
+			logger.LogParsingFailure(1, LayerSyntaxRepair, "", genErr)
+			if isFatal(genErr) {
+				break
+			}
+			continue
+		}
+		logger.LogLayerSuccess(LayerSyntaxRepair, 5)
+		resp, layer = fixed, LayerSyntaxRepair
+		err = c.checkSyntax(resp)
+	}
+
+	if err == nil {
+		return resp, layer, true
+	}
+	warning := fmt.Sprintf("shell syntax error (%v) - fix it before running", err)
+	if resp.Warning != "" {
+		warning = resp.Warning + "; " + warning
+	}
+	resp.Warning = warning
+	return resp, layer, false
+}
+
+// checkSyntax checks resp.Command's syntax with its placeholders, declared
+// or detected, masked.
+func (c *Client) checkSyntax(resp *schema.CommandResponse) error {
+	tokens := placeholder.Tokens(placeholder.Detect(resp.Command, resp.Placeholders))
+	return safety.CheckSyntax(safety.Mask(resp.Command, tokens), c.config.Shell)
+}
+
+// generateRepair asks the model to fix the syntax of command.
+func (c *Client) generateRepair(ctx context.Context, r *run, query, command string, syntaxErr error) (*schema.CommandResponse, error) {
+	prompt := schema.GetRepairPrompt(query, command, syntaxErr.Error())
+	content, err := c.generate(ctx, r, schema.GetSystemPrompt(c.config.OSName, c.config.Shell), prompt, c.config.Temperature*0.5)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.config.EnableJSONExtraction {
+		if content, err = parser.ExtractJSON(content); err != nil {
+			r.failed(reasonInvalidJSON)
+			return nil, fmt.Errorf("JSON extraction failed: %w", err)
+		}
+	}
+
+	var cmdResp schema.CommandResponse
+	if err := json.Unmarshal([]byte(content), &cmdResp); err != nil {
+		r.failed(reasonInvalidJSON)
+		return nil, fmt.Errorf("unmarshal failed: %w", err)
+	}
+	if err := cmdResp.Validate(); err != nil {
+		r.failed(reasonIncomplete)
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	return &cmdResp, nil
+}
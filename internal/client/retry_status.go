@@ -0,0 +1,76 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+)
+
+// Reasons shown in the retry status line for parse-layer failures. Transport
+// failures are described by retryReason.
+const (
+	reasonInvalidJSON = "invalid JSON"
+	reasonIncomplete  = "incomplete response"
+	reasonUnparseable = "unparseable text"
+)
+
+// retryReason names the cause of a failed request for the retry status line.
+func retryReason(err error) string {
+	var apiErr *apierrors.APIError
+	switch {
+	case errors.Is(err, apierrors.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, apierrors.ErrRateLimit):
+		return "rate limited (429)"
+	case errors.Is(err, apierrors.ErrServerError):
+		return "server error"
+	case errors.Is(err, apierrors.ErrInvalidJSON):
+		return reasonInvalidJSON
+	case errors.Is(err, apierrors.ErrEmptyResponse):
+		return "empty response"
+	case errors.Is(err, apierrors.ErrConnectionRefused):
+		return "connection refused"
+	case errors.As(err, &apiErr):
+		return fmt.Sprintf("HTTP %d", apiErr.StatusCode)
+	default:
+		return "request failed"
+	}
+}
+
+// failed records why the latest attempt failed so later status updates can
+// show it.
+func (r *run) failed(reason string) {
+	r.lastFailure = reason
+	logger.Debug("Attempt %d/%d failed: %s", r.budget.Used(), r.budget.Max(), reason)
+}
+
+// progress shows the current stage on the spinner. When retry status is
+// enabled and an earlier attempt failed, it also names the upcoming attempt
+// and why the previous one failed.
+func (r *run) progress(stage string) {
+	if r.status == nil {
+		return
+	}
+	if r.showStatus && r.lastFailure != "" {
+		stage = fmt.Sprintf("%s (attempt %d/%d, last: %s)", stage, r.budget.Used()+1, r.budget.Max(), r.lastFailure)
+	}
+	r.status.Update(stage)
+}
+
+// waiting shows a backoff countdown on the spinner. Without retry status only
+// a generic message is shown.
+func (r *run) waiting(remaining time.Duration) {
+	if r.status == nil {
+		return
+	}
+	if !r.showStatus {
+		r.status.Update("Retrying...")
+		return
+	}
+	r.status.Update(fmt.Sprintf("Attempt %d/%d failed (%s), retrying in %ds...",
+		r.budget.Used(), r.budget.Max(), r.lastFailure, int(math.Ceil(remaining.Seconds()))))
+}
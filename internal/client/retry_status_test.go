@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/progress"
+	"github.com/skymoore/vibe-zsh/internal/retry"
+)
+
+func TestRetryReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: dial tcp: i/o timeout", apierrors.ErrTimeout), "timeout"},
+		{apierrors.NewAPIError(429, ""), "rate limited (429)"},
+		{apierrors.NewAPIError(503, ""), "server error"},
+		{apierrors.NewAPIError(504, ""), "HTTP 504"},
+		{fmt.Errorf("%w: bad body", apierrors.ErrInvalidJSON), "invalid JSON"},
+		{fmt.Errorf("boom"), "request failed"},
+	}
+
+	for _, tt := range tests {
+		if got := retryReason(tt.err); got != tt.want {
+			t.Errorf("retryReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+// spinnerOutput drives fn against a run whose spinner writes to a buffer and
+// returns everything the spinner rendered.
+func spinnerOutput(t *testing.T, showStatus bool, fn func(r *run)) string {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	s := progress.NewSpinnerWithWriter(progress.StyleDots, buf)
+	s.Start(context.Background(), "Generating command...")
+
+	r := &run{
+		budget:     retry.NewPolicy(3).NewBudget(),
+		status:     s,
+		showStatus: showStatus,
+	}
+	_ = r.budget.Take()
+
+	fn(r)
+	time.Sleep(200 * time.Millisecond)
+	s.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	return buf.String()
+}
+
+func TestRetryStatusShowsAttemptReasonAndDelay(t *testing.T) {
+	out := spinnerOutput(t, true, func(r *run) {
+		r.failed("rate limited (429)")
+		r.waiting(3 * time.Second)
+	})
+
+	if !strings.Contains(out, "Attempt 1/4 failed (rate limited (429)), retrying in 3s...") {
+		t.Errorf("spinner output missing retry status, got: %q", out)
+	}
+}
+
+func TestRetryStatusProgressNamesLastFailure(t *testing.T) {
+	out := spinnerOutput(t, true, func(r *run) {
+		r.failed(reasonInvalidJSON)
+		r.progress("Parsing response...")
+	})
+
+	if !strings.Contains(out, "Parsing response... (attempt 2/4, last: invalid JSON)") {
+		t.Errorf("spinner output missing attempt details, got: %q", out)
+	}
+}
+
+func TestRetryStatusDisabled(t *testing.T) {
+	out := spinnerOutput(t, false, func(r *run) {
+		r.failed("timeout")
+		r.waiting(3 * time.Second)
+	})
+
+	if strings.Contains(out, "timeout") || strings.Contains(out, "Attempt") {
+		t.Errorf("retry details shown with retry status disabled: %q", out)
+	}
+	if !strings.Contains(out, "Retrying...") {
+		t.Errorf("expected generic retry message, got: %q", out)
+	}
+}
@@ -14,16 +14,36 @@ type Config struct {
 	Provider             string
 	APIURL               string
 	APIKey               string
+	AuthScheme           string
+	AuthHeader           string
+	AuthUsername         string
+	OAuthTokenURL        string
+	OAuthClientID        string
+	OAuthClientSecret    string
+	OAuthScope           string
+	ExtraHeaders         map[string]string
+	AzureResource        string
+	AzureDeployment      string
+	AzureAPIVersion      string
 	Model                string
 	Temperature          float64
 	MaxTokens            int
 	Timeout              time.Duration
+	Deadline             time.Duration
+	KeepAlive            string
+	CAFile               string
+	ClientCert           string
+	ClientKey            string
+	HTTPSProxy           string
+	InsecureSkipVerify   bool
 	UseStructuredOutput  bool
 	ShowExplanation      bool
 	EnableCache          bool
 	CacheDir             string
 	CacheTTL             time.Duration
 	InteractiveMode      bool
+	PreviewFiles         bool
+	FillPlaceholders     bool
 	ShowWarnings         bool
 	MaxRetries           int
 	EnableJSONExtraction bool
@@ -40,6 +60,21 @@ type Config struct {
 	HistorySize          int
 	HistoryKey           string
 	RegenerateKey        string
+	StateDir             string
+	UseDaemon            bool
+	DaemonIdleTimeout    time.Duration
+	PolicyFile           string
+	Redact               bool
+	AuditLog             string
+	AuditMaxSizeMB       int
+	AuditKeep            int
+	AuditHashChain       bool
+
+	// From the config file (see File).
+	Providers      map[string]CustomProvider
+	HostPatterns   []HostPattern
+	RedactPatterns []string
+	FileError      error // Set if the config file exists but can't be used
 }
 
 // ProviderOpenAICompatible is the provider name for a generic OpenAI-compatible
@@ -48,22 +83,57 @@ type Config struct {
 // sends an Authorization header.
 const ProviderOpenAICompatible = "openai-compatible"
 
+// ProviderAzureOpenAI is the provider name for Azure OpenAI, which addresses
+// models by deployment and authenticates with an api-key header.
+const ProviderAzureOpenAI = "azure-openai"
+
+// ProviderLlamaCpp is the provider name for llama.cpp's llama-server, reached
+// through its native /completion endpoint.
+const ProviderLlamaCpp = "llamacpp"
+
+// DefaultAPIURL is the endpoint used when VIBE_API_URL is unset: a local
+// Ollama server.
+const DefaultAPIURL = "http://localhost:11434/v1"
+
 func Load() *Config {
-	apiURL := getEnv("VIBE_API_URL", "http://localhost:11434/v1")
+	file, fileErr := loadFile()
+	hosts := file.hostPatterns()
+
+	apiURL := getEnv("VIBE_API_URL", DefaultAPIURL)
 	return &Config{
-		Provider:             getEnv("VIBE_PROVIDER", inferProvider(apiURL)),
+		Provider:             getEnv("VIBE_PROVIDER", inferProvider(apiURL, hosts)),
 		APIURL:               apiURL,
 		APIKey:               getEnv("VIBE_API_KEY", ""),
+		AuthScheme:           getEnv("VIBE_AUTH_SCHEME", "bearer"),
+		AuthHeader:           getEnv("VIBE_AUTH_HEADER", ""),
+		AuthUsername:         getEnv("VIBE_AUTH_USERNAME", ""),
+		OAuthTokenURL:        getEnv("VIBE_OAUTH_TOKEN_URL", ""),
+		OAuthClientID:        getEnv("VIBE_OAUTH_CLIENT_ID", ""),
+		OAuthClientSecret:    getEnv("VIBE_OAUTH_CLIENT_SECRET", ""),
+		OAuthScope:           getEnv("VIBE_OAUTH_SCOPE", ""),
+		ExtraHeaders:         getEnvHeaders("VIBE_EXTRA_HEADERS"),
+		AzureResource:        getEnv("VIBE_AZURE_RESOURCE", ""),
+		AzureDeployment:      getEnv("VIBE_AZURE_DEPLOYMENT", ""),
+		AzureAPIVersion:      getEnv("VIBE_AZURE_API_VERSION", "2024-10-21"),
 		Model:                getEnv("VIBE_MODEL", "llama3:8b"),
 		Temperature:          getEnvFloat("VIBE_TEMPERATURE", 0.2),
 		MaxTokens:            getEnvInt("VIBE_MAX_TOKENS", 1000),
 		Timeout:              getEnvDuration("VIBE_TIMEOUT", 30*time.Second),
+		Deadline:             getEnvDuration("VIBE_DEADLINE", 60*time.Second),
+		KeepAlive:            getEnv("VIBE_KEEP_ALIVE", "30m"),
+		CAFile:               getEnv("VIBE_CA_FILE", ""),
+		ClientCert:           getEnv("VIBE_CLIENT_CERT", ""),
+		ClientKey:            getEnv("VIBE_CLIENT_KEY", ""),
+		HTTPSProxy:           getEnv("VIBE_HTTPS_PROXY", ""),
+		InsecureSkipVerify:   getEnvBool("VIBE_INSECURE_SKIP_VERIFY", false),
 		UseStructuredOutput:  getEnvBool("VIBE_USE_STRUCTURED_OUTPUT", true),
 		ShowExplanation:      getEnvBool("VIBE_SHOW_EXPLANATION", true),
 		EnableCache:          getEnvBool("VIBE_ENABLE_CACHE", true),
 		CacheDir:             getEnv("VIBE_CACHE_DIR", ""),
 		CacheTTL:             getEnvDuration("VIBE_CACHE_TTL", 24*time.Hour),
 		InteractiveMode:      getEnvBool("VIBE_INTERACTIVE", false),
+		PreviewFiles:         getEnvBool("VIBE_PREVIEW_FILES", true),
+		FillPlaceholders:     getEnvBool("VIBE_FILL_PLACEHOLDERS", true),
 		ShowWarnings:         getEnvBool("VIBE_SHOW_WARNINGS", true),
 		MaxRetries:           getEnvInt("VIBE_MAX_RETRIES", 3),
 		EnableJSONExtraction: getEnvBool("VIBE_ENABLE_JSON_EXTRACTION", true),
@@ -80,15 +150,32 @@ func Load() *Config {
 		HistorySize:          getEnvInt("VIBE_HISTORY_SIZE", 100),
 		HistoryKey:           getEnv("VIBE_HISTORY_KEY", "^Xh"),
 		RegenerateKey:        getEnv("VIBE_REGENERATE_KEY", "^Xg"),
+		StateDir:             getEnv("VIBE_STATE_DIR", ""),
+		UseDaemon:            getEnvBool("VIBE_USE_DAEMON", true),
+		DaemonIdleTimeout:    getEnvDuration("VIBE_DAEMON_IDLE_TIMEOUT", 30*time.Minute),
+		PolicyFile:           getEnv("VIBE_POLICY_FILE", ""),
+		Redact:               getEnvBool("VIBE_REDACT", true),
+		AuditLog:             getEnv("VIBE_AUDIT_LOG", ""),
+		AuditMaxSizeMB:       getEnvInt("VIBE_AUDIT_MAX_SIZE_MB", 10),
+		AuditKeep:            getEnvInt("VIBE_AUDIT_KEEP", 5),
+		AuditHashChain:       getEnvBool("VIBE_AUDIT_HASH_CHAIN", false),
+		Providers:            file.Providers,
+		HostPatterns:         hosts,
+		RedactPatterns:       file.RedactPatterns,
+		FileError:            fileErr,
 	}
 }
 
 // inferProvider guesses the gollm provider name from the configured API URL.
 // This keeps existing OpenAI-compatible setups working without requiring users
 // to set VIBE_PROVIDER. Set VIBE_PROVIDER explicitly to override (e.g. "anthropic").
-func inferProvider(apiURL string) string {
+// Hosts vibe doesn't recognize are looked up in the config file's host table
+// before falling back to openai-compatible.
+func inferProvider(apiURL string, hosts []HostPattern) string {
 	host := strings.ToLower(apiURL)
 	switch {
+	case strings.Contains(host, ".openai.azure.com"):
+		return ProviderAzureOpenAI
 	case strings.Contains(host, "openrouter.ai"):
 		return "openrouter"
 	case strings.Contains(host, "api.anthropic.com"):
@@ -109,6 +196,9 @@ func inferProvider(apiURL string) string {
 		// LM Studio default port; the lmstudio provider honors a custom endpoint.
 		return "lmstudio"
 	default:
+		if provider, ok := matchHost(hosts, apiURL); ok {
+			return provider
+		}
 		// A custom host we don't recognize. Use the openai-compatible
 		// provider, which honors VIBE_API_URL AND sends a Bearer token —
 		// unlike gollm's "openai" provider, which is hardcoded to
@@ -157,6 +247,21 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvHeaders parses headers written as "Name: value; Other-Name: value".
+// Entries without a colon are ignored.
+func getEnvHeaders(key string) map[string]string {
+	headers := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(key), ";") {
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
 func getEnvFloat(key string, defaultValue float64) float64 {
 	if value := os.Getenv(key); value != "" {
 		if f, err := strconv.ParseFloat(value, 64); err == nil {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -56,13 +57,15 @@ func TestInferProvider(t *testing.T) {
 		{"https://api.deepseek.com", "deepseek"},
 		{"http://localhost:11434/v1", "ollama"},
 		{"http://localhost:1234/v1", "lmstudio"},
+		{"https://contoso.openai.azure.com", ProviderAzureOpenAI},
+		{"https://contoso.openai.azure.com/openai/deployments/gpt-4o", ProviderAzureOpenAI},
 		// Unknown custom gateways must NOT default to "openai" (which would
 		// silently target api.openai.com and ignore the URL).
 		{"https://api.ai.rwx.dev/v1", ProviderOpenAICompatible},
 		{"https://my-gateway.example.com/v1", ProviderOpenAICompatible},
 	}
 	for _, c := range cases {
-		if got := inferProvider(c.apiURL); got != c.want {
+		if got := inferProvider(c.apiURL, nil); got != c.want {
 			t.Errorf("inferProvider(%q) = %q, want %q", c.apiURL, got, c.want)
 		}
 	}
@@ -107,3 +110,132 @@ func TestLoadDefaults(t *testing.T) {
 		t.Errorf("Default StrictValidation = %v, want true", cfg.StrictValidation)
 	}
 }
+
+func TestGetEnvHeaders(t *testing.T) {
+	t.Setenv("VIBE_EXTRA_HEADERS", "X-Team: infra; X-Route: a:b ;malformed; : empty")
+
+	headers := getEnvHeaders("VIBE_EXTRA_HEADERS")
+	if len(headers) != 2 {
+		t.Fatalf("headers = %v, want 2 entries", headers)
+	}
+	if headers["X-Team"] != "infra" {
+		t.Errorf("X-Team = %q, want infra", headers["X-Team"])
+	}
+	if headers["X-Route"] != "a:b" {
+		t.Errorf("X-Route = %q, want a:b", headers["X-Route"])
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	f, err := parseFile([]byte(`{
+		"providers": {"mycorp": {"base_url": "https://llm.corp.example/v1", "models": {"fast": "llama-3.1-8b"}}},
+		"hosts": {"*.corp.example": "mycorp", "llm.corp.example": "openai-compatible"}
+	}`))
+	if err != nil {
+		t.Fatalf("parseFile: %v", err)
+	}
+	p := f.Providers["mycorp"]
+	if p.Name != "mycorp" || p.Dialect != DialectOpenAI {
+		t.Errorf("provider = %+v, want name mycorp and the openai dialect", p)
+	}
+
+	// The exact host is more specific than the wildcard.
+	hosts := f.hostPatterns()
+	cases := map[string]string{
+		"https://llm.corp.example/v1":   ProviderOpenAICompatible,
+		"https://other.corp.example/v1": "mycorp",
+		"https://api.openai.com/v1":     "openai",
+		"https://corp.example.org/v1":   ProviderOpenAICompatible,
+	}
+	for apiURL, want := range cases {
+		if got := inferProvider(apiURL, hosts); got != want {
+			t.Errorf("inferProvider(%q) = %q, want %q", apiURL, got, want)
+		}
+	}
+}
+
+func TestParseFileRejectsInvalidProviders(t *testing.T) {
+	for _, data := range []string{
+		`{"providers": {"openai": {"base_url": "https://example.com"}}}`,
+		`{"providers": {"x": {}}}`,
+		`{"providers": {"x": {"base_url": "https://example.com", "dialect": "soap"}}}`,
+		`{"hosts": {"[": "x"}}`,
+		`{"redact_patterns": ["("]}`,
+		`not json`,
+	} {
+		if _, err := parseFile([]byte(data)); err == nil {
+			t.Errorf("parseFile(%s) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{
+		"providers": {"mycorp": {"base_url": "https://llm.corp.example/v1", "models": {"fast": "llama-3.1-8b"}}},
+		"hosts": {"*.corp.example": "mycorp"}
+	}`), 0600)
+	t.Setenv("VIBE_CONFIG_FILE", path)
+	t.Setenv("VIBE_API_URL", "https://llm.corp.example/v1")
+	t.Setenv("VIBE_MODEL", "fast")
+
+	cfg := Load()
+	if cfg.FileError != nil {
+		t.Fatalf("FileError = %v", cfg.FileError)
+	}
+	if cfg.Provider != "mycorp" {
+		t.Errorf("Provider = %q, want mycorp", cfg.Provider)
+	}
+	if got := cfg.ResolvedModel(); got != "llama-3.1-8b" {
+		t.Errorf("ResolvedModel = %q, want llama-3.1-8b", got)
+	}
+
+	t.Setenv("VIBE_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	if cfg := Load(); cfg.FileError == nil {
+		t.Error("Load with a missing VIBE_CONFIG_FILE reported no error")
+	}
+}
+
+func TestFingerprintIgnoresPresentation(t *testing.T) {
+	cfg := Load()
+	base := cfg.Fingerprint()
+
+	cfg.ShowExplanation = !cfg.ShowExplanation
+	cfg.InteractiveMode = true
+	cfg.StreamDelay = time.Second
+	if got := cfg.Fingerprint(); got != base {
+		t.Error("presentation settings changed the fingerprint")
+	}
+
+	cfg.Model = "another-model"
+	if got := cfg.Fingerprint(); got == base {
+		t.Error("changing the model did not change the fingerprint")
+	}
+}
+
+func TestEnsureStateDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	cfg := &Config{StateDir: dir}
+
+	got, err := cfg.EnsureStateDir()
+	if err != nil {
+		t.Fatalf("EnsureStateDir: %v", err)
+	}
+	if got != dir {
+		t.Errorf("EnsureStateDir = %q, want %q", got, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("state directory mode = %o, want 700", perm)
+	}
+
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.EnsureStateDir(); err == nil {
+		t.Error("EnsureStateDir accepted a directory other users can read")
+	}
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Dialects a custom provider can speak.
+const (
+	DialectOpenAI    = "openai"    // POST {base_url}/chat/completions
+	DialectAnthropic = "anthropic" // POST {base_url}/messages
+	DialectOllama    = "ollama"    // POST {base_url}/api/generate
+)
+
+// builtinProviders are the provider names vibe and gollm already define.
+// Custom providers may not reuse them.
+var builtinProviders = map[string]bool{
+	"openai": true, "anthropic": true, "groq": true, "openrouter": true,
+	"deepseek": true, "google-openai": true, "mistral": true, "cohere": true,
+	"ollama": true, "lmstudio": true, "vllm": true,
+	ProviderOpenAICompatible: true, ProviderAzureOpenAI: true, ProviderLlamaCpp: true,
+}
+
+// File is the optional JSON config file at VIBE_CONFIG_FILE (default
+// ~/.config/vibe/config.json). Environment variables cover everything else;
+// the file holds settings that don't fit in one: provider definitions, the
+// host pattern table and redaction patterns.
+type File struct {
+	Providers map[string]CustomProvider `json:"providers"`
+
+	// Hosts maps VIBE_API_URL host patterns such as "*.corp.example" to a
+	// provider name. It is consulted when VIBE_PROVIDER is unset.
+	Hosts map[string]string `json:"hosts"`
+
+	// RedactPatterns are regular expressions for secrets the built-in
+	// detectors don't know, such as internal token formats.
+	RedactPatterns []string `json:"redact_patterns"`
+}
+
+// CustomProvider is a provider defined in the config file, e.g.
+//
+//	"mycorp": {
+//	  "base_url": "https://llm.corp.example/v1",
+//	  "dialect": "openai",
+//	  "auth": {"scheme": "header", "header": "X-Corp-Key", "api_key_env": "MYCORP_KEY"},
+//	  "headers": {"X-Team": "infra"},
+//	  "models": {"fast": "llama-3.1-8b-instruct"}
+//	}
+type CustomProvider struct {
+	Name    string            `json:"-"`
+	BaseURL string            `json:"base_url"`
+	Dialect string            `json:"dialect"`
+	Auth    CustomAuth        `json:"auth"`
+	Headers map[string]string `json:"headers"`
+
+	// Models maps aliases to the model names the provider knows, so
+	// VIBE_MODEL=fast can stand for a long model ID.
+	Models map[string]string `json:"models"`
+}
+
+// CustomAuth mirrors the VIBE_AUTH_* settings for a custom provider. The key
+// is read from the environment variable named by APIKeyEnv, falling back to
+// VIBE_API_KEY, so secrets stay out of the file.
+type CustomAuth struct {
+	Scheme       string `json:"scheme"`
+	Header       string `json:"header"`
+	Username     string `json:"username"`
+	APIKeyEnv    string `json:"api_key_env"`
+	TokenURL     string `json:"token_url"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	Scope        string `json:"scope"`
+}
+
+// HostPattern routes API URLs whose host matches Pattern to Provider.
+type HostPattern struct {
+	Pattern  string
+	Provider string
+}
+
+// configFilePath returns VIBE_CONFIG_FILE, or ~/.config/vibe/config.json
+// (honoring XDG_CONFIG_HOME). explicit reports whether the user named the
+// file, in which case it must exist.
+func configFilePath() (path string, explicit bool) {
+	if p := os.Getenv("VIBE_CONFIG_FILE"); p != "" {
+		return p, true
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "vibe", "config.json"), false
+}
+
+// FilePath returns the location of the config file, whether or not it exists.
+func FilePath() string {
+	p, _ := configFilePath()
+	return p
+}
+
+// loadFile reads and validates the config file. A missing file at the
+// default location is not an error.
+func loadFile() (*File, error) {
+	p, explicit := configFilePath()
+	if p == "" {
+		return &File{}, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return &File{}, nil
+		}
+		return &File{}, err
+	}
+
+	f, err := parseFile(data)
+	if err != nil {
+		return &File{}, fmt.Errorf("%s: %w", p, err)
+	}
+	return f, nil
+}
+
+func parseFile(data []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	for name, p := range f.Providers {
+		if builtinProviders[name] {
+			return nil, fmt.Errorf("provider %q is built in and cannot be redefined", name)
+		}
+		if p.BaseURL == "" {
+			return nil, fmt.Errorf("provider %q: base_url is required", name)
+		}
+		if u, err := url.Parse(p.BaseURL); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("provider %q: invalid base_url %q", name, p.BaseURL)
+		}
+		switch p.Dialect {
+		case DialectOpenAI, DialectAnthropic, DialectOllama:
+		case "":
+			p.Dialect = DialectOpenAI
+		default:
+			return nil, fmt.Errorf("provider %q: unknown dialect %q (want openai, anthropic or ollama)", name, p.Dialect)
+		}
+		p.Name = name
+		f.Providers[name] = p
+	}
+
+	for pattern := range f.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, pattern := range f.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+	}
+	return &f, nil
+}
+
+// hostPatterns returns the host table ordered from the most to the least
+// specific pattern (longest first), so "llm.corp.example" wins over
+// "*.corp.example" regardless of map order.
+func (f *File) hostPatterns() []HostPattern {
+	patterns := make([]HostPattern, 0, len(f.Hosts))
+	for pattern, provider := range f.Hosts {
+		patterns = append(patterns, HostPattern{Pattern: strings.ToLower(pattern), Provider: provider})
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i].Pattern) != len(patterns[j].Pattern) {
+			return len(patterns[i].Pattern) > len(patterns[j].Pattern)
+		}
+		return patterns[i].Pattern < patterns[j].Pattern
+	})
+	return patterns
+}
+
+// matchHost returns the provider of the first pattern matching apiURL's host.
+// Patterns containing a port are matched against host:port.
+func matchHost(patterns []HostPattern, apiURL string) (string, bool) {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	for _, p := range patterns {
+		host := strings.ToLower(u.Hostname())
+		if strings.Contains(p.Pattern, ":") {
+			host = strings.ToLower(u.Host)
+		}
+		if ok, _ := path.Match(p.Pattern, host); ok {
+			return p.Provider, true
+		}
+	}
+	return "", false
+}
+
+// CustomProvider returns the config-file definition of the selected provider.
+func (c *Config) CustomProvider() (CustomProvider, bool) {
+	p, ok := c.Providers[c.Provider]
+	return p, ok
+}
+
+// ResolvedModel returns the model to request: VIBE_MODEL, or the model it is
+// an alias for under the selected custom provider.
+func (c *Config) ResolvedModel() string {
+	if p, ok := c.CustomProvider(); ok {
+		if m, ok := p.Models[c.Model]; ok {
+			return m
+		}
+	}
+	return c.Model
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+)
+
+// EnsureStateDir returns the directory holding vibe's runtime state, such as
+// the daemon socket: VIBE_STATE_DIR, or $XDG_STATE_HOME/vibe (default
+// ~/.local/state/vibe). It is created readable by the current user only, and
+// refused if another user owns it or can access it, since anyone who can
+// reach the socket can send queries with the user's credentials.
+func (c *Config) EnsureStateDir() (string, error) {
+	dir := c.StateDir
+	if dir == "" {
+		base := os.Getenv("XDG_STATE_HOME")
+		if base == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			base = filepath.Join(home, ".local", "state")
+		}
+		dir = filepath.Join(base, "vibe")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return "", fmt.Errorf("state directory %s is owned by another user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("state directory %s is accessible by other users (mode %o); run: chmod 700 %s", dir, info.Mode().Perm(), dir)
+	}
+	return dir, nil
+}
+
+// Fingerprint identifies the settings that decide which command a query
+// produces and how it is requested: provider, model, credentials, generation
+// and network options, and the config file. Two processes with the same
+// fingerprint generate alike, so the CLI can hand a query to the daemon.
+// Presentation settings (explanations, spinner, streaming, history, key
+// bindings), the policy and the audit log are left out, as the CLI applies them itself.
+func (c *Config) Fingerprint() string {
+	generation := *c
+	generation.ShowExplanation = false
+	generation.ShowWarnings = false
+	generation.InteractiveMode = false
+	generation.PreviewFiles = false
+	generation.FillPlaceholders = false
+	generation.EnableDebugLogs = false
+	generation.ShowProgress = false
+	generation.ProgressStyle = ""
+	generation.StreamOutput = false
+	generation.StreamDelay = 0
+	generation.EnableHistory = false
+	generation.HistorySize = 0
+	generation.HistoryKey = ""
+	generation.RegenerateKey = ""
+	generation.StateDir = ""
+	generation.UseDaemon = false
+	generation.DaemonIdleTimeout = 0
+	generation.PolicyFile = ""
+	generation.AuditLog = ""
+	generation.AuditMaxSizeMB = 0
+	generation.AuditKeep = 0
+	generation.AuditHashChain = false
+	generation.FileError = nil
+
+	// Custom providers read their keys from the environment when the
+	// request is made, so those values count too.
+	var keyEnvs []string
+	for _, p := range c.Providers {
+		if p.Auth.APIKeyEnv != "" {
+			keyEnvs = append(keyEnvs, p.Auth.APIKeyEnv+"="+os.Getenv(p.Auth.APIKeyEnv))
+		}
+	}
+	sort.Strings(keyEnvs)
+
+	data, _ := json.Marshal(struct {
+		Config  Config
+		KeyEnvs []string
+	}{generation, keyEnvs})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
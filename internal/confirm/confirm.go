@@ -1,17 +1,31 @@
 package confirm
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/termenv"
+	"github.com/skymoore/vibe-zsh/internal/preview"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"mvdan.cc/sh/v3/syntax"
 )
 
+// defaultWidth is the dialog's width until the terminal reports its size.
+const defaultWidth = 72
+
+// typedPhrase is what confirms a dangerous command that has no single
+// target to type instead.
+const typedPhrase = "yes, run it"
+
 var (
 	titleStyle = lipgloss.NewStyle().
 			Bold(true).
@@ -24,8 +38,7 @@ var (
 			Padding(0, 1).
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(lipgloss.Color("241")). // Subtle gray border
-			MarginBottom(1).
-			Width(70) // Fixed width for wrapping
+			MarginBottom(1)
 
 	promptStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("117")) // Light blue
@@ -53,14 +66,112 @@ var (
 	cancelledStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("203")). // Red
 			Bold(true)
+
+	previewStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")). // Orange
+			Bold(true)
+
+	pathStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("250")) // Light gray
+
+	previewNoteStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("241")). // Gray
+				Italic(true)
+
+	explanationStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("250")) // Light gray
+
+	warningStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")) // Orange
+
+	statusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("86")). // Cyan
+			Italic(true)
+
+	// Safety levels by colour: green, orange, red.
+	safetyStyles = map[string]lipgloss.Style{
+		safety.Safe:      lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Bold(true),
+		safety.Caution:   lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true),
+		safety.Dangerous: lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true),
+	}
 )
 
+// Request is what the dialog asks about.
+type Request struct {
+	Command     string
+	Explanation []string
+	Warning     string
+	SafetyLevel string // safety.Safe, Caution or Dangerous; "" if unknown
+
+	// Preview lists the files the command would touch, if it was worked
+	// out; PreviewError says why it couldn't be. Leave both nil for
+	// commands with nothing to preview.
+	Preview      *preview.Result
+	PreviewError error
+
+	// CanRegenerate offers to ask for another command, which the caller
+	// does when Result.Regenerate is set.
+	CanRegenerate bool
+}
+
+// Result is what the user chose.
+type Result struct {
+	Confirmed  bool
+	Regenerate bool   // Asked for another command instead
+	Edited     bool   // Command was changed in the dialog
+	Command    string // The command to use, as edited
+}
+
 type model struct {
-	command   string
-	selected  bool // true = yes, false = no
-	confirmed bool
-	cancelled bool
-	width     int
+	command       string
+	explanation   []string
+	warning       string
+	safetyLevel   string
+	preview       *preview.Result
+	previewErr    error
+	canRegenerate bool
+	selected      bool // true = yes, false = no
+	confirmed     bool
+	cancelled     bool
+	regenerate    bool
+	edited        bool
+	width         int
+
+	editing bool
+	editor  textarea.Model
+	copy    func(string) error
+	status  string // Result of the last action, e.g. "Copied"
+
+	// phrase, when set, must be typed into input to confirm.
+	phrase string
+	typing bool
+	input  textinput.Model
+}
+
+// requiredPhrase returns what the user has to type to confirm command, or
+// "" if a keypress will do. Commands that come with a warning, that the
+// model rates anything but safe, or that the local analysis rates dangerous
+// need their target typed back (rm -rf build asks for "build"), or
+// typedPhrase when they have no single target. Without a level from the
+// model, the local analysis's level is used.
+func requiredPhrase(command, level, warning string) string {
+	local := safety.Analyze(command).Level
+	if level == "" {
+		level = local
+	}
+	if warning == "" && level == safety.Safe && local != safety.Dangerous {
+		return ""
+	}
+	if target := safety.Target(command); target != "" {
+		return target
+	}
+	return typedPhrase
+}
+
+// NeedsPhrase reports whether confirming req takes typing a phrase rather
+// than a keypress.
+func NeedsPhrase(req Request) bool {
+	return requiredPhrase(req.Command, req.SafetyLevel, req.Warning) != ""
 }
 
 func (m model) Init() tea.Cmd {
@@ -71,9 +182,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
+		if m.editing {
+			m.editor.SetWidth(m.boxWidth() - 2)
+		}
 		return m, nil
 
 	case tea.KeyMsg:
+		if m.editing {
+			return m.updateEditor(msg)
+		}
+		if m.typing {
+			return m.updateTyping(msg)
+		}
+		m.status = ""
 		switch {
 		case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c", "q", "esc"))):
 			m.cancelled = true
@@ -81,15 +202,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
 			if m.selected {
-				m.confirmed = true
-			} else {
-				m.cancelled = true
+				return m.accept()
 			}
+			m.cancelled = true
 			return m, tea.Quit
 
 		case key.Matches(msg, key.NewBinding(key.WithKeys("y"))):
-			m.confirmed = true
-			return m, tea.Quit
+			return m.accept()
 
 		case key.Matches(msg, key.NewBinding(key.WithKeys("n"))):
 			m.cancelled = true
@@ -103,12 +222,129 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case key.Matches(msg, key.NewBinding(key.WithKeys("tab"))):
 			m.selected = !m.selected
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("e"))):
+			return m, m.startEditing()
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("r"))):
+			if m.canRegenerate {
+				m.regenerate = true
+				return m, tea.Quit
+			}
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("c"))):
+			m.status = "Copied to clipboard"
+			if m.copy == nil {
+				m.status = "Copying is not available"
+			} else if err := m.copy(m.command); err != nil {
+				m.status = "Copy failed: " + err.Error()
+			}
 		}
 	}
 
 	return m, nil
 }
 
+// accept confirms the command, or for a dangerous one asks for the phrase.
+func (m model) accept() (tea.Model, tea.Cmd) {
+	if m.phrase == "" {
+		m.confirmed = true
+		return m, tea.Quit
+	}
+	m.input = textinput.New()
+	m.input.Prompt = "› "
+	m.input.Placeholder = m.phrase
+	m.typing = true
+	return m, m.input.Focus()
+}
+
+func (m model) updateTyping(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+		m.cancelled = true
+		return m, tea.Quit
+
+	case key.Matches(msg, key.NewBinding(key.WithKeys("esc"))):
+		m.typing = false
+		m.selected = false
+		return m, nil
+
+	case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
+		if strings.TrimSpace(m.input.Value()) == m.phrase {
+			m.confirmed = true
+			return m, tea.Quit
+		}
+		m.input.Reset()
+		m.status = fmt.Sprintf("That doesn't match; type %s exactly, or press esc", m.phrase)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// startEditing opens the command in a text area.
+func (m *model) startEditing() tea.Cmd {
+	m.editor = textarea.New()
+	m.editor.ShowLineNumbers = false
+	m.editor.Prompt = ""
+	m.editor.CharLimit = 0
+	// Enter saves; a command rarely needs a literal newline.
+	m.editor.KeyMap.InsertNewline.SetKeys("alt+enter", "ctrl+j")
+	m.editor.SetWidth(m.boxWidth() - 2)
+	m.editor.SetHeight(min(max(strings.Count(m.command, "\n")+3, 3), 10))
+	m.editor.SetValue(m.command)
+	m.editing = true
+	return m.editor.Focus()
+}
+
+func (m model) updateEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+		m.cancelled = true
+		return m, tea.Quit
+
+	case key.Matches(msg, key.NewBinding(key.WithKeys("esc"))):
+		m.editing = false
+		m.status = "Edit discarded"
+		return m, nil
+
+	case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
+		m.editing = false
+		edited := strings.TrimSpace(m.editor.Value())
+		if edited == "" || edited == m.command {
+			return m, nil
+		}
+		// The model's explanation and warning describe the old command;
+		// show the local analysis of the new one instead.
+		a := safety.Analyze(edited)
+		m.command = edited
+		m.edited = true
+		m.explanation = nil
+		m.warning = strings.Join(a.Reasons, "; ")
+		m.safetyLevel = a.Level
+		m.preview, m.previewErr = nil, nil
+		m.status = "Command edited"
+		if m.phrase = requiredPhrase(edited, a.Level, m.warning); m.phrase != "" {
+			m.selected = false
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.editor, cmd = m.editor.Update(msg)
+	return m, cmd
+}
+
+// boxWidth is the command box's width, borders excluded.
+func (m model) boxWidth() int {
+	if m.width <= 0 {
+		return defaultWidth
+	}
+	return max(m.width-2, 20)
+}
+
 func (m model) View() string {
 	if m.confirmed {
 		return ""
@@ -123,10 +359,72 @@ func (m model) View() string {
 	s.WriteString(titleStyle.Render("🎯 Execute this command?"))
 	s.WriteString("\n\n")
 
-	// Command in a box (will wrap automatically with fixed width)
-	s.WriteString(commandBoxStyle.Render(m.command))
+	// Command in a box as wide as the terminal, long pipelines broken
+	// at their operators
+	width := m.boxWidth()
+	if m.editing {
+		s.WriteString(commandBoxStyle.Width(width).Render(m.editor.View()))
+	} else {
+		s.WriteString(commandBoxStyle.Width(width).Render(wrapCommand(m.command, width-2)))
+	}
 	s.WriteString("\n\n")
 
+	// Safety level, warning and explanation
+	if style, ok := safetyStyles[m.safetyLevel]; ok {
+		s.WriteString(promptStyle.Render("Safety: "))
+		s.WriteString(style.Render(m.safetyLevel))
+		s.WriteString("\n")
+	}
+	if m.warning != "" {
+		s.WriteString(warningStyle.Width(width).Render("⚠️  " + m.warning))
+		s.WriteString("\n")
+	}
+	if len(m.explanation) > 0 {
+		if m.warning != "" || m.safetyLevel != "" {
+			s.WriteString("\n")
+		}
+		for _, line := range m.explanation {
+			s.WriteString(explanationStyle.Width(width).Render(line))
+			s.WriteString("\n")
+		}
+	}
+	if m.warning != "" || m.safetyLevel != "" || len(m.explanation) > 0 {
+		s.WriteString("\n")
+	}
+
+	// Files the command would touch
+	if preview := previewLines(m.preview, m.previewErr); len(preview) > 0 {
+		s.WriteString(previewStyle.Render(preview[0]))
+		s.WriteString("\n")
+		for _, line := range preview[1:] {
+			if strings.HasPrefix(line, "  ") {
+				s.WriteString(pathStyle.Render(line))
+			} else {
+				s.WriteString(previewNoteStyle.Render(line))
+			}
+			s.WriteString("\n")
+		}
+		s.WriteString("\n")
+	}
+
+	if m.editing {
+		s.WriteString(helpStyle.Render("enter: save • alt+enter: new line • esc: discard edit • ctrl+c: cancel"))
+		return s.String()
+	}
+
+	if m.typing {
+		s.WriteString(warningStyle.Width(width).Render(fmt.Sprintf("Type %s to run it:", m.phrase)))
+		s.WriteString("\n")
+		s.WriteString(m.input.View())
+		s.WriteString("\n")
+		if m.status != "" {
+			s.WriteString(statusStyle.Render(m.status))
+			s.WriteString("\n")
+		}
+		s.WriteString(helpStyle.Render("enter: run • esc: back • ctrl+c: cancel"))
+		return s.String()
+	}
+
 	// Prompt with Yes/No options
 	s.WriteString(promptStyle.Render("Confirm: "))
 
@@ -145,22 +443,113 @@ func (m model) View() string {
 	s.WriteString("\n")
 
 	// Outcome preview
-	if m.selected {
+	switch {
+	case m.selected && m.phrase != "":
+		s.WriteString(outcomeStyle.Render(fmt.Sprintf("→ You will be asked to type %s first", m.phrase)))
+	case m.selected:
 		s.WriteString(outcomeStyle.Render("→ Command will be inserted into your ZSH prompt"))
-	} else {
+	default:
 		s.WriteString(outcomeStyle.Render("→ Command will be discarded"))
 	}
 	s.WriteString("\n")
+	if m.status != "" {
+		s.WriteString(statusStyle.Render(m.status))
+		s.WriteString("\n")
+	}
 
 	// Help
-	s.WriteString(helpStyle.Render("← → / h l / tab: toggle • enter: confirm • y: yes • n: no • esc: cancel"))
+	help := "← → / h l / tab: toggle • enter: confirm • y: yes • n: no • e: edit"
+	if m.canRegenerate {
+		help += " • r: regenerate"
+	}
+	help += " • c: copy • esc: cancel"
+	s.WriteString(helpStyle.Width(width).Render(help))
 
 	return s.String()
 }
 
+// wrapCommand puts each part of a pipeline or && / || list on its own
+// line, operator first, when command is wider than width. Operators inside
+// quotes, subshells and substitutions are left alone.
+func wrapCommand(command string, width int) string {
+	if lipgloss.Width(command) <= width || strings.Contains(command, "\n") {
+		return command
+	}
+	f, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil || len(f.Stmts) != 1 {
+		return command
+	}
+
+	var ops []int
+	var collect func(s *syntax.Stmt)
+	collect = func(s *syntax.Stmt) {
+		b, ok := s.Cmd.(*syntax.BinaryCmd)
+		if !ok || s.Background || s.Negated {
+			return
+		}
+		collect(b.X)
+		ops = append(ops, int(b.OpPos.Offset()))
+		collect(b.Y)
+	}
+	collect(f.Stmts[0])
+	if len(ops) == 0 {
+		return command
+	}
+
+	lines := []string{strings.TrimSpace(command[:ops[0]])}
+	for i, op := range ops {
+		end := len(command)
+		if i+1 < len(ops) {
+			end = ops[i+1]
+		}
+		lines = append(lines, "  "+strings.TrimSpace(command[op:end]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// previewLines describes a preview as a heading, the sample paths (indented)
+// and a note on any not listed. It returns nothing when there was nothing to
+// preview.
+func previewLines(r *preview.Result, err error) []string {
+	if err != nil {
+		return []string{"Preview unavailable", err.Error()}
+	}
+	if r == nil {
+		return nil
+	}
+	if r.Total == 0 {
+		return []string{fmt.Sprintf("Would %s nothing: no paths match", r.Action)}
+	}
+
+	count := fmt.Sprintf("%d", r.Total)
+	if r.Truncated {
+		count = "at least " + count
+	}
+	noun := "paths"
+	if r.Total == 1 {
+		noun = "path"
+	}
+	lines := []string{fmt.Sprintf("Would %s %s %s:", r.Action, count, noun)}
+	for _, p := range r.Paths {
+		lines = append(lines, "  "+p)
+	}
+	if more := r.Total - len(r.Paths); more > 0 || r.Truncated {
+		lines = append(lines, fmt.Sprintf("... and %d more", more))
+	}
+	return lines
+}
+
 // ShowConfirmation displays an interactive confirmation prompt for a command
 // Returns true if user confirms, false if cancelled
 func ShowConfirmation(command string) (bool, error) {
+	res, err := Confirm(Request{Command: command})
+	return res.Confirmed, err
+}
+
+// Confirm is ShowConfirmation with the details in req shown alongside the
+// command, and the command as edited in the dialog returned with the
+// choice.
+func Confirm(req Request) (Result, error) {
 	// Force color output for lipgloss
 	lipgloss.SetColorProfile(termenv.TrueColor)
 
@@ -168,44 +557,89 @@ func ShowConfirmation(command string) (bool, error) {
 	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
 		// Fallback to simple prompt if no TTY
-		return simpleConfirm(command)
+		return simpleConfirm(req, os.Stdin, os.Stderr)
 	}
 	defer tty.Close()
 
+	// A risky command defaults to No and has to be typed back.
+	phrase := requiredPhrase(req.Command, req.SafetyLevel, req.Warning)
+
 	m := model{
-		command:  command,
-		selected: true, // Default to "Yes" for fast workflow
+		command:       req.Command,
+		explanation:   req.Explanation,
+		warning:       req.Warning,
+		safetyLevel:   req.SafetyLevel,
+		preview:       req.Preview,
+		previewErr:    req.PreviewError,
+		canRegenerate: req.CanRegenerate,
+		selected:      phrase == "", // Default to "Yes" for fast workflow
+		phrase:        phrase,
+		copy: func(s string) error {
+			if clipboard.WriteAll(s) == nil {
+				return nil
+			}
+			// No clipboard tool (e.g. over ssh): ask the terminal.
+			termenv.NewOutput(tty).Copy(s)
+			return nil
+		},
 	}
 
 	// Use /dev/tty for both input and output
 	p := tea.NewProgram(m, tea.WithInput(tty), tea.WithOutput(tty))
 	finalModel, err := p.Run()
 	if err != nil {
-		return false, err
+		return Result{Command: req.Command}, err
 	}
 
 	if m, ok := finalModel.(model); ok {
-		return m.confirmed && !m.cancelled, nil
+		return Result{
+			Confirmed:  m.confirmed && !m.cancelled,
+			Regenerate: m.regenerate,
+			Edited:     m.edited,
+			Command:    m.command,
+		}, nil
 	}
 
-	return false, nil
+	return Result{Command: req.Command}, nil
 }
 
-// simpleConfirm is a fallback for when TTY is not available
-func simpleConfirm(command string) (bool, error) {
-	fmt.Fprintf(os.Stderr, "\n---\n%s\n---\n", command)
-	fmt.Fprint(os.Stderr, "Execute this command? [Y/n] ")
+// simpleConfirm is a fallback for when TTY is not available. An empty
+// answer means yes, except for a risky command (see requiredPhrase), which
+// is only run if its phrase is typed.
+func simpleConfirm(req Request, in io.Reader, out io.Writer) (Result, error) {
+	res := Result{Command: req.Command}
+	fmt.Fprintf(out, "\n---\n%s\n---\n", req.Command)
+	if req.SafetyLevel != "" {
+		fmt.Fprintf(out, "Safety: %s\n", req.SafetyLevel)
+	}
+	if req.Warning != "" {
+		fmt.Fprintf(out, "Warning: %s\n", req.Warning)
+	}
+	for _, line := range req.Explanation {
+		fmt.Fprintf(out, "# %s\n", line)
+	}
+	for _, line := range previewLines(req.Preview, req.PreviewError) {
+		fmt.Fprintln(out, line)
+	}
 
-	var response string
-	_, err := fmt.Scanln(&response)
-	if err != nil && err != io.EOF {
-		return false, err
+	phrase := requiredPhrase(req.Command, req.SafetyLevel, req.Warning)
+	if phrase == "" {
+		fmt.Fprint(out, "Execute this command? [Y/n] ")
+	} else {
+		fmt.Fprintf(out, "Type %s to run it: ", phrase)
 	}
 
-	// Default to yes if empty or starts with y/Y
-	if response == "" || response[0] == 'y' || response[0] == 'Y' {
-		return true, nil
+	response, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return res, err
 	}
+	response = strings.TrimSpace(response)
 
-	return false, nil
+	if phrase != "" {
+		res.Confirmed = response == phrase
+		return res, nil
+	}
+	// Default to yes if empty or starts with y/Y
+	res.Confirmed = response == "" || response[0] == 'y' || response[0] == 'Y'
+	return res, nil
 }
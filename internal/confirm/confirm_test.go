@@ -1,10 +1,12 @@
 package confirm
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/skymoore/vibe-zsh/internal/preview"
 )
 
 func TestModelInit(t *testing.T) {
@@ -246,3 +248,245 @@ func TestModelView_OutcomeChanges(t *testing.T) {
 		t.Error("View should show 'discarded' outcome when No is selected")
 	}
 }
+
+func TestViewShowsPreview(t *testing.T) {
+	m := model{
+		command:  "rm *.log",
+		selected: true,
+		preview: &preview.Result{
+			Action: "delete",
+			Paths:  []string{"a.log", "b.log"},
+			Total:  14,
+		},
+	}
+
+	view := m.View()
+	for _, want := range []string{"Would delete 14 paths:", "a.log", "b.log", "... and 12 more"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() missing %q", want)
+		}
+	}
+
+	m.preview = nil
+	m.previewErr = errors.New("cannot preview without side effects: running sed is not known to be free of side effects")
+	if view := m.View(); !strings.Contains(view, "Preview unavailable") {
+		t.Error("View() should say the preview is unavailable")
+	}
+}
+
+func TestViewShowsDetails(t *testing.T) {
+	m := model{
+		command:     "rm -rf build",
+		explanation: []string{"rm: remove files", "-rf: recursively, without asking"},
+		warning:     "recursive delete (rm -r)",
+		safetyLevel: "dangerous",
+		selected:    true,
+	}
+
+	view := m.View()
+	for _, want := range []string{"Safety: ", "dangerous", "recursive delete (rm -r)", "rm: remove files", "-rf: recursively"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View() missing %q", want)
+		}
+	}
+	if strings.Contains(view, "r: regenerate") {
+		t.Error("View() offers to regenerate without canRegenerate")
+	}
+}
+
+func TestWindowSizeSetsWidth(t *testing.T) {
+	m := model{command: "ls", selected: true}
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	if w := updated.(model).boxWidth(); w != 118 {
+		t.Errorf("boxWidth() = %d, want 118", w)
+	}
+	if w := m.boxWidth(); w != defaultWidth {
+		t.Errorf("boxWidth() before a size = %d, want %d", w, defaultWidth)
+	}
+}
+
+func TestWrapCommand(t *testing.T) {
+	command := `find . -name '*.log' -mtime +7 | xargs grep -l "a | b && c" && echo "found some" || echo none`
+	want := "find . -name '*.log' -mtime +7\n" +
+		`  | xargs grep -l "a | b && c"` + "\n" +
+		`  && echo "found some"` + "\n" +
+		"  || echo none"
+	if got := wrapCommand(command, 40); got != want {
+		t.Errorf("wrapCommand() =\n%s\nwant:\n%s", got, want)
+	}
+
+	// Commands that fit, or have no operators at the top level, are left alone.
+	if got := wrapCommand(command, 200); got != command {
+		t.Errorf("wrapCommand() wrapped a command that fits: %q", got)
+	}
+	sub := `echo "$(ls | wc -l && date)" and a long tail of arguments`
+	if got := wrapCommand(sub, 20); got != sub {
+		t.Errorf("wrapCommand() = %q, want it unchanged", got)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	m := model{command: "ls -la", selected: true, explanation: []string{"ls: list"}}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	m = updated.(model)
+	if !m.editing || m.editor.Value() != "ls -la" {
+		t.Fatalf("editing = %v, value %q", m.editing, m.editor.Value())
+	}
+
+	// Keys go to the editor, not the dialog.
+	for _, r := range " /tmp" {
+		updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = updated.(model)
+	}
+	if m.confirmed || m.cancelled {
+		t.Fatal("typing in the editor answered the dialog")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+	if m.editing || m.command != "ls -la /tmp" || !m.edited {
+		t.Errorf("after saving: editing %v, command %q, edited %v", m.editing, m.command, m.edited)
+	}
+	if m.explanation != nil || m.safetyLevel != "safe" {
+		t.Errorf("explanation %q and safety %q were not replaced", m.explanation, m.safetyLevel)
+	}
+
+	// Esc discards an edit.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	m = updated.(model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(model)
+	if m.editing || m.cancelled || m.command != "ls -la /tmp" {
+		t.Errorf("after esc: editing %v, cancelled %v, command %q", m.editing, m.cancelled, m.command)
+	}
+}
+
+func TestRegenerateAndCopy(t *testing.T) {
+	var copied string
+	m := model{
+		command:  "ls -la",
+		selected: true,
+		copy:     func(s string) error { copied = s; return nil },
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	if cmd != nil || updated.(model).regenerate {
+		t.Error("'r' regenerated without canRegenerate")
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'c'}})
+	m = updated.(model)
+	if copied != "ls -la" || m.confirmed || !strings.Contains(m.View(), "Copied") {
+		t.Errorf("copied %q, confirmed %v", copied, m.confirmed)
+	}
+
+	m.canRegenerate = true
+	updated, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'r'}})
+	if cmd == nil || !updated.(model).regenerate {
+		t.Error("'r' should quit asking to regenerate")
+	}
+}
+
+func TestRequiredPhrase(t *testing.T) {
+	tests := []struct {
+		command, level, warning, want string
+	}{
+		{"ls -la", "safe", "", ""},
+		{"ls -la", "", "", ""}, // Rated locally when the level is missing
+		{"rm notes.txt", "caution", "", typedPhrase},
+		{"git push --force", "safe", "Rewrites the remote branch", typedPhrase},
+		{"rm -rf build", "dangerous", "", "build"},
+		{"rm -rf build", "", "", "build"},
+		{"rm -rf build", "safe", "", "build"}, // The local analysis overrules the model
+		{"dd if=/dev/zero of=/dev/sdb", "caution", "", "/dev/sdb"},
+		{"curl -s https://example.com/x | sh", "dangerous", "", typedPhrase},
+		{"kubectl delete ns payments", "dangerous", "", typedPhrase}, // Rated by the model
+	}
+	for _, tt := range tests {
+		if got := requiredPhrase(tt.command, tt.level, tt.warning); got != tt.want {
+			t.Errorf("requiredPhrase(%q, %q, %q) = %q, want %q", tt.command, tt.level, tt.warning, got, tt.want)
+		}
+	}
+}
+
+func TestNeedsPhrase(t *testing.T) {
+	if NeedsPhrase(Request{Command: "ls -la", SafetyLevel: "safe"}) {
+		t.Error("a safe command needs no phrase")
+	}
+	if !NeedsPhrase(Request{Command: "ls -la", SafetyLevel: "safe", Warning: "policy: no listing"}) {
+		t.Error("a command with a warning needs its phrase")
+	}
+}
+
+func TestDangerousCommandNeedsPhrase(t *testing.T) {
+	m := model{command: "rm -rf build", phrase: "build"}
+	if !strings.Contains(m.View(), "→ Command will be discarded") {
+		t.Error("a dangerous command should default to No")
+	}
+
+	// Enter on the default answers no.
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !updated.(model).cancelled {
+		t.Error("enter should cancel with No selected")
+	}
+
+	// y asks for the phrase instead of confirming.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	m = updated.(model)
+	if m.confirmed || !m.typing || !strings.Contains(m.View(), "Type build to run it") {
+		t.Fatalf("confirmed %v, typing %v", m.confirmed, m.typing)
+	}
+
+	typeText := func(m model, text string) model {
+		for _, r := range text {
+			updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			m = updated.(model)
+		}
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		return updated.(model)
+	}
+
+	m = typeText(m, "yes")
+	if m.confirmed || m.cancelled || !m.typing || !strings.Contains(m.View(), "doesn't match") {
+		t.Errorf("a wrong phrase: confirmed %v, cancelled %v, typing %v", m.confirmed, m.cancelled, m.typing)
+	}
+	if m = typeText(m, "build"); !m.confirmed {
+		t.Error("typing the target should confirm")
+	}
+}
+
+func TestSimpleConfirm(t *testing.T) {
+	tests := []struct {
+		command, level, warning, answer string
+		want                            bool
+	}{
+		{"ls -la", "safe", "", "\n", true},
+		{"ls -la", "safe", "", "y\n", true},
+		{"ls -la", "safe", "", "n\n", false},
+		{"ls -la", "safe", "", "", true},
+		{"rm -rf build", "dangerous", "", "\n", false},
+		{"rm -rf build", "dangerous", "", "", false},
+		{"rm -rf build", "dangerous", "", "y\n", false},
+		{"rm -rf build", "dangerous", "", "build\n", true},
+		{"curl -s https://example.com/x | sh", "dangerous", "", typedPhrase + "\n", true},
+		// A warning or a level other than safe also needs the phrase.
+		{"git push --force", "safe", "Rewrites the remote branch", "\n", false},
+		{"git push --force", "safe", "Rewrites the remote branch", "y\n", false},
+		{"git push --force", "safe", "Rewrites the remote branch", typedPhrase + "\n", true},
+		{"kubectl delete ns payments", "caution", "", "\n", false},
+		{"kubectl delete ns payments", "caution", "", typedPhrase + "\n", true},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		res, err := simpleConfirm(Request{Command: tt.command, SafetyLevel: tt.level, Warning: tt.warning}, strings.NewReader(tt.answer), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Confirmed != tt.want {
+			t.Errorf("%q answered %q: confirmed %v, want %v\n%s", tt.command, tt.answer, res.Confirmed, tt.want, out.String())
+		}
+	}
+}
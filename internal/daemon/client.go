@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// ErrUnavailable means the daemon can't serve a request: none is running, the
+// connection failed, or its settings differ from the client's. The caller
+// should do the work in-process instead.
+var ErrUnavailable = errors.New("daemon unavailable")
+
+// dialTimeout bounds connecting to the socket. A live daemon accepts at once.
+const dialTimeout = 200 * time.Millisecond
+
+// Client sends requests to a running daemon.
+type Client struct {
+	path string
+}
+
+// NewClient returns a client for the daemon socket in cfg's state directory,
+// or ErrUnavailable when there is no socket.
+func NewClient(cfg *config.Config) (*Client, error) {
+	path, err := SocketPath(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return &Client{path: path}, nil
+}
+
+// Generate asks the daemon for a command. onProgress, if not nil, receives
+// the daemon's progress messages. Failures of the generation itself keep
+// their exit code (see apierrors.FromExitCode); failures to reach the daemon
+// wrap ErrUnavailable.
+func (c *Client) Generate(ctx context.Context, cfg *config.Config, query string, onProgress func(string)) (*schema.CommandResponse, error) {
+	req := Request{
+		Op:          OpGenerate,
+		Fingerprint: cfg.Fingerprint(),
+		Query:       query,
+		Progress:    onProgress != nil,
+	}
+	m, err := c.do(ctx, req, onProgress)
+	if err != nil {
+		return nil, err
+	}
+	if m.ConfigMismatch {
+		return nil, fmt.Errorf("%w: its configuration differs (restart it to pick up environment changes)", ErrUnavailable)
+	}
+	if m.Response == nil {
+		return nil, fmt.Errorf("%w: empty reply", ErrUnavailable)
+	}
+	return m.Response, nil
+}
+
+// AddHistory records a generated command in the daemon's history.
+func (c *Client) AddHistory(query, command string) error {
+	_, err := c.do(context.Background(), Request{Op: OpHistoryAdd, Query: query, Command: command}, nil)
+	return err
+}
+
+// Ping returns the daemon's process ID.
+func (c *Client) Ping() (int, error) {
+	m, err := c.do(context.Background(), Request{Op: OpPing}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return m.PID, nil
+}
+
+// Shutdown asks the daemon to stop.
+func (c *Client) Shutdown() error {
+	_, err := c.do(context.Background(), Request{Op: OpShutdown}, nil)
+	return err
+}
+
+// do sends req and reads replies up to the final message. Closing the
+// connection when ctx is done tells the daemon to stop working on req.
+func (c *Client) do(ctx context.Context, req Request, onProgress func(string)) (Message, error) {
+	conn, err := net.DialTimeout("unix", c.path, dialTimeout)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var m Message
+		if err := dec.Decode(&m); err != nil {
+			if ctx.Err() != nil {
+				return Message{}, ctx.Err()
+			}
+			return Message{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		if m.Progress != "" {
+			if onProgress != nil {
+				onProgress(m.Progress)
+			}
+			continue
+		}
+		if m.Error != "" {
+			return Message{}, apierrors.FromExitCode(m.ExitCode, m.Error)
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,282 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+)
+
+const validCompletion = `{"command":"ls -la","explanation":["ls: list directory contents"]}`
+
+// chatServer answers every request with validCompletion and counts them.
+func chatServer(t *testing.T, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": validCompletion}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func testConfig(t *testing.T, url string) *config.Config {
+	t.Helper()
+	t.Setenv("VIBE_CONFIG_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	return &config.Config{
+		Provider:             "vllm",
+		APIURL:               url,
+		Model:                "test-model",
+		Temperature:          0.2,
+		MaxTokens:            100,
+		Timeout:              5 * time.Second,
+		Deadline:             10 * time.Second,
+		MaxRetries:           1,
+		UseStructuredOutput:  true,
+		EnableJSONExtraction: true,
+		StrictValidation:     true,
+		EnableCache:          true,
+		CacheDir:             t.TempDir(),
+		CacheTTL:             time.Hour,
+		HistorySize:          10,
+		StateDir:             filepath.Join(t.TempDir(), "state"),
+	}
+}
+
+// startServer runs a daemon for cfg until the test ends and returns a client
+// for it.
+func startServer(t *testing.T, cfg *config.Config, opts Options) (*Server, *Client, <-chan error) {
+	t.Helper()
+	s := NewServer(cfg, opts)
+	s.poll = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	finished := make(chan struct{})
+	go func() {
+		done <- s.Serve(ctx)
+		close(finished)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-finished
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c, err := NewClient(cfg)
+		if err == nil {
+			if _, err = c.Ping(); err == nil {
+				return s, c, done
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("daemon did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGenerateThroughDaemon(t *testing.T) {
+	srv, requests := chatServer(t, http.StatusOK)
+	cfg := testConfig(t, srv.URL)
+	_, c, _ := startServer(t, cfg, Options{})
+
+	var progress []string
+	resp, err := c.Generate(context.Background(), cfg, "list files", func(msg string) {
+		progress = append(progress, msg)
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+	if len(progress) == 0 {
+		t.Error("no progress messages were forwarded")
+	}
+
+	// The second query is answered from the daemon's cache.
+	if _, err := c.Generate(context.Background(), cfg, "list files", nil); err != nil {
+		t.Fatalf("Generate (cached): %v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
+
+func TestGenerateKeepsExitCode(t *testing.T) {
+	srv, _ := chatServer(t, http.StatusUnauthorized)
+	cfg := testConfig(t, srv.URL)
+	_, c, _ := startServer(t, cfg, Options{})
+
+	_, err := c.Generate(context.Background(), cfg, "list files", nil)
+	if !errors.Is(err, apierrors.ErrUnauthorized) {
+		t.Errorf("Generate error = %v, want ErrUnauthorized", err)
+	}
+	if errors.Is(err, ErrUnavailable) {
+		t.Error("a provider failure was reported as the daemon being unavailable")
+	}
+}
+
+func TestConfigMismatchIsUnavailable(t *testing.T) {
+	srv, requests := chatServer(t, http.StatusOK)
+	cfg := testConfig(t, srv.URL)
+	_, c, _ := startServer(t, cfg, Options{})
+
+	other := *cfg
+	other.Model = "another-model"
+	_, err := c.Generate(context.Background(), &other, "list files", nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Generate error = %v, want ErrUnavailable", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 0 {
+		t.Errorf("server saw %d requests, want 0", got)
+	}
+}
+
+func TestReloadOnConfigFileChange(t *testing.T) {
+	srv, _ := chatServer(t, http.StatusOK)
+	cfg := testConfig(t, srv.URL)
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("VIBE_CONFIG_FILE", file)
+
+	reloaded := *cfg
+	reloaded.Model = "reloaded-model"
+	_, c, _ := startServer(t, cfg, Options{
+		Load: func() (*config.Config, error) { return &reloaded, nil },
+	})
+
+	if err := os.WriteFile(file, []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Generate(context.Background(), &reloaded, "list files", nil)
+	if err != nil {
+		t.Fatalf("Generate with the reloaded configuration: %v", err)
+	}
+	if resp.Command != "ls -la" {
+		t.Errorf("Command = %q, want %q", resp.Command, "ls -la")
+	}
+}
+
+func TestIdleShutdown(t *testing.T) {
+	cfg := testConfig(t, "http://127.0.0.1:1")
+	_, _, done := startServer(t, cfg, Options{IdleTimeout: 50 * time.Millisecond})
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("daemon did not stop after the idle timeout")
+	}
+
+	path, _ := SocketPath(cfg)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket still exists after shutdown: %v", err)
+	}
+}
+
+func TestSocketIsPrivate(t *testing.T) {
+	cfg := testConfig(t, "http://127.0.0.1:1")
+	startServer(t, cfg, Options{})
+
+	path, err := SocketPath(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	if err := NewServer(cfg, Options{}).Serve(context.Background()); !errors.Is(err, ErrRunning) {
+		t.Errorf("second daemon: Serve = %v, want ErrRunning", err)
+	}
+}
+
+func TestAddHistoryAndShutdown(t *testing.T) {
+	cfg := testConfig(t, "http://127.0.0.1:1")
+	_, c, done := startServer(t, cfg, Options{})
+
+	if err := c.AddHistory("list files", "ls -la"); err != nil {
+		t.Fatalf("AddHistory: %v", err)
+	}
+	h, err := history.New(cfg.CacheDir, cfg.HistorySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := h.List()
+	if err != nil || len(entries) != 1 || entries[0].Command != "ls -la" {
+		t.Errorf("history = %v, %v; want the added entry", entries, err)
+	}
+
+	if err := c.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("daemon did not stop after a shutdown request")
+	}
+}
+
+// TestConcurrentAddHistory checks that connections adding history at the
+// same time don't lose each other's entries.
+func TestConcurrentAddHistory(t *testing.T) {
+	cfg := testConfig(t, "http://127.0.0.1:1")
+	_, c, _ := startServer(t, cfg, Options{})
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- c.AddHistory(fmt.Sprintf("query %d", i), fmt.Sprintf("echo %d", i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddHistory: %v", err)
+		}
+	}
+
+	h, err := history.New(cfg.CacheDir, cfg.HistorySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := h.List()
+	if err != nil || len(entries) != n {
+		t.Errorf("history has %d entries (%v), want %d", len(entries), err, n)
+	}
+}
@@ -0,0 +1,65 @@
+// Package daemon keeps a vibe client warm in a background process and serves
+// it to the CLI over a Unix socket in the state directory.
+//
+// Each connection carries one request and its replies, one JSON object per
+// line. A generate request is answered by any number of progress messages
+// followed by a final message holding the response or the error.
+package daemon
+
+import (
+	"path/filepath"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// Request operations.
+const (
+	OpGenerate   = "generate"    // Generate a command for Query
+	OpHistoryAdd = "history_add" // Record Query and Command in the history
+	OpPing       = "ping"        // Report that the daemon is running
+	OpShutdown   = "shutdown"    // Stop the daemon
+)
+
+// socketName is the daemon socket's file name in the state directory.
+const socketName = "daemon.sock"
+
+// Request is the first and only message a client sends on a connection.
+type Request struct {
+	Op string `json:"op"`
+
+	// Fingerprint is the client's config.Fingerprint. The daemon only
+	// generates for clients whose settings match its own.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	Query    string `json:"query,omitempty"`
+	Command  string `json:"command,omitempty"`
+	Progress bool   `json:"progress,omitempty"` // Send progress messages
+}
+
+// Message is a reply from the daemon. Every message except the last one of a
+// reply is a progress message.
+type Message struct {
+	Progress string                  `json:"progress,omitempty"`
+	Response *schema.CommandResponse `json:"response,omitempty"`
+
+	// Error and ExitCode describe a failed request (see apierrors.ExitCode).
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+
+	// ConfigMismatch is set instead of Error when the client's settings
+	// differ from the daemon's, so the client generates in-process.
+	ConfigMismatch bool `json:"config_mismatch,omitempty"`
+
+	PID int `json:"pid,omitempty"` // Ping replies only
+}
+
+// SocketPath returns the daemon socket's path in the state directory,
+// creating the directory if needed.
+func SocketPath(cfg *config.Config) (string, error) {
+	dir, err := cfg.EnsureStateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, socketName), nil
+}
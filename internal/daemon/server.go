@@ -0,0 +1,338 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+)
+
+// ErrRunning is returned by Serve when another daemon already listens on the
+// socket.
+var ErrRunning = errors.New("a vibe daemon is already running")
+
+// pollInterval is how often the daemon checks for idleness and for changes to
+// the config file.
+const pollInterval = 2 * time.Second
+
+// Options configure a Server.
+type Options struct {
+	// Load reads the configuration again after the config file changed.
+	// It should apply the same overrides as the initial configuration.
+	Load func() (*config.Config, error)
+
+	// IdleTimeout stops the daemon after this long without requests.
+	// Zero keeps it running until it is stopped.
+	IdleTimeout time.Duration
+
+	// Logf reports lifecycle events such as reloads. It defaults to
+	// logger.Debug.
+	Logf func(format string, args ...interface{})
+}
+
+// Server holds a client, its response cache and the history in memory and
+// serves them over the daemon socket.
+type Server struct {
+	opts Options
+	poll time.Duration
+
+	// mu serializes generation (a client handles one query at a time) and
+	// guards the fields below, which a reload replaces.
+	mu          sync.Mutex
+	cfg         *config.Config
+	fingerprint string
+	client      *client.Client
+	history     *history.History
+	fileStamp   fileStamp
+
+	// historyMu serializes history additions, each a read-modify-write of
+	// the history file, without waiting for generation.
+	historyMu sync.Mutex
+
+	activity sync.Mutex
+	active   int       // Connections being served
+	lastUsed time.Time // When the last connection finished
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewServer returns a server generating with cfg.
+func NewServer(cfg *config.Config, opts Options) *Server {
+	if opts.Logf == nil {
+		opts.Logf = logger.Debug
+	}
+	s := &Server{opts: opts, poll: pollInterval, stop: make(chan struct{})}
+	s.use(cfg)
+	s.fileStamp = stampOf(config.FilePath())
+	return s
+}
+
+// use switches to cfg, keeping the current client when cfg generates alike.
+func (s *Server) use(cfg *config.Config) {
+	fingerprint := cfg.Fingerprint()
+	if s.client != nil && fingerprint == s.fingerprint {
+		s.cfg = cfg
+		return
+	}
+
+	s.cfg = cfg
+	s.fingerprint = fingerprint
+	s.client = client.New(cfg)
+	s.history = nil
+	if h, err := history.New(cfg.CacheDir, cfg.HistorySize); err == nil {
+		s.history = h
+	}
+}
+
+// Serve listens on the daemon socket and serves requests until ctx is done,
+// a shutdown request arrives or the daemon has been idle for IdleTimeout.
+func (s *Server) Serve(ctx context.Context) error {
+	path, err := SocketPath(s.cfg)
+	if err != nil {
+		return err
+	}
+	return s.serve(ctx, path)
+}
+
+func (s *Server) serve(ctx context.Context, path string) error {
+	ln, err := listen(path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.activity.Lock()
+	s.lastUsed = time.Now()
+	s.activity.Unlock()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(ctx, conn)
+		}
+	}()
+
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stop:
+			return nil
+		case <-ticker.C:
+			if s.idle() {
+				s.opts.Logf("No requests for %s, stopping", s.opts.IdleTimeout)
+				return nil
+			}
+			s.mu.Lock()
+			s.reloadIfChanged()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// listen creates the socket, readable and writable by the current user only.
+// A socket left behind by a daemon that exited uncleanly is replaced.
+func listen(path string) (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", path, dialTimeout); err == nil {
+		conn.Close()
+		return nil, ErrRunning
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Shutdown stops Serve.
+func (s *Server) Shutdown() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *Server) idle() bool {
+	if s.opts.IdleTimeout <= 0 {
+		return false
+	}
+	s.activity.Lock()
+	defer s.activity.Unlock()
+	return s.active == 0 && time.Since(s.lastUsed) >= s.opts.IdleTimeout
+}
+
+func (s *Server) begin() {
+	s.activity.Lock()
+	s.active++
+	s.activity.Unlock()
+}
+
+func (s *Server) end() {
+	s.activity.Lock()
+	s.active--
+	s.lastUsed = time.Now()
+	s.activity.Unlock()
+}
+
+// reloadIfChanged reloads the configuration when the config file changed. A
+// file that fails to load is reported and the current configuration kept.
+// The caller holds s.mu.
+func (s *Server) reloadIfChanged() {
+	stamp := stampOf(config.FilePath())
+	if stamp == s.fileStamp || s.opts.Load == nil {
+		return
+	}
+	s.fileStamp = stamp
+
+	cfg, err := s.opts.Load()
+	if err != nil {
+		s.opts.Logf("Config file changed but could not be loaded, keeping the previous configuration: %v", err)
+		return
+	}
+	s.use(cfg)
+	s.opts.Logf("Config file changed, configuration reloaded")
+}
+
+// fileStamp identifies a version of a file. The zero value stands for a
+// missing file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	s.begin()
+	defer s.end()
+
+	r := bufio.NewReader(conn)
+	var req Request
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		logger.Debug("Daemon: invalid request: %v", err)
+		return
+	}
+	w := &replyWriter{enc: json.NewEncoder(conn)}
+
+	switch req.Op {
+	case OpGenerate:
+		// The client never writes after its request, so a finished read
+		// means it went away (e.g. Ctrl+C); stop working for it.
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			io.Copy(io.Discard, r)
+			cancel()
+		}()
+		w.send(s.generate(ctx, req, w))
+	case OpHistoryAdd:
+		w.send(s.addHistory(req))
+	case OpPing:
+		w.send(Message{PID: os.Getpid()})
+	case OpShutdown:
+		w.send(Message{})
+		s.Shutdown()
+	default:
+		w.send(Message{Error: fmt.Sprintf("unknown operation %q", req.Op), ExitCode: apierrors.ExitFailure})
+	}
+}
+
+func (s *Server) generate(ctx context.Context, req Request, w *replyWriter) Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reloadIfChanged()
+	if req.Fingerprint != s.fingerprint {
+		return Message{ConfigMismatch: true}
+	}
+
+	var status client.Status
+	if req.Progress {
+		status = &remoteStatus{w: w}
+	}
+	resp, err := s.client.GenerateCommandWithStatus(ctx, req.Query, status)
+	if err != nil {
+		return Message{Error: err.Error(), ExitCode: apierrors.ExitCode(err)}
+	}
+	return Message{Response: resp}
+}
+
+func (s *Server) addHistory(req Request) Message {
+	s.mu.Lock()
+	h := s.history
+	s.mu.Unlock()
+
+	if h == nil {
+		return Message{Error: "history is unavailable", ExitCode: apierrors.ExitFailure}
+	}
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+	if err := h.Add(req.Query, req.Command); err != nil {
+		return Message{Error: err.Error(), ExitCode: apierrors.ExitFailure}
+	}
+	return Message{}
+}
+
+// replyWriter sends messages on a connection. Progress messages come from
+// the generating goroutine, so sends are serialized.
+type replyWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *replyWriter) send(m Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(m); err != nil {
+		logger.Debug("Daemon: failed to reply: %v", err)
+	}
+}
+
+// remoteStatus forwards progress to the client, which shows it on its own
+// spinner.
+type remoteStatus struct {
+	w *replyWriter
+}
+
+func (s *remoteStatus) Start(_ context.Context, message string) { s.Update(message) }
+func (s *remoteStatus) Stop()                                   {}
+
+func (s *remoteStatus) Update(message string) {
+	// An empty message would read as the final one.
+	if message != "" {
+		s.w.send(Message{Progress: message})
+	}
+}
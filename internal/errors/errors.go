@@ -1,20 +1,42 @@
 package errors
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 var (
-	ErrTimeout       = errors.New("request timeout")
-	ErrRateLimit     = errors.New("rate limit exceeded")
-	ErrUnauthorized  = errors.New("unauthorized - check API key")
-	ErrBadRequest    = errors.New("bad request")
-	ErrServerError   = errors.New("server error")
-	ErrNoResponse    = errors.New("no response from API")
-	ErrInvalidJSON   = errors.New("invalid JSON response")
-	ErrEmptyResponse = errors.New("empty response")
+	ErrTimeout           = errors.New("request timeout")
+	ErrRateLimit         = errors.New("rate limit exceeded")
+	ErrUnauthorized      = errors.New("unauthorized - check API key")
+	ErrBadRequest        = errors.New("bad request")
+	ErrServerError       = errors.New("server error")
+	ErrNoResponse        = errors.New("no response from API")
+	ErrConnectionRefused = errors.New("connection refused")
+	ErrModelNotFound     = errors.New("model not found")
+	ErrContextLength     = errors.New("context length exceeded")
+	ErrInvalidJSON       = errors.New("invalid JSON response")
+	ErrEmptyResponse     = errors.New("empty response")
+	ErrPolicyBlocked     = errors.New("blocked by policy")
+)
+
+// Exit codes for each class of failure. They let callers such as the zsh
+// widget tell the user what went wrong without parsing stderr.
+const (
+	ExitFailure           = 1
+	ExitUnauthorized      = 10
+	ExitRateLimit         = 11
+	ExitModelNotFound     = 12
+	ExitConnectionRefused = 13
+	ExitTimeout           = 14
+	ExitContextLength     = 15
+	ExitServerError       = 16
+	ExitBadRequest        = 17
+	ExitNoResponse        = 18
+	ExitPolicyBlocked     = 19 // The command was generated but a policy rule blocks it
 )
 
 type APIError struct {
@@ -24,6 +46,9 @@ type APIError struct {
 }
 
 func (e *APIError) Error() string {
+	if detail := e.Detail(); detail != "" {
+		return fmt.Sprintf("API error (status %d): %s: %s", e.StatusCode, e.Message, detail)
+	}
 	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Message)
 }
 
@@ -32,31 +57,91 @@ func (e *APIError) IsRetryable() bool {
 		e.StatusCode >= 500
 }
 
+// Detail returns the provider's own error message from the response body.
+// OpenAI-style APIs nest it as {"error":{"message":...}}, Ollama sends
+// {"error":"..."}; anything else is returned as trimmed text.
+func (e *APIError) Detail() string {
+	body := strings.TrimSpace(e.Body)
+	if body == "" {
+		return ""
+	}
+
+	var parsed struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &parsed); err == nil {
+		var nested struct {
+			Message string `json:"message"`
+		}
+		var flat string
+		switch {
+		case json.Unmarshal(parsed.Error, &nested) == nil && nested.Message != "":
+			return nested.Message
+		case json.Unmarshal(parsed.Error, &flat) == nil && flat != "":
+			return flat
+		case parsed.Message != "":
+			return parsed.Message
+		}
+	}
+
+	const maxDetail = 200
+	if len(body) > maxDetail {
+		body = body[:maxDetail] + "..."
+	}
+	return body
+}
+
 func NewAPIError(statusCode int, body string) error {
 	err := &APIError{
 		StatusCode: statusCode,
 		Body:       body,
 	}
 
+	// Some failures share a status code with unrelated errors and can only
+	// be told apart by the provider's message.
+	lower := strings.ToLower(body)
+	switch {
+	case isContextLengthBody(lower) && (statusCode == http.StatusBadRequest || statusCode == http.StatusRequestEntityTooLarge):
+		err.Message = "Request is too long for the model's context window"
+		return fmt.Errorf("%w: %w", ErrContextLength, err)
+	case isModelNotFoundBody(lower) && (statusCode == http.StatusNotFound || statusCode == http.StatusBadRequest):
+		err.Message = "Model not found"
+		return fmt.Errorf("%w: %w", ErrModelNotFound, err)
+	}
+
 	switch statusCode {
 	case http.StatusBadRequest:
 		err.Message = "Bad request - check your configuration"
-		return fmt.Errorf("%w: %s", ErrBadRequest, err.Error())
+		return fmt.Errorf("%w: %w", ErrBadRequest, err)
 	case http.StatusUnauthorized, http.StatusForbidden:
 		err.Message = "Authentication failed"
-		return fmt.Errorf("%w: %s", ErrUnauthorized, err.Error())
+		return fmt.Errorf("%w: %w", ErrUnauthorized, err)
 	case http.StatusTooManyRequests:
 		err.Message = "Rate limit exceeded - please wait before retrying"
-		return fmt.Errorf("%w: %s", ErrRateLimit, err.Error())
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
 	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
 		err.Message = "Server error - please try again"
-		return fmt.Errorf("%w: %s", ErrServerError, err.Error())
+		return fmt.Errorf("%w: %w", ErrServerError, err)
 	default:
 		err.Message = "Unknown error"
 		return err
 	}
 }
 
+func isContextLengthBody(body string) bool {
+	return strings.Contains(body, "context_length_exceeded") ||
+		strings.Contains(body, "context length") ||
+		strings.Contains(body, "context window") ||
+		strings.Contains(body, "too many tokens")
+}
+
+func isModelNotFoundBody(body string) bool {
+	return strings.Contains(body, "model_not_found") ||
+		(strings.Contains(body, "model") &&
+			(strings.Contains(body, "not found") || strings.Contains(body, "does not exist")))
+}
+
 func IsRetryable(err error) bool {
 	var apiErr *APIError
 	if errors.As(err, &apiErr) {
@@ -67,3 +152,91 @@ func IsRetryable(err error) bool {
 		errors.Is(err, ErrRateLimit) ||
 		errors.Is(err, ErrServerError)
 }
+
+// ExitCode returns the process exit code for err, or ExitFailure when err is
+// not one of the failures above.
+func ExitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return ExitUnauthorized
+	case errors.Is(err, ErrRateLimit):
+		return ExitRateLimit
+	case errors.Is(err, ErrModelNotFound):
+		return ExitModelNotFound
+	case errors.Is(err, ErrConnectionRefused):
+		return ExitConnectionRefused
+	case errors.Is(err, ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrContextLength):
+		return ExitContextLength
+	case errors.Is(err, ErrServerError):
+		return ExitServerError
+	case errors.Is(err, ErrBadRequest):
+		return ExitBadRequest
+	case errors.Is(err, ErrNoResponse):
+		return ExitNoResponse
+	case errors.Is(err, ErrPolicyBlocked):
+		return ExitPolicyBlocked
+	default:
+		return ExitFailure
+	}
+}
+
+// Hint suggests how to fix err, or returns "" when there is nothing specific
+// to suggest.
+func Hint(err error) string {
+	switch ExitCode(err) {
+	case ExitUnauthorized:
+		return "check VIBE_API_KEY and that VIBE_PROVIDER matches the key"
+	case ExitRateLimit:
+		return "wait a moment and try again, or raise VIBE_DEADLINE to allow longer backoff"
+	case ExitModelNotFound:
+		return "check VIBE_MODEL; run 'vibe models' to list available models (Ollama: 'vibe models pull <name>')"
+	case ExitConnectionRefused:
+		return "is the provider running? check VIBE_API_URL"
+	case ExitTimeout:
+		return "increase VIBE_TIMEOUT or VIBE_DEADLINE, or use a smaller model"
+	case ExitContextLength:
+		return "shorten the request or lower VIBE_MAX_TOKENS, or use a model with a larger context window"
+	case ExitServerError:
+		return "the provider is having problems; try again later"
+	case ExitBadRequest:
+		return "check VIBE_MODEL, VIBE_MAX_TOKENS and VIBE_PROVIDER"
+	case ExitNoResponse:
+		return "check VIBE_API_URL and your network connection"
+	case ExitPolicyBlocked:
+		return "a rule in VIBE_POLICY_FILE blocks this command; 'vibe policy test' shows which"
+	default:
+		return ""
+	}
+}
+
+// exitCodeErrors maps each exit code back to its failure.
+var exitCodeErrors = map[int]error{
+	ExitUnauthorized:      ErrUnauthorized,
+	ExitRateLimit:         ErrRateLimit,
+	ExitModelNotFound:     ErrModelNotFound,
+	ExitConnectionRefused: ErrConnectionRefused,
+	ExitTimeout:           ErrTimeout,
+	ExitContextLength:     ErrContextLength,
+	ExitServerError:       ErrServerError,
+	ExitBadRequest:        ErrBadRequest,
+	ExitNoResponse:        ErrNoResponse,
+	ExitPolicyBlocked:     ErrPolicyBlocked,
+}
+
+// remoteError is a failure reported by another vibe process as its message
+// and exit code.
+type remoteError struct {
+	message string
+	err     error
+}
+
+func (e *remoteError) Error() string { return e.message }
+func (e *remoteError) Unwrap() error { return e.err }
+
+// FromExitCode rebuilds an error from its message and ExitCode, so a failure
+// that crossed a process boundary keeps its exit code and hint.
+func FromExitCode(code int, message string) error {
+	return &remoteError{message: message, err: exitCodeErrors[code]}
+}
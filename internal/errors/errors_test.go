@@ -0,0 +1,103 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestNewAPIErrorClassification(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+		code   int
+	}{
+		{"unauthorized", http.StatusUnauthorized, "", ErrUnauthorized, ExitUnauthorized},
+		{"forbidden", http.StatusForbidden, "", ErrUnauthorized, ExitUnauthorized},
+		{"rate limit", http.StatusTooManyRequests, "", ErrRateLimit, ExitRateLimit},
+		{"server error", http.StatusBadGateway, "", ErrServerError, ExitServerError},
+		{"bad request", http.StatusBadRequest, `{"error":{"message":"invalid temperature"}}`, ErrBadRequest, ExitBadRequest},
+		{"ollama model not found", http.StatusNotFound, `{"error":"model \"llama9\" not found, try pulling it first"}`, ErrModelNotFound, ExitModelNotFound},
+		{"openai model not found", http.StatusNotFound, `{"error":{"message":"The model does not exist","code":"model_not_found"}}`, ErrModelNotFound, ExitModelNotFound},
+		{"context length", http.StatusBadRequest, `{"error":{"message":"This model's maximum context length is 8192 tokens"}}`, ErrContextLength, ExitContextLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewAPIError(tt.status, tt.body)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("NewAPIError(%d) = %v, want %v", tt.status, err, tt.want)
+			}
+			if got := ExitCode(err); got != tt.code {
+				t.Errorf("ExitCode = %d, want %d", got, tt.code)
+			}
+			if Hint(err) == "" {
+				t.Error("Hint is empty")
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Errorf("NewAPIError(%d) does not expose the *APIError", tt.status)
+			}
+		})
+	}
+}
+
+func TestNewAPIErrorPlain404(t *testing.T) {
+	err := NewAPIError(http.StatusNotFound, "404 page not found")
+	if errors.Is(err, ErrModelNotFound) {
+		t.Error("a 404 for a wrong path should not be reported as a missing model")
+	}
+	if ExitCode(err) != ExitFailure {
+		t.Errorf("ExitCode = %d, want %d", ExitCode(err), ExitFailure)
+	}
+}
+
+func TestAPIErrorDetail(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"error":{"message":"bad key"}}`, "bad key"},
+		{`{"error":"model not found"}`, "model not found"},
+		{`{"message":"slow down"}`, "slow down"},
+		{"upstream timed out", "upstream timed out"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		e := &APIError{Body: tt.body}
+		if got := e.Detail(); got != tt.want {
+			t.Errorf("Detail(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestExitCodeWrapped(t *testing.T) {
+	err := fmt.Errorf("giving up after 3 attempts: %w", fmt.Errorf("%w: dial tcp: connection refused", ErrConnectionRefused))
+	if got := ExitCode(err); got != ExitConnectionRefused {
+		t.Errorf("ExitCode = %d, want %d", got, ExitConnectionRefused)
+	}
+	if got := ExitCode(errors.New("something else")); got != ExitFailure {
+		t.Errorf("ExitCode for an unknown error = %d, want %d", got, ExitFailure)
+	}
+}
+
+func TestFromExitCode(t *testing.T) {
+	err := FromExitCode(ExitRateLimit, "rate limit exceeded (HTTP 429)")
+	if !errors.Is(err, ErrRateLimit) {
+		t.Errorf("FromExitCode(ExitRateLimit) is not ErrRateLimit")
+	}
+	if got := ExitCode(err); got != ExitRateLimit {
+		t.Errorf("ExitCode = %d, want %d", got, ExitRateLimit)
+	}
+	if err.Error() != "rate limit exceeded (HTTP 429)" {
+		t.Errorf("Error() = %q, want the original message", err.Error())
+	}
+	if got := ExitCode(FromExitCode(ExitFailure, "boom")); got != ExitFailure {
+		t.Errorf("ExitCode for a generic failure = %d, want %d", got, ExitFailure)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -18,6 +19,12 @@ type History struct {
 	dir      string
 	maxSize  int
 	filePath string
+
+	// entries is the file's content as of modTime, so a long-lived process
+	// (the daemon) doesn't re-read an unchanged file for every Add.
+	mu      sync.Mutex
+	entries []Entry
+	modTime time.Time
 }
 
 func New(cacheDir string, maxSize int) (*History, error) {
@@ -66,6 +73,22 @@ func (h *History) Add(query, command string) error {
 }
 
 func (h *History) List() ([]Entry, error) {
+	info, err := os.Stat(h.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Entry{}, nil
+		}
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if h.entries != nil && h.modTime.Equal(info.ModTime()) {
+		entries := append([]Entry(nil), h.entries...)
+		h.mu.Unlock()
+		return entries, nil
+	}
+	h.mu.Unlock()
+
 	data, err := os.ReadFile(h.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -80,6 +103,7 @@ func (h *History) List() ([]Entry, error) {
 		return []Entry{}, nil
 	}
 
+	h.remember(entries, info.ModTime())
 	return entries, nil
 }
 
@@ -103,5 +127,19 @@ func (h *History) save(entries []Entry) error {
 		return err
 	}
 
-	return os.Rename(tmpPath, h.filePath)
+	if err := os.Rename(tmpPath, h.filePath); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(h.filePath); err == nil {
+		h.remember(entries, info.ModTime())
+	}
+	return nil
+}
+
+func (h *History) remember(entries []Entry, modTime time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append([]Entry{}, entries...)
+	h.modTime = modTime
 }
@@ -0,0 +1,299 @@
+// Package httpapi serves the command generator over a local HTTP API for
+// scripts and tools on the same machine.
+//
+// Every request needs the bearer token from the state directory (see
+// LoadToken). The endpoints are:
+//
+//	POST /v1/generate   {"query": "..."} -> schema.CommandResponse
+//	GET  /v1/history    ?limit=N         -> []history.Entry, newest first
+//
+// A generate request sent with "Accept: text/event-stream" is answered with
+// server-sent events instead: "progress" events while the command is
+// generated, then one "result" or "error" event. A command the policy file
+// blocks is answered with 403 Forbidden (or an "error" event) and exit code
+// 19 instead of the command.
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// tokenName is the token file's name in the state directory.
+const tokenName = "api-token"
+
+// maxBodySize bounds a generate request body.
+const maxBodySize = 64 * 1024
+
+// GenerateRequest is the body of POST /v1/generate.
+type GenerateRequest struct {
+	Query string `json:"query"`
+}
+
+// ErrorResponse is the body of every failed request. ExitCode and Hint are
+// set when generation failed, as the CLI would report them.
+type ErrorResponse struct {
+	Error    string `json:"error"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// ProgressEvent is the data of a "progress" server-sent event.
+type ProgressEvent struct {
+	Message string `json:"message"`
+}
+
+// LoadToken returns the API token stored in dir, generating one readable by
+// the current user only if there is none yet.
+func LoadToken(dir string) (string, error) {
+	path := filepath.Join(dir, tokenName)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// TokenPath returns where LoadToken keeps the token in dir.
+func TokenPath(dir string) string {
+	return filepath.Join(dir, tokenName)
+}
+
+// Server answers API requests with a client and, if not nil, records
+// generated commands in a history. Commands are checked against a policy
+// before they are returned.
+type Server struct {
+	client  *client.Client
+	history *history.History
+	policy  *policy.Policy
+	token   string
+
+	// generating serializes generation: a client handles one query at a
+	// time.
+	generating sync.Mutex
+
+	mux *http.ServeMux
+}
+
+// NewServer returns a handler generating with c, applying pol and accepting
+// requests that carry token. h may be nil when history is disabled, and pol
+// when there is no policy.
+func NewServer(c *client.Client, h *history.History, pol *policy.Policy, token string) *Server {
+	s := &Server{client: c, history: h, policy: pol, token: token, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/generate", s.handleGenerate)
+	s.mux.HandleFunc("/v1/history", s.handleHistory)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, ErrorResponse{Error: "missing or invalid bearer token"})
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "use POST"})
+		return
+	}
+
+	var req GenerateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		writeError(w, http.StatusBadRequest, ErrorResponse{Error: `"query" is required`})
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		s.generateEvents(w, r, req.Query)
+		return
+	}
+
+	resp, err := s.generate(r.Context(), req.Query, nil)
+	if errors.Is(err, apierrors.ErrPolicyBlocked) {
+		writeError(w, http.StatusForbidden, generationError(err))
+		return
+	}
+	if errors.Is(err, errAudit) {
+		writeError(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, generationError(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// generateEvents answers a generate request with server-sent events.
+func (s *Server) generateEvents(w http.ResponseWriter, r *http.Request, query string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, ErrorResponse{Error: "streaming is not supported"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	events := &eventWriter{w: w, flusher: flusher}
+	resp, err := s.generate(r.Context(), query, events)
+	if err != nil {
+		events.send("error", generationError(err))
+		return
+	}
+	events.send("result", resp)
+}
+
+// errAudit marks a command the audit log couldn't record.
+var errAudit = errors.New("command not returned")
+
+// generate produces a command for query, applies the policy and records the
+// command in the audit log and the history, as the CLI does. Abandoned
+// requests stop generating.
+func (s *Server) generate(ctx context.Context, query string, status client.Status) (*schema.CommandResponse, error) {
+	s.generating.Lock()
+	defer s.generating.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	g, err := s.client.GenerateDetailed(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.client.Suggest(s.policy, query, g); err != nil {
+		if errors.Is(err, apierrors.ErrPolicyBlocked) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", errAudit, err)
+	}
+	resp := g.Response
+	if s.history != nil && resp.Command != "" {
+		if err := s.history.Add(s.client.Scrub(query, resp.Command)); err != nil {
+			logger.Debug("Failed to save history: %v", err)
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "use GET"})
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, ErrorResponse{Error: "limit must be a non-negative integer"})
+			return
+		}
+		limit = n
+	}
+
+	entries := []history.Entry{}
+	if s.history != nil {
+		list, err := s.history.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		entries = list
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func generationError(err error) ErrorResponse {
+	return ErrorResponse{
+		Error:    err.Error(),
+		ExitCode: apierrors.ExitCode(err),
+		Hint:     apierrors.Hint(err),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Debug("HTTP API: failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, body ErrorResponse) {
+	writeJSON(w, status, body)
+}
+
+// eventWriter sends server-sent events. As a client.Status it reports
+// progress.
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (e *eventWriter) send(event string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logger.Debug("HTTP API: failed to encode %s event: %v", event, err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data)
+	e.flusher.Flush()
+}
+
+func (e *eventWriter) Start(_ context.Context, message string) { e.Update(message) }
+func (e *eventWriter) Stop()                                   {}
+func (e *eventWriter) Update(message string)                   { e.send("progress", ProgressEvent{Message: message}) }
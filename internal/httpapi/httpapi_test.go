@@ -0,0 +1,259 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+const (
+	testToken       = "secret-token"
+	validCompletion = `{"command":"ls -la","explanation":["ls: list directory contents"]}`
+)
+
+// llmServer is a stub chat completions endpoint answering with status, or
+// validCompletion for 200. It counts the requests it gets.
+func llmServer(t *testing.T, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": validCompletion}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+// apiServer runs the API in front of a client for llmURL, with caching
+// enabled as in the CLI, applying pol.
+func apiServer(t *testing.T, llmURL string, pol *policy.Policy) (*httptest.Server, *history.History) {
+	t.Helper()
+	t.Setenv("VIBE_CONFIG_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg := &config.Config{
+		Provider:             "vllm",
+		APIURL:               llmURL,
+		Model:                "test-model",
+		Temperature:          0.2,
+		MaxTokens:            100,
+		Timeout:              5 * time.Second,
+		Deadline:             10 * time.Second,
+		MaxRetries:           1,
+		UseStructuredOutput:  true,
+		EnableJSONExtraction: true,
+		StrictValidation:     true,
+		EnableCache:          true,
+		CacheDir:             t.TempDir(),
+		CacheTTL:             time.Hour,
+	}
+	h, err := history.New(cfg.CacheDir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewServer(client.New(cfg), h, pol, testToken))
+	t.Cleanup(srv.Close)
+	return srv, h
+}
+
+func post(t *testing.T, url, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestGenerate(t *testing.T) {
+	llm, requests := llmServer(t, http.StatusOK)
+	srv, h := apiServer(t, llm.URL, nil)
+
+	for i := 0; i < 2; i++ {
+		resp := post(t, srv.URL+"/v1/generate", `{"query":"list files"}`, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+		var got schema.CommandResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Command != "ls -la" {
+			t.Errorf("command = %q, want %q", got.Command, "ls -la")
+		}
+	}
+
+	// The second request is answered from the cache, like the CLI's.
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("LLM saw %d requests, want 1", got)
+	}
+	if entries, _ := h.List(); len(entries) != 2 {
+		t.Errorf("history has %d entries, want 2", len(entries))
+	}
+}
+
+func TestGenerateEvents(t *testing.T) {
+	llm, _ := llmServer(t, http.StatusOK)
+	srv, _ := apiServer(t, llm.URL, nil)
+
+	resp := post(t, srv.URL+"/v1/generate", `{"query":"list files"}`, http.Header{"Accept": {"text/event-stream"}})
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if event, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			events = append(events, event)
+		}
+	}
+	if len(events) < 2 || events[0] != "progress" || events[len(events)-1] != "result" {
+		t.Errorf("events = %v, want progress events followed by a result", events)
+	}
+}
+
+func TestGenerateFailure(t *testing.T) {
+	llm, _ := llmServer(t, http.StatusUnauthorized)
+	srv, _ := apiServer(t, llm.URL, nil)
+
+	resp := post(t, srv.URL+"/v1/generate", `{"query":"list files"}`, nil)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ExitCode != apierrors.ExitUnauthorized || body.Hint == "" {
+		t.Errorf("body = %+v, want the unauthorized exit code and a hint", body)
+	}
+}
+
+func TestGenerateBlocked(t *testing.T) {
+	llm, _ := llmServer(t, http.StatusOK)
+	pol, err := policy.Parse([]byte(`{"rules": [{"name": "no-ls", "command": "ls", "action": "block"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, h := apiServer(t, llm.URL, pol)
+
+	resp := post(t, srv.URL+"/v1/generate", `{"query":"list files"}`, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", resp.StatusCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ExitCode != apierrors.ExitPolicyBlocked || !strings.Contains(body.Error, "no-ls") {
+		t.Errorf("body = %+v, want the policy exit code and rule", body)
+	}
+	if entries, _ := h.List(); len(entries) != 0 {
+		t.Errorf("history has %d entries, want none", len(entries))
+	}
+}
+
+func TestRequests(t *testing.T) {
+	llm, _ := llmServer(t, http.StatusOK)
+	srv, h := apiServer(t, llm.URL, nil)
+	for _, cmd := range []string{"one", "two", "three"} {
+		if err := h.Add(cmd, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"history", http.MethodGet, "/v1/history?limit=2", testToken, http.StatusOK},
+		{"no token", http.MethodGet, "/v1/history", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/v1/history", "nope", http.StatusUnauthorized},
+		{"bad limit", http.MethodGet, "/v1/history?limit=x", testToken, http.StatusBadRequest},
+		{"generate with GET", http.MethodGet, "/v1/generate", testToken, http.StatusMethodNotAllowed},
+		{"unknown path", http.MethodGet, "/v1/nope", testToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusOK {
+				var entries []history.Entry
+				json.NewDecoder(resp.Body).Decode(&entries)
+				if len(entries) != 2 || entries[0].Command != "three" {
+					t.Errorf("entries = %v, want the two newest", entries)
+				}
+			}
+		})
+	}
+
+	if resp := post(t, srv.URL+"/v1/generate", `{"query":""}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty query: status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestLoadToken(t *testing.T) {
+	dir := t.TempDir()
+	token, err := LoadToken(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 64 {
+		t.Errorf("token %q is not 32 hex-encoded bytes", token)
+	}
+	info, err := os.Stat(TokenPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("token file mode = %o, want 600", perm)
+	}
+
+	again, err := LoadToken(dir)
+	if err != nil || again != token {
+		t.Errorf("LoadToken again = %q, %v; want the stored token", again, err)
+	}
+}
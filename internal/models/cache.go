@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+const (
+	listingFile = "models.json"
+	// listingMaxAge is how long a cached listing is trusted. Pulling a model
+	// through vibe refreshes it immediately; models added by other means show
+	// up once the listing expires or `vibe models` is run.
+	listingMaxAge = 24 * time.Hour
+)
+
+// listing is the on-disk form of a provider's model list. Provider and APIURL
+// identify which server it describes, so switching providers never matches
+// against another server's models.
+type listing struct {
+	Provider  string    `json:"provider"`
+	APIURL    string    `json:"api_url"`
+	Models    []Model   `json:"models"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func listingPath(cacheDir string) (string, error) {
+	if cacheDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(home, ".cache", "vibe")
+	}
+	return filepath.Join(cacheDir, listingFile), nil
+}
+
+// Cached returns the last listing saved for the configured provider and API
+// URL, if it is recent enough to trust.
+func Cached(cfg *config.Config) ([]Model, bool) {
+	path, err := listingPath(cfg.CacheDir)
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var l listing
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, false
+	}
+	if l.Provider != cfg.Provider || l.APIURL != cfg.APIURL || time.Since(l.Timestamp) > listingMaxAge {
+		return nil, false
+	}
+	return l.Models, true
+}
+
+// SaveCached stores list as the listing for the configured provider.
+func SaveCached(cfg *config.Config, list []Model) error {
+	path, err := listingPath(cfg.CacheDir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(listing{
+		Provider:  cfg.Provider,
+		APIURL:    cfg.APIURL,
+		Models:    list,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so a concurrent completion never reads a torn file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MissingModelWarning returns a warning when the cached listing shows that the
+// configured model is not available, or "" when it is (or nothing is cached).
+// It never touches the network, so it is cheap enough to call on every query.
+func MissingModelWarning(cfg *config.Config) string {
+	list, ok := Cached(cfg)
+	if !ok || len(list) == 0 || Contains(list, cfg.Model) {
+		return ""
+	}
+	return fmt.Sprintf("Model %q is not available from %s (run 'vibe models' to list models)", cfg.Model, cfg.Provider)
+}
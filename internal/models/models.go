@@ -0,0 +1,236 @@
+// Package models lists and pulls the models available from the configured
+// LLM provider.
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+	"github.com/skymoore/vibe-zsh/internal/transport"
+)
+
+// ErrUnsupported is returned when the provider has no model listing (or
+// pulling) endpoint vibe knows how to call.
+var ErrUnsupported = errors.New("not supported for this provider")
+
+// Model describes one model offered by a provider.
+type Model struct {
+	Name string `json:"name"`
+	// Size in bytes. Only Ollama reports it; zero otherwise.
+	Size int64 `json:"size,omitempty"`
+}
+
+// hostedBaseURLs holds the OpenAI-style API base of hosted providers whose
+// gollm implementation ignores VIBE_API_URL.
+var hostedBaseURLs = map[string]string{
+	"openai":     "https://api.openai.com/v1",
+	"groq":       "https://api.groq.com/openai/v1",
+	"openrouter": "https://openrouter.ai/api/v1",
+	"deepseek":   "https://api.deepseek.com/v1",
+	"mistral":    "https://api.mistral.ai/v1",
+}
+
+// List returns the models the configured provider offers, sorted by name.
+// Ollama is queried through its native /api/tags endpoint; every other
+// supported provider through the OpenAI-style /v1/models endpoint.
+func List(ctx context.Context, cfg *config.Config) ([]Model, error) {
+	var (
+		list []Model
+		err  error
+	)
+	if cfg.Provider == "ollama" {
+		list, err = listOllama(ctx, cfg)
+	} else {
+		list, err = listOpenAI(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func listOllama(ctx context.Context, cfg *config.Config) ([]Model, error) {
+	var body struct {
+		Models []struct {
+			Name string `json:"name"`
+			Size int64  `json:"size"`
+		} `json:"models"`
+	}
+	if err := getJSON(ctx, cfg, ollamaBaseURL(cfg.APIURL)+"/api/tags", &body); err != nil {
+		return nil, err
+	}
+
+	list := make([]Model, 0, len(body.Models))
+	for _, m := range body.Models {
+		list = append(list, Model{Name: m.Name, Size: m.Size})
+	}
+	return list, nil
+}
+
+func listOpenAI(ctx context.Context, cfg *config.Config) ([]Model, error) {
+	base, err := openAIBaseURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, cfg, base+"/models", &body); err != nil {
+		return nil, err
+	}
+
+	list := make([]Model, 0, len(body.Data))
+	for _, m := range body.Data {
+		list = append(list, Model{Name: m.ID})
+	}
+	return list, nil
+}
+
+// openAIBaseURL resolves the ".../v1" base for OpenAI-style providers.
+func openAIBaseURL(cfg *config.Config) (string, error) {
+	if base, ok := hostedBaseURLs[cfg.Provider]; ok {
+		return base, nil
+	}
+
+	switch cfg.Provider {
+	case "lmstudio", "vllm", config.ProviderOpenAICompatible, config.ProviderLlamaCpp:
+		base := strings.TrimSuffix(cfg.APIURL, "/")
+		base = strings.TrimSuffix(base, "/chat/completions")
+		if !strings.HasSuffix(base, "/v1") {
+			base += "/v1"
+		}
+		return base, nil
+	default:
+		return "", fmt.Errorf("listing models for provider %q: %w", cfg.Provider, ErrUnsupported)
+	}
+}
+
+// ollamaBaseURL normalizes an OpenAI-style Ollama URL (".../v1") to the native
+// Ollama base URL.
+func ollamaBaseURL(apiURL string) string {
+	u := strings.TrimSuffix(apiURL, "/")
+	u = strings.TrimSuffix(u, "/v1")
+	return u
+}
+
+func getJSON(ctx context.Context, cfg *config.Config, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+
+	resp, err := httpClient(cfg).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned HTTP %d", url, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode model list: %w", err)
+	}
+	return nil
+}
+
+func httpClient(cfg *config.Config) *http.Client {
+	return transport.NewClient(cfg.Timeout)
+}
+
+// PullProgress is one status update streamed by Ollama while pulling a model.
+// Completed and Total are byte counts of the layer currently downloading and
+// are zero for steps without a download.
+type PullProgress struct {
+	Status    string `json:"status"`
+	Completed int64  `json:"completed"`
+	Total     int64  `json:"total"`
+}
+
+// Pull downloads a model into Ollama, calling onProgress for every status
+// update the server streams back.
+func Pull(ctx context.Context, cfg *config.Config, name string, onProgress func(PullProgress)) error {
+	if cfg.Provider != "ollama" {
+		return fmt.Errorf("pulling models with provider %q: %w", cfg.Provider, ErrUnsupported)
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"name": name, "stream": true})
+	if err != nil {
+		return err
+	}
+
+	url := ollamaBaseURL(cfg.APIURL) + "/api/pull"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Pulls routinely take longer than VIBE_TIMEOUT, so rely on ctx alone.
+	client := httpClient(cfg)
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pull failed: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var update struct {
+			PullProgress
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			continue
+		}
+		if update.Error != "" {
+			return fmt.Errorf("pull failed: %s", update.Error)
+		}
+		if onProgress != nil {
+			onProgress(update.PullProgress)
+		}
+	}
+	return scanner.Err()
+}
+
+// Contains reports whether name is among list. Ollama treats a name without a
+// tag as ":latest", so "llama3" matches "llama3:latest".
+func Contains(list []Model, name string) bool {
+	for _, m := range list {
+		if m.Name == name || m.Name == name+":latest" {
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the model names of list.
+func Names(list []Model) []string {
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = m.Name
+	}
+	return names
+}
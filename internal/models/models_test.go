@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+func testConfig(provider, url string) *config.Config {
+	return &config.Config{
+		Provider: provider,
+		APIURL:   url,
+		Model:    "llama3:8b",
+		Timeout:  5 * time.Second,
+	}
+}
+
+func TestListOllama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			t.Errorf("request path = %q, want /api/tags", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"qwen2.5:7b","size":4700000000},{"name":"llama3:8b","size":4600000000}]}`)
+	}))
+	defer srv.Close()
+
+	list, err := List(context.Background(), testConfig("ollama", srv.URL+"/v1"))
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if got := Names(list); len(got) != 2 || got[0] != "llama3:8b" || got[1] != "qwen2.5:7b" {
+		t.Errorf("Names = %v, want sorted [llama3:8b qwen2.5:7b]", got)
+	}
+	if list[0].Size != 4600000000 {
+		t.Errorf("Size = %d, want 4600000000", list[0].Size)
+	}
+}
+
+func TestListOpenAICompatible(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/models" {
+			t.Errorf("request path = %q, want /v1/models", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want %q", got, "Bearer secret")
+		}
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"mistral-7b"}]}`)
+	}))
+	defer srv.Close()
+
+	for _, provider := range []string{"vllm", "lmstudio", config.ProviderOpenAICompatible, config.ProviderLlamaCpp} {
+		cfg := testConfig(provider, srv.URL)
+		cfg.APIKey = "secret"
+
+		list, err := List(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("%s: List returned error: %v", provider, err)
+		}
+		if got := Names(list); len(got) != 1 || got[0] != "mistral-7b" {
+			t.Errorf("%s: Names = %v, want [mistral-7b]", provider, got)
+		}
+	}
+}
+
+func TestListUnsupported(t *testing.T) {
+	_, err := List(context.Background(), testConfig("anthropic", ""))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("List = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestPull(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/pull" {
+			t.Errorf("request path = %q, want /api/pull", r.URL.Path)
+		}
+		fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		fmt.Fprintln(w, `{"status":"pulling abc","completed":50,"total":100}`)
+		fmt.Fprintln(w, `{"status":"success"}`)
+	}))
+	defer srv.Close()
+
+	var updates []PullProgress
+	err := Pull(context.Background(), testConfig("ollama", srv.URL), "llama3", func(p PullProgress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("Pull returned error: %v", err)
+	}
+	if len(updates) != 3 {
+		t.Fatalf("got %d progress updates, want 3", len(updates))
+	}
+	if updates[1].Completed != 50 || updates[1].Total != 100 {
+		t.Errorf("updates[1] = %+v, want 50/100", updates[1])
+	}
+}
+
+func TestPullError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+	}))
+	defer srv.Close()
+
+	err := Pull(context.Background(), testConfig("ollama", srv.URL), "nope", nil)
+	if err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		t.Errorf("Pull = %v, want the server's error", err)
+	}
+}
+
+func TestPullRequiresOllama(t *testing.T) {
+	err := Pull(context.Background(), testConfig("vllm", "http://localhost:8000"), "x", nil)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Pull = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestContains(t *testing.T) {
+	list := []Model{{Name: "llama3:latest"}, {Name: "qwen2.5:7b"}}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"llama3", true},
+		{"llama3:latest", true},
+		{"qwen2.5:7b", true},
+		{"qwen2.5", false},
+		{"mistral", false},
+	}
+	for _, tt := range tests {
+		if got := Contains(list, tt.name); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMissingModelWarning(t *testing.T) {
+	cfg := testConfig("ollama", "http://localhost:11434/v1")
+	cfg.CacheDir = t.TempDir()
+
+	if w := MissingModelWarning(cfg); w != "" {
+		t.Errorf("warning without a cached listing = %q, want none", w)
+	}
+
+	if err := SaveCached(cfg, []Model{{Name: "qwen2.5:7b"}}); err != nil {
+		t.Fatalf("SaveCached: %v", err)
+	}
+	if w := MissingModelWarning(cfg); !strings.Contains(w, "llama3:8b") {
+		t.Errorf("warning = %q, want it to name the missing model", w)
+	}
+
+	cfg.Model = "qwen2.5:7b"
+	if w := MissingModelWarning(cfg); w != "" {
+		t.Errorf("warning for an available model = %q, want none", w)
+	}
+
+	// A listing from a different server must not be used.
+	cfg.Model = "llama3:8b"
+	cfg.APIURL = "http://otherhost:11434/v1"
+	if w := MissingModelWarning(cfg); w != "" {
+		t.Errorf("warning from another server's listing = %q, want none", w)
+	}
+}
+
+func TestWarm(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/generate" {
+			t.Errorf("request path = %q, want /api/generate", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"model":"llama3:8b","response":"","done":true,"done_reason":"load"}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig("ollama", srv.URL+"/v1")
+	cfg.KeepAlive = "45m"
+	if err := Warm(context.Background(), cfg); err != nil {
+		t.Fatalf("Warm returned error: %v", err)
+	}
+	if body["model"] != "llama3:8b" || body["keep_alive"] != "45m" {
+		t.Errorf("request = %v, want model llama3:8b and keep_alive 45m", body)
+	}
+	if _, ok := body["prompt"]; ok {
+		t.Error("Warm sent a prompt; loading needs none")
+	}
+
+	if err := Warm(context.Background(), testConfig("vllm", srv.URL)); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Warm with vllm = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestLoaded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ps" {
+			t.Errorf("request path = %q, want /api/ps", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models":[{"name":"qwen2.5:7b","model":"qwen2.5:7b"}]}`)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig("ollama", srv.URL)
+	if loaded, err := Loaded(context.Background(), cfg, "qwen2.5:7b"); err != nil || !loaded {
+		t.Errorf("Loaded(qwen2.5:7b) = %v, %v; want true", loaded, err)
+	}
+	if loaded, err := Loaded(context.Background(), cfg, "llama3:8b"); err != nil || loaded {
+		t.Errorf("Loaded(llama3:8b) = %v, %v; want false", loaded, err)
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/config"
+)
+
+// Loaded reports whether Ollama currently holds name in memory, according to
+// /api/ps. A model that is not loaded has to be read from disk first, which
+// can take many seconds.
+func Loaded(ctx context.Context, cfg *config.Config, name string) (bool, error) {
+	if cfg.Provider != "ollama" {
+		return false, fmt.Errorf("checking loaded models with provider %q: %w", cfg.Provider, ErrUnsupported)
+	}
+
+	var body struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := getJSON(ctx, cfg, ollamaBaseURL(cfg.APIURL)+"/api/ps", &body); err != nil {
+		return false, err
+	}
+
+	list := make([]Model, 0, len(body.Models))
+	for _, m := range body.Models {
+		list = append(list, Model{Name: m.Name})
+	}
+	return Contains(list, name), nil
+}
+
+// Warm loads the configured model into Ollama's memory and asks Ollama to keep
+// it there for VIBE_KEEP_ALIVE. A generate request without a prompt loads the
+// model without generating anything.
+func Warm(ctx context.Context, cfg *config.Config) error {
+	if cfg.Provider != "ollama" {
+		return fmt.Errorf("warming models with provider %q: %w", cfg.Provider, ErrUnsupported)
+	}
+
+	request := map[string]interface{}{"model": cfg.Model, "stream": false}
+	if cfg.KeepAlive != "" {
+		request["keep_alive"] = cfg.KeepAlive
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	url := ollamaBaseURL(cfg.APIURL) + "/api/generate"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Loading a large model routinely takes longer than VIBE_TIMEOUT, so rely
+	// on ctx alone.
+	client := httpClient(cfg)
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("loading %s failed: HTTP %d: %s", cfg.Model, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,110 @@
+package placeholder
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sourceTimeout bounds each completion source, so a slow docker daemon
+// doesn't hold up the form.
+const sourceTimeout = 2 * time.Second
+
+// maxCandidates caps the completions kept per source.
+const maxCandidates = 500
+
+// Source lists the values a kind of placeholder can take.
+type Source func(ctx context.Context, dir string) ([]string, error)
+
+// Sources maps each kind to where its completions come from.
+var Sources = map[string]Source{
+	File:      files,
+	Container: containers,
+	Branch:    branches,
+}
+
+// Candidates returns the completions for kind, or nothing if it has no
+// source or the source fails.
+func Candidates(ctx context.Context, kind, dir string) []string {
+	source, ok := Sources[kind]
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, sourceTimeout)
+	defer cancel()
+	values, err := source(ctx, dir)
+	if err != nil {
+		return nil
+	}
+	if len(values) > maxCandidates {
+		values = values[:maxCandidates]
+	}
+	return values
+}
+
+// Match returns the candidates that start with prefix, then those that
+// merely contain it, ignoring case.
+func Match(candidates []string, prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	var starts, contains []string
+	for _, c := range candidates {
+		lower := strings.ToLower(c)
+		switch {
+		case strings.HasPrefix(lower, prefix):
+			starts = append(starts, c)
+		case strings.Contains(lower, prefix):
+			contains = append(contains, c)
+		}
+	}
+	return append(starts, contains...)
+}
+
+// files lists the entries of dir, directories with a trailing slash and
+// hidden ones last.
+func files(_ context.Context, dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return !strings.HasPrefix(names[i], ".") && strings.HasPrefix(names[j], ".")
+	})
+	return names, nil
+}
+
+// containers lists the names of running containers.
+func containers(ctx context.Context, _ string) ([]string, error) {
+	return lines(ctx, "", "docker", "ps", "--format", "{{.Names}}")
+}
+
+// branches lists the local and remote branches of the repository at dir.
+func branches(ctx context.Context, dir string) ([]string, error) {
+	return lines(ctx, dir, "git", "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/remotes")
+}
+
+func lines(ctx context.Context, dir, name string, args ...string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			values = append(values, line)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,314 @@
+package placeholder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Errors from Ask.
+var (
+	ErrCancelled  = errors.New("cancelled")
+	ErrNoTerminal = errors.New("no terminal to show the form on")
+)
+
+// shownMatches is how many completions the form lists at once.
+const shownMatches = 5
+
+var (
+	titleStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("205")). // Bright pink
+			MarginBottom(1)
+
+	commandBoxStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("229")). // Light yellow
+			Background(lipgloss.Color("235")). // Dark gray
+			Padding(0, 1).
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("241")) // Subtle gray border
+
+	labelStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("117")) // Light blue
+
+	focusedLabelStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("205")). // Bright pink
+				Bold(true)
+
+	matchStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241")) // Gray
+
+	chosenMatchStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("86")). // Cyan
+				Underline(true)
+
+	statusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")). // Orange
+			Italic(true)
+
+	helpStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241")). // Gray
+			MarginTop(1)
+)
+
+type field struct {
+	placeholder Placeholder
+	input       textinput.Model
+	candidates  []string
+	typed       string   // What the user typed, which completion cycles from
+	matches     []string // Candidates matching typed
+	choice      int      // Index in matches tab last completed to, or -1
+}
+
+// candidatesMsg delivers the completions for a kind.
+type candidatesMsg struct {
+	kind   string
+	values []string
+}
+
+type form struct {
+	command   string
+	dir       string
+	fields    []field
+	focus     int
+	done      bool
+	skipped   bool
+	cancelled bool
+	width     int
+	status    string
+}
+
+func newForm(command string, ps []Placeholder, dir string) form {
+	f := form{command: command, dir: dir}
+	for i, p := range ps {
+		input := textinput.New()
+		input.Prompt = "› "
+		input.Placeholder = p.Name
+		if i == 0 {
+			input.Focus()
+		}
+		f.fields = append(f.fields, field{placeholder: p, input: input, choice: -1})
+	}
+	return f
+}
+
+func (f form) Init() tea.Cmd {
+	cmds := []tea.Cmd{textinput.Blink}
+	loaded := make(map[string]bool)
+	for _, fd := range f.fields {
+		kind := fd.placeholder.Kind
+		if kind == "" || loaded[kind] {
+			continue
+		}
+		loaded[kind] = true
+		dir := f.dir
+		cmds = append(cmds, func() tea.Msg {
+			return candidatesMsg{kind: kind, values: Candidates(context.Background(), kind, dir)}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+func (f form) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		f.width = msg.Width
+		return f, nil
+
+	case candidatesMsg:
+		for i := range f.fields {
+			if fd := &f.fields[i]; fd.placeholder.Kind == msg.kind {
+				fd.candidates = msg.values
+				fd.matches = Match(fd.candidates, fd.typed)
+			}
+		}
+		return f, nil
+
+	case tea.KeyMsg:
+		f.status = ""
+		switch {
+		case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+			f.cancelled = true
+			return f, tea.Quit
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("esc"))):
+			f.skipped = true
+			return f, tea.Quit
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("tab"))):
+			f.complete()
+			return f, nil
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("shift+tab", "up"))):
+			return f, f.move(f.focus - 1)
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("down"))):
+			return f, f.move(f.focus + 1)
+
+		case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
+			if f.focus < len(f.fields)-1 {
+				return f, f.move(f.focus + 1)
+			}
+			for i, fd := range f.fields {
+				if strings.TrimSpace(fd.input.Value()) == "" {
+					f.status = fmt.Sprintf("Fill in %s, or press esc to keep the placeholders", fd.placeholder.Token)
+					return f, f.move(i)
+				}
+			}
+			f.done = true
+			return f, tea.Quit
+		}
+
+		fd := &f.fields[f.focus]
+		var cmd tea.Cmd
+		fd.input, cmd = fd.input.Update(msg)
+		if fd.input.Value() != fd.typed {
+			fd.typed = fd.input.Value()
+			fd.matches = Match(fd.candidates, fd.typed)
+			fd.choice = -1
+		}
+		return f, cmd
+	}
+
+	return f, nil
+}
+
+// complete fills the focused field with the next completion for what was
+// typed.
+func (f *form) complete() {
+	fd := &f.fields[f.focus]
+	if len(fd.matches) == 0 {
+		return
+	}
+	fd.choice = (fd.choice + 1) % len(fd.matches)
+	fd.input.SetValue(fd.matches[fd.choice])
+	fd.input.CursorEnd()
+}
+
+// move focuses field i, if there is one.
+func (f *form) move(i int) tea.Cmd {
+	if i < 0 || i >= len(f.fields) || i == f.focus {
+		return nil
+	}
+	f.fields[f.focus].input.Blur()
+	f.focus = i
+	return f.fields[i].input.Focus()
+}
+
+// values maps each placeholder to what was typed for it.
+func (f form) values() map[string]string {
+	values := make(map[string]string)
+	for _, fd := range f.fields {
+		values[fd.placeholder.Token] = strings.TrimSpace(fd.input.Value())
+	}
+	return values
+}
+
+func (f form) View() string {
+	if f.done || f.skipped {
+		return ""
+	}
+	if f.cancelled {
+		return statusStyle.Render("✗ Cancelled") + "\n"
+	}
+
+	width := 72
+	if f.width > 0 {
+		width = max(f.width-2, 20)
+	}
+
+	var s strings.Builder
+	s.WriteString(titleStyle.Render("✏️  Fill in the placeholders"))
+	s.WriteString("\n\n")
+	s.WriteString(commandBoxStyle.Width(width).Render(Fill(f.command, f.values())))
+	s.WriteString("\n\n")
+
+	for i, fd := range f.fields {
+		label := labelStyle
+		if i == f.focus {
+			label = focusedLabelStyle
+		}
+		s.WriteString(label.Render(fd.placeholder.Token))
+		s.WriteString("\n")
+		s.WriteString(fd.input.View())
+		s.WriteString("\n")
+		if i == f.focus && len(fd.matches) > 0 {
+			s.WriteString(matchLine(fd))
+			s.WriteString("\n")
+		}
+	}
+
+	if f.status != "" {
+		s.WriteString("\n")
+		s.WriteString(statusStyle.Render(f.status))
+		s.WriteString("\n")
+	}
+	s.WriteString(helpStyle.Width(width).Render("tab: complete • ↑/↓: move • enter: next/done • esc: keep the placeholders • ctrl+c: cancel"))
+	return s.String()
+}
+
+// matchLine lists a window of a field's completions around the one chosen.
+func matchLine(fd field) string {
+	start := 0
+	if fd.choice >= shownMatches {
+		start = fd.choice - shownMatches + 1
+	}
+	end := min(start+shownMatches, len(fd.matches))
+
+	var parts []string
+	for i := start; i < end; i++ {
+		if i == fd.choice {
+			parts = append(parts, chosenMatchStyle.Render(fd.matches[i]))
+		} else {
+			parts = append(parts, matchStyle.Render(fd.matches[i]))
+		}
+	}
+	line := "  " + strings.Join(parts, "  ")
+	if more := len(fd.matches) - end; more > 0 {
+		line += matchStyle.Render(fmt.Sprintf("  (+%d)", more))
+	}
+	return line
+}
+
+// Ask shows a form for the placeholders ps in command, with completions
+// from dir, and returns the command with the values filled in. Leaving the
+// form with esc keeps the placeholders. It returns ErrCancelled if the user
+// cancels, and ErrNoTerminal, with command unchanged, if there is no
+// terminal to ask on.
+func Ask(command string, ps []Placeholder, dir string) (string, error) {
+	if len(ps) == 0 {
+		return command, nil
+	}
+
+	// Force color output for lipgloss
+	lipgloss.SetColorProfile(termenv.TrueColor)
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return command, ErrNoTerminal
+	}
+	defer tty.Close()
+
+	p := tea.NewProgram(newForm(command, ps, dir), tea.WithInput(tty), tea.WithOutput(tty))
+	final, err := p.Run()
+	if err != nil {
+		return command, err
+	}
+
+	f, ok := final.(form)
+	switch {
+	case !ok || f.skipped:
+		return command, nil
+	case f.cancelled:
+		return command, ErrCancelled
+	}
+	return Fill(command, f.values()), nil
+}
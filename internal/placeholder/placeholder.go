@@ -0,0 +1,289 @@
+// Package placeholder finds the values a generated command leaves for the
+// user to fill in, such as <container_id>, YOUR_BUCKET or path/to/file, and
+// puts the user's values in their place, quoted for where they stand in the
+// command.
+package placeholder
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of value a placeholder stands for, which decide where completions
+// come from.
+const (
+	File      = "file"      // Files in the working directory
+	Container = "container" // Running containers (docker ps)
+	Branch    = "branch"    // Git branches
+)
+
+// Placeholder is a token in a command that stands for a value the user has
+// to provide.
+type Placeholder struct {
+	Token string // As it appears in the command, e.g. <container_id>
+	Name  string // What it stands for, e.g. container_id
+	Kind  string // File, Container, Branch or "" for no completion
+}
+
+// patterns find placeholders models write without declaring them.
+var patterns = []*regexp.Regexp{
+	// <container_id>, <your email>
+	regexp.MustCompile(`<[A-Za-z][A-Za-z0-9_.:/-]*(?: [A-Za-z0-9_.:/-]+)*>`),
+	// YOUR_BUCKET, your-api-host
+	regexp.MustCompile(`\b(?:YOUR|[Yy]our)[_-][A-Za-z0-9_-]*[A-Za-z0-9]`),
+	// path/to/file, /path/to/dir
+	regexp.MustCompile(`(?:~?/)?\bpath/to(?:/[A-Za-z0-9_.-]+)*`),
+}
+
+// Detect returns the placeholders in command, in the order they first
+// appear: those the model declared in explicit, when the command contains
+// them, and those the patterns find. A quoted <...>, as in echo "<html>",
+// is text unless the model declared it.
+func Detect(command string, explicit []string) []Placeholder {
+	first := make(map[string]int)
+	add := func(token string, at int) {
+		if prev, ok := first[token]; !ok || at < prev {
+			first[token] = at
+		}
+	}
+	for _, token := range explicit {
+		token = strings.TrimSpace(token)
+		if at := strings.Index(command, token); token != "" && at >= 0 {
+			add(token, at)
+		}
+	}
+	for _, re := range patterns {
+		for _, m := range re.FindAllStringIndex(command, -1) {
+			// --your-flag is an option, not a placeholder.
+			if command[m[0]] == '<' && quoted(command, m[0]) {
+				continue
+			}
+			if !isRedirect(command, m[0], m[1]) && (m[0] == 0 || command[m[0]-1] != '-') {
+				add(command[m[0]:m[1]], m[0])
+			}
+		}
+	}
+
+	tokens := make([]string, 0, len(first))
+	for token := range first {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if first[tokens[i]] != first[tokens[j]] {
+			return first[tokens[i]] < first[tokens[j]]
+		}
+		return len(tokens[i]) > len(tokens[j])
+	})
+
+	var out []Placeholder
+	for _, token := range tokens {
+		// A token inside a longer one, as path/to in <path/to/file>, is
+		// filled with it.
+		inside := false
+		for _, p := range out {
+			if strings.Contains(p.Token, token) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			name := nameOf(token)
+			out = append(out, Placeholder{Token: token, Name: name, Kind: kindOf(command, first[token], name, token)})
+		}
+	}
+	return out
+}
+
+// Tokens returns the placeholders' tokens.
+func Tokens(ps []Placeholder) []string {
+	var tokens []string
+	for _, p := range ps {
+		tokens = append(tokens, p.Token)
+	}
+	return tokens
+}
+
+// isRedirect reports whether an <...> match is really shell syntax, as in
+// cat <<EOF> or sort <in>out.
+func isRedirect(command string, start, end int) bool {
+	if command[start] != '<' {
+		return false
+	}
+	if start > 0 && command[start-1] == '<' {
+		return true
+	}
+	return end < len(command) && !strings.ContainsRune(" \t\n;|&)'\"/:.,=", rune(command[end]))
+}
+
+// quoted reports whether command[at] is inside single or double quotes.
+func quoted(command string, at int) bool {
+	var quote byte
+	for i := 0; i < at; i++ {
+		switch c := command[i]; {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++ // An escaped character, outside quotes or in double ones
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		}
+	}
+	return quote != 0
+}
+
+func nameOf(token string) string {
+	name := strings.TrimSuffix(strings.TrimPrefix(token, "<"), ">")
+	for _, prefix := range []string{"YOUR_", "YOUR-", "your_", "your-", "Your_", "Your-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	if strings.Contains(token, "path/to") {
+		if base := path.Base(name); base != "to" {
+			return base
+		}
+		return "path"
+	}
+	return strings.ToLower(name)
+}
+
+// kindOf guesses what a placeholder stands for from its name, or failing
+// that from the program it's an argument of.
+func kindOf(command string, at int, name, token string) string {
+	switch {
+	case strings.Contains(name, "container"):
+		return Container
+	case strings.Contains(name, "branch"):
+		return Branch
+	case strings.Contains(token, "path/to") || containsAny(name, "file", "path", "dir", "folder"):
+		return File
+	}
+
+	switch program(command, at) {
+	case "docker", "podman":
+		if containsAny(name, "id", "name") {
+			return Container
+		}
+	case "git":
+		if containsAny(name, "ref", "rev") {
+			return Branch
+		}
+	case "cat", "less", "head", "tail", "cp", "mv", "rm", "vim", "nano", "chmod", "tar", "grep":
+		return File
+	}
+	return ""
+}
+
+// program returns the name of the program whose arguments include the
+// byte at offset at, judged from the text of the command.
+func program(command string, at int) string {
+	start := 0
+	for _, sep := range []string{"|", ";", "&&", "&", "$(", "(", "`"} {
+		if i := strings.LastIndex(command[:at], sep); i >= 0 && i+len(sep) > start {
+			start = i + len(sep)
+		}
+	}
+	for _, word := range strings.Fields(command[start:at]) {
+		switch word {
+		case "sudo", "doas", "env", "xargs", "nohup", "time", "exec", "command":
+			continue
+		}
+		if strings.Contains(word, "=") {
+			continue
+		}
+		return path.Base(word)
+	}
+	return ""
+}
+
+func containsAny(s string, subs ...string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fill replaces each placeholder in command with its value in values, keyed
+// by token. Values are quoted for where the token stands: as a separate
+// word, inside double quotes or inside single quotes. Placeholders without
+// a value, or with an empty one, are left in place.
+func Fill(command string, values map[string]string) string {
+	type span struct {
+		start, end int
+		value      string
+	}
+	var spans []span
+	for token, value := range values {
+		if token == "" || value == "" {
+			continue
+		}
+		for off := 0; ; {
+			i := strings.Index(command[off:], token)
+			if i < 0 {
+				break
+			}
+			start := off + i
+			spans = append(spans, span{start, start + len(token), value})
+			off = start + len(token)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			continue // Overlaps a longer token already filled
+		}
+		b.WriteString(command[last:s.start])
+		b.WriteString(quote(s.value, quoteAt(command, s.start)))
+		last = s.end
+	}
+	b.WriteString(command[last:])
+	return b.String()
+}
+
+// quoteAt returns the quote open at offset at in command: ', " or 0.
+func quoteAt(command string, at int) byte {
+	var open byte
+	for i := 0; i < at; i++ {
+		c := command[i]
+		switch {
+		case open == '\'':
+			if c == '\'' {
+				open = 0
+			}
+		case c == '\\':
+			i++
+		case open == '"':
+			if c == '"' {
+				open = 0
+			}
+		case c == '\'' || c == '"':
+			open = c
+		}
+	}
+	return open
+}
+
+// quote renders value for a spot inside the given quote.
+func quote(value string, open byte) string {
+	switch open {
+	case '\'':
+		return strings.ReplaceAll(value, "'", `'\''`)
+	case '"':
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(value)
+	}
+	if !strings.ContainsAny(value, " \t\n'\"\\$`|&;<>()*?[]#~{}!") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
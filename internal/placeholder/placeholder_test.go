@@ -0,0 +1,160 @@
+package placeholder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		command  string
+		explicit []string
+		want     []Placeholder
+	}{
+		{"docker logs -f <container_id>", nil, []Placeholder{{"<container_id>", "container_id", Container}}},
+		{"aws s3 cp backup.tar s3://YOUR_BUCKET/backups/", nil, []Placeholder{{"YOUR_BUCKET", "bucket", ""}}},
+		{"tar -czf out.tgz /path/to/dir", nil, []Placeholder{{"/path/to/dir", "dir", File}}},
+		{"git checkout <branch> && git merge <other>", nil, []Placeholder{
+			{"<branch>", "branch", Branch},
+			{"<other>", "other", ""},
+		}},
+		{"docker exec -it <name> sh", nil, []Placeholder{{"<name>", "name", Container}}},
+		{"grep -r TODO <src path>", nil, []Placeholder{{"<src path>", "src path", File}}},
+		{"kubectl delete pod POD_NAME -n NAMESPACE", []string{"POD_NAME", "NAMESPACE", "missing"}, []Placeholder{
+			{"POD_NAME", "pod_name", ""},
+			{"NAMESPACE", "namespace", ""},
+		}},
+		{"cp <path/to/file> .", nil, []Placeholder{{"<path/to/file>", "file", File}}},
+
+		// Shell syntax and ordinary words are not placeholders.
+		{"sort <in >out", nil, nil},
+		{"sort <in>out", nil, nil},
+		{"cat <<EOF> notes.txt", nil, nil},
+		{"diff <(ls a) <(ls b)", nil, nil},
+		{"yourscript.sh --your-flag", nil, nil},
+		{"psql 'postgres://admin:__SECRET_1__@db/app'", nil, nil},
+
+		// Quoted <...> is text, unless the model declared it.
+		{`echo "<html>"`, nil, nil},
+		{"sed 's/<b>//g' page.html", nil, nil},
+		{`git commit -m "fix <issue>"`, []string{"<issue>"}, []Placeholder{{"<issue>", "issue", ""}}},
+	}
+	for _, tt := range tests {
+		got := Detect(tt.command, tt.explicit)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Detect(%q) = %+v, want %+v", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	tests := []struct {
+		command string
+		values  map[string]string
+		want    string
+	}{
+		{"docker logs -f <id>", map[string]string{"<id>": "web-1"}, "docker logs -f web-1"},
+		{"cat <file>", map[string]string{"<file>": "my notes.txt"}, "cat 'my notes.txt'"},
+		{"cat <file>", map[string]string{"<file>": "it's"}, `cat 'it'\''s'`},
+		{`echo "hello <name>"`, map[string]string{"<name>": `$USER "x"`}, `echo "hello \$USER \"x\""`},
+		{"grep '<pattern>' log", map[string]string{"<pattern>": "it's"}, `grep 'it'\''s' log`},
+		{"cp <src> <src>.bak", map[string]string{"<src>": "a.txt"}, "cp a.txt a.txt.bak"},
+		{"ssh <user>@<host>", map[string]string{"<user>": "root", "<host>": ""}, "ssh root@<host>"},
+	}
+	for _, tt := range tests {
+		if got := Fill(tt.command, tt.values); got != tt.want {
+			t.Errorf("Fill(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".env", "b.txt", "a.txt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "src"), 0755)
+
+	got := Candidates(context.Background(), File, dir)
+	want := []string{"a.txt", "b.txt", "src/", ".env"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates = %q, want %q", got, want)
+	}
+	if got := Match(want, "T"); !reflect.DeepEqual(got, []string{"a.txt", "b.txt"}) {
+		t.Errorf("Match = %q", got)
+	}
+	if got := Match(want, "s"); !reflect.DeepEqual(got, []string{"src/"}) {
+		t.Errorf("Match = %q", got)
+	}
+}
+
+func typeKeys(f form, keys ...tea.KeyMsg) form {
+	for _, k := range keys {
+		updated, _ := f.Update(k)
+		f = updated.(form)
+	}
+	return f
+}
+
+func runes(s string) []tea.KeyMsg {
+	var keys []tea.KeyMsg
+	for _, r := range s {
+		keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return keys
+}
+
+func TestForm(t *testing.T) {
+	command := "docker cp <container>:/var/log/app.log <file>"
+	f := newForm(command, Detect(command, nil), t.TempDir())
+
+	updated, _ := f.Update(candidatesMsg{kind: Container, values: []string{"web-1", "web-2", "db"}})
+	f = updated.(form)
+
+	// Tab cycles through the containers matching what was typed.
+	f = typeKeys(f, runes("w")...)
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyTab})
+	if v := f.fields[0].input.Value(); v != "web-1" {
+		t.Errorf("after tab: %q, want web-1", v)
+	}
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyTab})
+	if v := f.fields[0].input.Value(); v != "web-2" {
+		t.Errorf("after a second tab: %q, want web-2", v)
+	}
+
+	// Enter moves on, and won't finish with a field empty.
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyEnter})
+	if f.done || f.focus != 1 || !strings.Contains(f.View(), "Fill in <file>") {
+		t.Fatalf("done %v, focus %d", f.done, f.focus)
+	}
+	f = typeKeys(f, runes("my log")...)
+	if !strings.Contains(f.View(), "docker cp web-2:/var/log/app.log 'my log'") {
+		t.Errorf("the view doesn't show the filled command:\n%s", f.View())
+	}
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyEnter})
+	if !f.done {
+		t.Fatal("enter on the last field should finish")
+	}
+	if got := Fill(command, f.values()); got != "docker cp web-2:/var/log/app.log 'my log'" {
+		t.Errorf("filled = %q", got)
+	}
+}
+
+func TestFormEsc(t *testing.T) {
+	f := newForm("cat <file>", Detect("cat <file>", nil), t.TempDir())
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyEsc})
+	if !f.skipped || f.cancelled {
+		t.Errorf("skipped %v, cancelled %v", f.skipped, f.cancelled)
+	}
+	f = newForm("cat <file>", Detect("cat <file>", nil), t.TempDir())
+	f = typeKeys(f, tea.KeyMsg{Type: tea.KeyCtrlC})
+	if !f.cancelled {
+		t.Error("ctrl+c should cancel")
+	}
+}
@@ -0,0 +1,317 @@
+// Package policy applies an administrator-defined rule file to generated
+// commands, so a team can block or gate commands the model suggests.
+//
+// The file (VIBE_POLICY_FILE, default ~/.config/vibe/policy.json) holds an
+// ordered list of rules:
+//
+//	{
+//	  "rules": [
+//	    {"name": "no-root-wipe", "regex": "rm\\s+-[a-zA-Z]*[rR][a-zA-Z]*\\s+/(\\s|$)", "action": "block"},
+//	    {"name": "prod-delete", "command": "kubectl delete", "when": {"kube_context": "prod-*"}, "action": "block",
+//	     "message": "Deleting in production needs a change ticket"},
+//	    {"name": "tf-destroy", "command": "terraform destroy", "action": "require-confirm"}
+//	  ]
+//	}
+//
+// The first rule that matches decides; a command no rule matches is allowed.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// Actions a rule can take.
+const (
+	Allow          = "allow"           // Stop evaluating; nothing happens
+	Warn           = "warn"            // Add the rule's message to the warning
+	RequireConfirm = "require-confirm" // Ask before inserting, even without VIBE_INTERACTIVE
+	Block          = "block"           // Never insert the command
+)
+
+// Policy is a parsed policy file. The zero value allows everything.
+type Policy struct {
+	Rules []*Rule `json:"rules"`
+	Path  string  `json:"-"` // Where it was loaded from; "" if there was no file
+}
+
+// Rule matches commands by Command, Regex or both, optionally only under the
+// conditions in When.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Command is a program name followed by words that must appear, in
+	// order, among its arguments: "kubectl delete" matches
+	// "kubectl --context prod delete ns x". Wrappers such as sudo are
+	// looked through.
+	Command string `json:"command"`
+
+	// Regex is matched against the whole command line.
+	Regex string `json:"regex"`
+
+	When    *When  `json:"when,omitempty"`
+	Action  string `json:"action"`
+	Message string `json:"message"`
+
+	words []string
+	re    *regexp.Regexp
+}
+
+// When restricts a rule to an environment. Values are path.Match patterns;
+// every condition given must hold.
+type When struct {
+	// Env maps variable names to patterns for their values; an unset
+	// variable matches as "".
+	Env map[string]string `json:"env"`
+
+	// KubeContext is matched against the context a kubectl command names
+	// with --context, or else the current kubeconfig context.
+	KubeContext string `json:"kube_context"`
+}
+
+// Decision is the outcome of evaluating a command.
+type Decision struct {
+	Action  string
+	Rule    *Rule // nil when no rule matched
+	Message string
+}
+
+// DefaultPath is where the policy file lives when VIBE_POLICY_FILE is unset:
+// next to the config file, honoring XDG_CONFIG_HOME.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "vibe", "policy.json")
+}
+
+// Load reads the policy file at file, or DefaultPath when file is "". A
+// missing file at the default location is an empty policy; one the user
+// named must exist.
+func Load(file string) (*Policy, error) {
+	explicit := file != ""
+	if !explicit {
+		file = DefaultPath()
+		if file == "" {
+			return &Policy{}, nil
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !explicit {
+			return &Policy{}, nil
+		}
+		return nil, err
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	p.Path = file
+	return p, nil
+}
+
+// Parse parses and validates a policy file's contents.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	for i, r := range p.Rules {
+		if r == nil {
+			return nil, fmt.Errorf("rule %d is empty", i+1)
+		}
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		switch r.Action {
+		case Allow, Warn, RequireConfirm, Block:
+		default:
+			return nil, fmt.Errorf("%s: unknown action %q (want allow, warn, require-confirm or block)", r.Name, r.Action)
+		}
+		if strings.TrimSpace(r.Command) == "" && r.Regex == "" {
+			return nil, fmt.Errorf("%s: needs a command or a regex", r.Name)
+		}
+		r.words = strings.Fields(r.Command)
+		if r.Regex != "" {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid regex: %w", r.Name, err)
+			}
+			r.re = re
+		}
+		if r.When != nil {
+			patterns := []string{r.When.KubeContext}
+			for _, v := range r.When.Env {
+				patterns = append(patterns, v)
+			}
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("%s: invalid pattern %q: %w", r.Name, pattern, err)
+				}
+			}
+		}
+	}
+	return &p, nil
+}
+
+// Evaluate returns the decision of the first rule matching command.
+func (p *Policy) Evaluate(command string) Decision {
+	if p == nil || len(p.Rules) == 0 {
+		return Decision{Action: Allow}
+	}
+
+	calls, err := safety.Commands(command)
+	if err != nil {
+		// Without a parse we can't tell where commands start, so let a
+		// command start at any word rather than let a parse error slip
+		// one past the rules.
+		fields := strings.Fields(command)
+		calls = nil
+		for i := range fields {
+			calls = append(calls, fields[i:])
+		}
+	}
+
+	for _, r := range p.Rules {
+		if r.matches(command, calls) {
+			msg := r.Message
+			if msg == "" {
+				msg = "matches policy rule " + r.Name
+			}
+			return Decision{Action: r.Action, Rule: r, Message: msg}
+		}
+	}
+	return Decision{Action: Allow}
+}
+
+// Apply evaluates resp's command. A warning or required confirmation is
+// added to resp's warning and raises its safety level to caution; a blocked
+// command is returned as an error wrapping apierrors.ErrPolicyBlocked, and
+// resp must not be handed out.
+func (p *Policy) Apply(resp *schema.CommandResponse) (Decision, error) {
+	d := p.Evaluate(resp.Command)
+	switch d.Action {
+	case Block:
+		return d, fmt.Errorf("%w: rule %q: %s", apierrors.ErrPolicyBlocked, d.Rule.Name, d.Message)
+	case Warn, RequireConfirm:
+		if resp.Warning != "" {
+			resp.Warning += "; "
+		}
+		resp.Warning += "policy: " + d.Message
+		if safety.Rank(resp.SafetyLevel) < safety.Rank(safety.Caution) {
+			resp.SafetyLevel = safety.Caution
+		}
+	}
+	return d, nil
+}
+
+func (r *Rule) matches(command string, calls [][]string) bool {
+	if r.re != nil && !r.re.MatchString(command) {
+		return false
+	}
+
+	matched := calls
+	if len(r.words) > 0 {
+		matched = nil
+		for _, args := range calls {
+			if matchWords(r.words, args) {
+				matched = append(matched, args)
+			}
+		}
+		if len(matched) == 0 {
+			return false
+		}
+	}
+	return r.When.holds(matched)
+}
+
+// matchWords reports whether args run the program words[0] with the rest of
+// words among its arguments, in order.
+func matchWords(words, args []string) bool {
+	if len(args) == 0 || path.Base(args[0]) != words[0] {
+		return false
+	}
+	rest := words[1:]
+	for _, arg := range args[1:] {
+		if len(rest) == 0 {
+			break
+		}
+		if arg == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+// holds reports whether the conditions are met; calls are the simple
+// commands the rule matched.
+func (w *When) holds(calls [][]string) bool {
+	if w == nil {
+		return true
+	}
+	for name, pattern := range w.Env {
+		if ok, _ := path.Match(pattern, os.Getenv(name)); !ok {
+			return false
+		}
+	}
+	if w.KubeContext != "" {
+		ctx := kubeContext(calls)
+		if ok, _ := path.Match(w.KubeContext, ctx); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// kubeContext returns the context named by a kubectl --context flag among
+// calls, or else the current kubeconfig context.
+func kubeContext(calls [][]string) string {
+	for _, args := range calls {
+		if path.Base(args[0]) != "kubectl" {
+			continue
+		}
+		for i, arg := range args {
+			if arg == "--context" && i+1 < len(args) {
+				return args[i+1]
+			}
+			if v, ok := strings.CutPrefix(arg, "--context="); ok {
+				return v
+			}
+		}
+	}
+	return currentKubeContext()
+}
+
+// currentKubeContext asks kubectl for the current context. It is a variable
+// so tests can replace it.
+var currentKubeContext = func() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "kubectl", "config", "current-context").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,126 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+const testPolicy = `{
+  "rules": [
+    {"name": "allow-dev-delete", "command": "kubectl delete", "when": {"kube_context": "dev-*"}, "action": "allow"},
+    {"name": "prod-delete", "command": "kubectl delete", "when": {"kube_context": "prod-*"}, "action": "block", "message": "no deletes in prod"},
+    {"name": "tf-destroy", "command": "terraform destroy", "action": "require-confirm"},
+    {"name": "root-wipe", "regex": "rm\\s+-[a-zA-Z]*[rR][a-zA-Z]*\\s+/(\\s|$)", "action": "block"},
+    {"name": "aws-prod", "command": "aws", "when": {"env": {"AWS_PROFILE": "prod*"}}, "action": "warn"}
+  ]
+}`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := currentKubeContext
+	currentKubeContext = func() string { return "prod-eu" }
+	t.Cleanup(func() { currentKubeContext = orig })
+	t.Setenv("AWS_PROFILE", "prod-admin")
+
+	tests := []struct {
+		command string
+		action  string
+		rule    string
+	}{
+		{"ls -la", Allow, ""},
+		{"kubectl get pods", Allow, ""},
+		{"kubectl delete pod web-1", Block, "prod-delete"},
+		{"sudo kubectl --context prod-us delete ns x", Block, "prod-delete"},
+		{"kubectl --context=dev-1 delete pod web-1", Allow, "allow-dev-delete"},
+		{"kubectl --context staging delete pod web-1", Allow, ""},
+		{"cd infra && terraform -chdir=prod destroy", RequireConfirm, "tf-destroy"},
+		{"terraform plan", Allow, ""},
+		{"sudo rm -rf / --no-preserve-root", Block, "root-wipe"},
+		{"rm -rf /tmp/x", Allow, ""},
+		{"aws s3 ls", Warn, "aws-prod"},
+		{"echo 'unterminated && terraform destroy", RequireConfirm, "tf-destroy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			d := p.Evaluate(tt.command)
+			rule := ""
+			if d.Rule != nil {
+				rule = d.Rule.Name
+			}
+			if d.Action != tt.action || rule != tt.rule {
+				t.Errorf("Evaluate(%q) = %s by %q, want %s by %q", tt.command, d.Action, rule, tt.action, tt.rule)
+			}
+			if d.Rule != nil && d.Message == "" {
+				t.Errorf("Evaluate(%q) has no message", tt.command)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"bad action":  `{"rules":[{"command":"ls","action":"deny"}]}`,
+		"no match":    `{"rules":[{"action":"block"}]}`,
+		"bad regex":   `{"rules":[{"regex":"(","action":"block"}]}`,
+		"bad pattern": `{"rules":[{"command":"ls","when":{"kube_context":"["},"action":"block"}]}`,
+		"not json":    `rules: []`,
+	}
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse accepted %s", name, data)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	p, err := Load("")
+	if err != nil || len(p.Rules) != 0 {
+		t.Errorf("Load without a file = %+v, %v; want an empty policy", p, err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load accepted a missing file the user named")
+	}
+
+	file := DefaultPath()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err = Load("")
+	if err != nil || len(p.Rules) != 5 || p.Path != file {
+		t.Errorf("Load = %+v, %v; want the 5 rules from %s", p, err, file)
+	}
+}
+
+func TestApply(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &schema.CommandResponse{Command: "terraform destroy", Warning: "destroys everything", SafetyLevel: "safe"}
+	if d, err := p.Apply(resp); err != nil || d.Action != RequireConfirm {
+		t.Fatalf("Apply = %+v, %v", d, err)
+	}
+	if resp.Warning != "destroys everything; policy: matches policy rule tf-destroy" || resp.SafetyLevel != safety.Caution {
+		t.Errorf("resp = %+v, want the policy warning and caution", resp)
+	}
+
+	_, err = p.Apply(&schema.CommandResponse{Command: "sudo rm -rf /"})
+	if !errors.Is(err, apierrors.ErrPolicyBlocked) || apierrors.ExitCode(err) != apierrors.ExitPolicyBlocked {
+		t.Errorf("Apply(blocked) = %v, want ErrPolicyBlocked", err)
+	}
+}
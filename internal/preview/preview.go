@@ -0,0 +1,675 @@
+// Package preview works out which files a destructive command would touch
+// without running it, for the confirmation dialog.
+//
+// Globs and substitutions are expanded by an in-process shell interpreter
+// that may only run read-only commands from system directories, with their
+// output capped, and only the selecting half of a pipeline (find ... -delete,
+// ... | xargs rm) is run. Anything that can't be shown to be free of side
+// effects is refused with ErrUnsafe.
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// MaxSample is how many paths a Result lists.
+const MaxSample = 10
+
+// maxPaths bounds how many paths are counted.
+const maxPaths = 10000
+
+// timeout bounds the whole preview, including any commands it runs.
+const timeout = 5 * time.Second
+
+// maxOutput bounds what a command run for the preview may print.
+const maxOutput = 1 << 20
+
+// systemBin are the directories commands run for a preview may come from.
+var systemBin = map[string]bool{
+	"/bin": true, "/sbin": true, "/usr/bin": true, "/usr/sbin": true,
+	"/usr/local/bin": true, "/opt/homebrew/bin": true,
+}
+
+var (
+	// ErrNotApplicable means the command doesn't delete, move or change the
+	// permissions of files, so there is nothing to preview.
+	ErrNotApplicable = errors.New("nothing to preview")
+
+	// ErrUnsafe means working out the paths would need something that
+	// could have side effects.
+	ErrUnsafe = errors.New("cannot preview without side effects")
+)
+
+// Result lists the paths a command would affect.
+type Result struct {
+	Action    string   // What the command does to them: "delete", "move", ...
+	Paths     []string // The first MaxSample paths
+	Total     int      // How many paths there are, including directory contents for recursive commands
+	Truncated bool     // Counting stopped at the limit; there are more
+}
+
+// Run previews command as if it ran in dir.
+func Run(ctx context.Context, command, dir string) (*Result, error) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, ErrNotApplicable
+	}
+	if !destructive(command) {
+		return nil, ErrNotApplicable
+	}
+	if len(file.Stmts) != 1 {
+		return nil, unsafe("only a single command or pipeline can be previewed")
+	}
+	stmt := file.Stmts[0]
+	if len(stmt.Redirs) > 0 || stmt.Background || stmt.Coprocess {
+		return nil, unsafe("the command has redirections or runs in the background")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	sh := &shell{dir: dir}
+
+	switch cmd := stmt.Cmd.(type) {
+	case *syntax.CallExpr:
+		args, err := sh.expand(ctx, cmd.Args)
+		if err != nil {
+			return nil, err
+		}
+		args = safety.Unwrap(args)
+		if len(args) > 0 && path.Base(args[0]) == "find" {
+			return sh.find(ctx, args)
+		}
+		action, targets, recursive, ok := affected(args)
+		if !ok {
+			return nil, ErrNotApplicable
+		}
+		return collect(dir, action, targets, recursive), nil
+
+	case *syntax.BinaryCmd:
+		if cmd.Op != syntax.Pipe {
+			return nil, unsafe("only pipelines into xargs can be previewed")
+		}
+		call, ok := cmd.Y.Cmd.(*syntax.CallExpr)
+		if !ok || len(cmd.Y.Redirs) > 0 {
+			return nil, unsafe("only pipelines into xargs can be previewed")
+		}
+		args, err := sh.expand(ctx, call.Args)
+		if err != nil {
+			return nil, err
+		}
+		x, err := parseXargs(args)
+		if err != nil {
+			return nil, err
+		}
+		action, _, recursive, ok := affected(x.command)
+		if !ok {
+			return nil, ErrNotApplicable
+		}
+
+		var out bytes.Buffer
+		if err := sh.run(ctx, cmd.X, &out); err != nil {
+			return nil, err
+		}
+		return collect(dir, action, x.split(out.String()), recursive), nil
+	}
+	return nil, unsafe("only a single command or pipeline can be previewed")
+}
+
+func unsafe(reason string) error {
+	return fmt.Errorf("%w: %s", ErrUnsafe, reason)
+}
+
+// destructive reports whether command deletes, moves or changes the
+// permissions of files anywhere.
+func destructive(command string) bool {
+	calls, err := safety.Commands(command)
+	if err != nil {
+		return false
+	}
+	for _, args := range calls {
+		if _, _, _, ok := affected(args); ok {
+			return true
+		}
+		if path.Base(args[0]) == "find" {
+			if _, _, ok := findAction(args); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// affected returns what args do and to which paths, for the commands a
+// preview understands.
+func affected(args []string) (action string, targets []string, recursive, ok bool) {
+	if len(args) == 0 {
+		return "", nil, false, false
+	}
+	name, rest := path.Base(args[0]), args[1:]
+	ops := operands(rest)
+	recursive = hasFlag(rest, 'r') || hasFlag(rest, 'R') || contains(rest, "--recursive")
+
+	switch name {
+	case "rm", "unlink", "rmdir", "shred":
+		return "delete", ops, recursive && name == "rm", true
+	case "mv":
+		for i, arg := range rest {
+			if (arg == "-t" || arg == "--target-directory") && i+1 < len(rest) {
+				return "move", without(ops, rest[i+1]), false, true
+			}
+			if strings.HasPrefix(arg, "--target-directory=") {
+				return "move", ops, false, true
+			}
+		}
+		if len(ops) > 0 {
+			ops = ops[:len(ops)-1]
+		}
+		return "move", ops, false, true
+	case "chmod", "chown", "chgrp":
+		if len(ops) > 0 && !hasPrefix(rest, "--reference=") {
+			ops = ops[1:]
+		}
+		action := map[string]string{"chmod": "change permissions of", "chown": "change owner of", "chgrp": "change group of"}[name]
+		return action, ops, recursive, true
+	}
+	return "", nil, false, false
+}
+
+// collect lists the targets that exist, with the contents of directories
+// when the command is recursive.
+func collect(dir, action string, targets []string, recursive bool) *Result {
+	r := &Result{Action: action}
+	add := func(p string) bool {
+		if r.Total >= maxPaths {
+			r.Truncated = true
+			return false
+		}
+		r.Total++
+		if len(r.Paths) < MaxSample {
+			r.Paths = append(r.Paths, p)
+		}
+		return true
+	}
+
+	for _, t := range targets {
+		full := t
+		if !filepath.IsAbs(full) {
+			full = filepath.Join(dir, t)
+		}
+		info, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+		if !recursive || !info.IsDir() {
+			if !add(t) {
+				break
+			}
+			continue
+		}
+		filepath.WalkDir(full, func(p string, _ fs.DirEntry, err error) error {
+			rel, _ := filepath.Rel(full, p)
+			if !add(filepath.Join(t, rel)) {
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if r.Truncated {
+			break
+		}
+	}
+	return r
+}
+
+// find previews a find command by running it with its destructive action
+// replaced by -print.
+func (sh *shell) find(ctx context.Context, args []string) (*Result, error) {
+	action, selection, ok := findAction(args)
+	if !ok {
+		return nil, ErrNotApplicable
+	}
+	if err := checkFind(selection); err != nil {
+		return nil, err
+	}
+
+	bin, err := program(selection[0])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	out := &limitWriter{w: &buf, n: maxOutput}
+	cmd := exec.CommandContext(ctx, bin, append(selection[1:], "-print")...)
+	cmd.Dir = sh.dir
+	cmd.Stdout = out
+	err = cmd.Run()
+	if out.over {
+		return nil, unsafe("find prints too much to preview")
+	}
+	if err != nil && buf.Len() == 0 {
+		return nil, fmt.Errorf("find failed: %w", err)
+	}
+	return collect(sh.dir, action, lines(buf.String()), false), nil
+}
+
+// findAction splits a find command into what it does to the files it finds
+// and the read-only selection, without the action.
+func findAction(args []string) (action string, selection []string, ok bool) {
+	selection = []string{args[0]}
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "-delete":
+			action = "delete"
+			continue
+		case "-exec", "-execdir", "-ok", "-okdir":
+			end := i + 1
+			for end < len(args) && args[end] != ";" && args[end] != "+" {
+				end++
+			}
+			if a, _, _, isFile := affected(args[i+1 : end]); isFile && end > i+1 {
+				action = a
+				i = end
+				continue
+			}
+		}
+		selection = append(selection, args[i])
+	}
+	return action, selection, action != ""
+}
+
+// findTests are the find primaries that only select files, with how many
+// arguments each takes.
+var findTests = map[string]int{
+	"-name": 1, "-iname": 1, "-path": 1, "-ipath": 1, "-wholename": 1, "-iwholename": 1,
+	"-regex": 1, "-iregex": 1, "-type": 1, "-xtype": 1, "-size": 1, "-perm": 1,
+	"-user": 1, "-group": 1, "-uid": 1, "-gid": 1, "-links": 1, "-inum": 1,
+	"-mtime": 1, "-mmin": 1, "-atime": 1, "-amin": 1, "-ctime": 1, "-cmin": 1,
+	"-newer": 1, "-anewer": 1, "-cnewer": 1, "-maxdepth": 1, "-mindepth": 1,
+	"-regextype": 1, "-samefile": 1, "-lname": 1, "-ilname": 1,
+	"-empty": 0, "-readable": 0, "-writable": 0, "-executable": 0, "-nouser": 0,
+	"-nogroup": 0, "-depth": 0, "-d": 0, "-mount": 0, "-xdev": 0, "-prune": 0,
+	"-follow": 0, "-true": 0, "-false": 0, "-print": 0, "-print0": 0,
+	"-not": 0, "!": 0, "(": 0, ")": 0, "-a": 0, "-and": 0, "-o": 0, "-or": 0, ",": 0,
+	"-H": 0, "-L": 0, "-P": 0,
+}
+
+// checkFind refuses find arguments that do anything but select files.
+func checkFind(args []string) error {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") && arg != "!" && arg != "(" && arg != ")" && arg != "," {
+			continue // A starting point, or a test's argument skipped below
+		}
+		n, ok := findTests[arg]
+		if !ok {
+			return unsafe("find " + arg + " may have side effects")
+		}
+		i += n
+	}
+	return nil
+}
+
+// xargs is a parsed xargs invocation.
+type xargs struct {
+	delim   string // "" splits on whitespace, "\n" on lines
+	command []string
+}
+
+func parseXargs(args []string) (*xargs, error) {
+	i := 0
+	for i < len(args) && path.Base(args[i]) != "xargs" {
+		i++
+	}
+	if i == len(args) {
+		return nil, ErrNotApplicable
+	}
+
+	x := &xargs{}
+	args = args[i+1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := args[0]
+		args = args[1:]
+		switch {
+		case opt == "--":
+			x.command = args
+			return x, nil
+		case opt == "-0" || opt == "--null":
+			x.delim = "\x00"
+		case opt == "-d" && len(args) > 0:
+			x.delim, args = args[0], args[1:]
+		case opt == "-I" || opt == "-L":
+			x.delim = "\n"
+			if len(args) > 0 {
+				args = args[1:]
+			}
+		case opt == "-a" || strings.HasPrefix(opt, "--arg-file"):
+			return nil, unsafe("xargs reads its arguments from a file")
+		case opt == "-n" || opt == "-P" || opt == "-s" || opt == "-E":
+			if len(args) > 0 {
+				args = args[1:]
+			}
+		}
+	}
+	x.command = safety.Unwrap(args)
+	return x, nil
+}
+
+// split divides xargs input into items.
+func (x *xargs) split(input string) []string {
+	if x.delim == "" {
+		return strings.Fields(input)
+	}
+	var items []string
+	for _, item := range strings.Split(input, x.delim) {
+		if item = strings.TrimSuffix(item, "\n"); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// shell is an interpreter restricted to read-only commands.
+type shell struct {
+	dir      string
+	expanded []string
+	refused  error // Why a command was not allowed to run
+}
+
+// expandMarker names the no-op call expand uses to capture expanded words.
+const expandMarker = "vibe-preview-expand"
+
+// expand returns words as the shell would expand them: globs matched in
+// the directory, variables and (read-only) command substitutions replaced.
+func (sh *shell) expand(ctx context.Context, words []*syntax.Word) ([]string, error) {
+	call := &syntax.CallExpr{Args: append([]*syntax.Word{{Parts: []syntax.WordPart{&syntax.Lit{Value: expandMarker}}}}, words...)}
+	sh.expanded = nil
+	if err := sh.run(ctx, &syntax.Stmt{Cmd: call}, io.Discard); err != nil {
+		return nil, err
+	}
+	return sh.expanded, nil
+}
+
+var globstar, _ = syntax.NewParser().Parse(strings.NewReader("shopt -s globstar"), "")
+
+// run runs node, writing its output to out.
+func (sh *shell) run(ctx context.Context, node syntax.Node, out io.Writer) error {
+	r, err := interp.New(
+		interp.Dir(sh.dir),
+		interp.Env(expand.ListEnviron(os.Environ()...)),
+		interp.StdIO(nil, out, io.Discard),
+		interp.CallHandler(sh.call),
+		interp.ExecHandler(sh.exec),
+		interp.OpenHandler(sh.open),
+	)
+	if err != nil {
+		return err
+	}
+	// zsh, which the commands are written for, matches ** recursively.
+	if err := r.Run(ctx, globstar); err != nil {
+		return err
+	}
+	err = r.Run(ctx, node)
+	if sh.refused != nil {
+		return sh.refused
+	}
+	if err != nil {
+		if errors.Is(err, ErrUnsafe) {
+			return err
+		}
+		if _, ok := interp.IsExitStatus(err); !ok {
+			return fmt.Errorf("preview failed: %w", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// call vets every command the interpreter is about to run.
+func (sh *shell) call(ctx context.Context, args []string) ([]string, error) {
+	if args[0] == expandMarker {
+		sh.expanded = append([]string(nil), args[1:]...)
+		return []string{":"}, nil
+	}
+	if err := readOnly(args); err != nil {
+		// The interpreter doesn't always pass a handler's error on (in
+		// command substitutions, for one), so keep it for run.
+		sh.refused = err
+		return nil, err
+	}
+	return args, nil
+}
+
+// exec runs a program the interpreter called, from a system directory and
+// with its output capped at maxOutput.
+func (sh *shell) exec(ctx context.Context, args []string) error {
+	bin, err := program(args[0])
+	if err != nil {
+		sh.refused = err
+		return err
+	}
+	hc := interp.HandlerCtx(ctx)
+	var env []string
+	hc.Env.Each(func(name string, vr expand.Variable) bool {
+		if vr.IsSet() && vr.Exported && vr.Kind == expand.String {
+			env = append(env, name+"="+vr.String())
+		}
+		return true
+	})
+	out := &limitWriter{w: hc.Stdout, n: maxOutput}
+	cmd := exec.CommandContext(ctx, bin, args[1:]...)
+	cmd.Env = env
+	cmd.Dir = hc.Dir
+	cmd.Stdin = hc.Stdin
+	cmd.Stdout = out
+	cmd.Stderr = hc.Stderr
+	err = cmd.Run()
+	if out.over {
+		sh.refused = unsafe(args[0] + " prints too much to preview")
+		return sh.refused
+	}
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errors.As(err, &exit):
+		return interp.NewExitStatus(uint8(exit.ExitCode()))
+	case err != nil:
+		return interp.NewExitStatus(127)
+	}
+	return nil
+}
+
+// program returns the path of the program name runs: only a command found
+// on the PATH in a system directory, never one named by a path (./ls) that
+// may be a script the command was generated next to.
+func program(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return "", unsafe("running " + name + " by its path is not known to be free of side effects")
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !systemBin[filepath.Clean(dir)] {
+			continue
+		}
+		bin := filepath.Join(dir, name)
+		if info, err := os.Stat(bin); err == nil && info.Mode().IsRegular() && info.Mode()&0o111 != 0 {
+			return bin, nil
+		}
+	}
+	return "", unsafe(name + " is not installed in a system directory")
+}
+
+// limitWriter passes on up to n bytes and fails once more are written.
+type limitWriter struct {
+	w    io.Writer
+	n    int
+	over bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		l.over = true
+		return 0, errors.New("output too long")
+	}
+	l.n -= len(p)
+	return l.w.Write(p)
+}
+
+// readOnly returns an ErrUnsafe error unless args is a command known not to
+// change anything. Programs must be named, not given by their path.
+func readOnly(args []string) error {
+	if strings.Contains(args[0], "/") {
+		return unsafe("running " + args[0] + " by its path is not known to be free of side effects")
+	}
+	name, rest := args[0], args[1:]
+	deny := func(flags ...string) error {
+		for _, arg := range rest {
+			for _, f := range flags {
+				if isFlag(arg, f) {
+					return unsafe(name + " " + arg + " may have side effects")
+				}
+			}
+		}
+		return nil
+	}
+
+	switch name {
+	case ":", "true", "false", "echo", "printf", "test", "[", "pwd", "cd", "shopt",
+		"ls", "cat", "head", "wc", "cut", "tr", "basename", "dirname", "realpath",
+		"readlink", "stat", "du", "file", "grep", "egrep", "fgrep", "comm", "seq":
+		return nil
+	case "tail":
+		return deny("-f", "-F", "--follow")
+	case "sort":
+		return deny("-o", "--output", "--compress-program")
+	case "uniq":
+		if len(operands(rest)) > 1 {
+			return unsafe("uniq with an output file")
+		}
+		return nil
+	case "rg":
+		return deny("--pre")
+	case "fd", "fdfind":
+		return deny("-x", "--exec", "-X", "--exec-batch")
+	case "find":
+		if _, _, ok := findAction(args); ok {
+			return unsafe("find changes the files it finds")
+		}
+		return checkFind(args)
+	case "git":
+		if len(rest) > 0 {
+			switch rest[0] {
+			case "ls-files", "ls-tree":
+				return nil
+			case "grep":
+				return deny("-O", "--open-files-in-pager")
+			case "diff":
+				return deny("--output")
+			}
+		}
+	}
+	return unsafe("running " + name + " is not known to be free of side effects")
+}
+
+// isFlag reports whether arg may be flag. A short flag also counts inside a
+// cluster or with its value attached (-no, -ofile), and a long one with its
+// value (--output=x) or abbreviated (--out), as getopt accepts them; a
+// false match only refuses a preview.
+func isFlag(arg, flag string) bool {
+	if long, ok := strings.CutPrefix(flag, "--"); ok {
+		given, ok := strings.CutPrefix(arg, "--")
+		given, _, _ = strings.Cut(given, "=")
+		return ok && given != "" && strings.HasPrefix(long, given)
+	}
+	return strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") &&
+		strings.Contains(arg[1:], flag[1:])
+}
+
+// open lets the interpreter read files and write only to /dev/null.
+func (sh *shell) open(ctx context.Context, name string, flag int, perm os.FileMode) (io.ReadWriteCloser, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 && name != "/dev/null" {
+		sh.refused = unsafe("the command writes to " + name)
+		return nil, sh.refused
+	}
+	return interp.DefaultOpenHandler()(ctx, name, flag, perm)
+}
+
+func lines(s string) []string {
+	var out []string
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// operands returns the arguments that aren't options.
+func operands(args []string) []string {
+	var out []string
+	afterDashes := false
+	for _, arg := range args {
+		if !afterDashes && arg == "--" {
+			afterDashes = true
+			continue
+		}
+		if afterDashes || !strings.HasPrefix(arg, "-") || arg == "-" {
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+func hasFlag(args []string, short rune) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(arg[1:], short) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(args []string, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(args []string, s string) bool {
+	for _, arg := range args {
+		if arg == s {
+			return true
+		}
+	}
+	return false
+}
+
+func without(args []string, s string) []string {
+	var out []string
+	for _, arg := range args {
+		if arg != s {
+			out = append(out, arg)
+		}
+	}
+	return out
+}
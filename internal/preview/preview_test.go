@@ -0,0 +1,137 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// tree creates files (and their directories) under a temporary directory.
+func tree(t *testing.T, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := tree(t, "a.log", "b.log", "keep.txt", "build/x.o", "build/sub/y.o", "src/main.go")
+
+	tests := []struct {
+		command string
+		action  string
+		paths   []string
+	}{
+		{"rm *.log", "delete", []string{"a.log", "b.log"}},
+		{"rm -f missing.log a.log", "delete", []string{"a.log"}},
+		{"sudo rm -rf build", "delete", []string{"build", "build/sub", "build/sub/y.o", "build/x.o"}},
+		{"rm **/*.o", "delete", []string{"build/sub/y.o", "build/x.o"}},
+		{"mv *.log src/", "move", []string{"a.log", "b.log"}},
+		{"chmod 600 $(ls *.txt)", "change permissions of", []string{"keep.txt"}},
+		{"find . -name '*.o' -delete", "delete", []string{"./build/sub/y.o", "./build/x.o"}},
+		{`find . -name '*.log' -exec rm {} \;`, "delete", []string{"./a.log", "./b.log"}},
+		{"ls | grep log | xargs rm", "delete", []string{"a.log", "b.log"}},
+		{"find build -type f -print0 | xargs -0 rm -f", "delete", []string{"build/sub/y.o", "build/x.o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			r, err := Run(context.Background(), tt.command, dir)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			sort.Strings(r.Paths)
+			if r.Action != tt.action || r.Total != len(tt.paths) || !equal(r.Paths, tt.paths) {
+				t.Errorf("Run = %s %v (total %d), want %s %v", r.Action, r.Paths, r.Total, tt.action, tt.paths)
+			}
+		})
+	}
+}
+
+func TestRunRefuses(t *testing.T) {
+	dir := tree(t, "a.log")
+	for _, name := range []string{"ls", "find"} {
+		script := "#!/bin/sh\ntouch ran\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notApplicable := []string{"ls -la", "echo rm", "grep -r TODO ."}
+	for _, command := range notApplicable {
+		if _, err := Run(context.Background(), command, dir); !errors.Is(err, ErrNotApplicable) {
+			t.Errorf("Run(%q) error = %v, want ErrNotApplicable", command, err)
+		}
+	}
+
+	unsafe := []string{
+		"rm $(touch created; echo a.log)",
+		"rm $(cat list > copy; echo a.log)",
+		"find . -name '*.log' -fprint out -delete",
+		"sed -i s/a/b/ a.log | xargs rm",
+		"cd /tmp && rm -rf x",
+		"find . -exec sed -i s/a/b/ {} \\; -delete",
+		"rm $(sort --compress-program=./x a.log)",
+		"rm $(sort --compress-prog ./x a.log)",
+		"rm $(sort -ocopy a.log)",
+		"rm $(git grep -O -l TODO)",
+		"rm $(git grep -Oless -l TODO)",
+		"rm $(git grep --open-files-in-pager=vi -l TODO)",
+		"rm $(./ls)",
+		"./find . -name '*.log' -delete",
+		"./ls | xargs rm",
+		"rm $(/usr/bin/env ls)",
+		"rm $(cat /dev/zero)",
+	}
+	for _, command := range unsafe {
+		if _, err := Run(context.Background(), command, dir); !errors.Is(err, ErrUnsafe) {
+			t.Errorf("Run(%q) error = %v, want ErrUnsafe", command, err)
+		}
+	}
+	for _, name := range []string{"created", "copy", "ran"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("a refused preview created %s", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.log")); err != nil {
+		t.Error("a preview deleted a file")
+	}
+}
+
+func TestRunLimitsSample(t *testing.T) {
+	var files []string
+	for i := 0; i < 25; i++ {
+		files = append(files, filepath.Join("logs", string(rune('a'+i))+".log"))
+	}
+	dir := tree(t, files...)
+
+	r, err := Run(context.Background(), "rm logs/*.log", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Total != 25 || len(r.Paths) != MaxSample {
+		t.Errorf("got %d paths of %d, want %d of 25", len(r.Paths), r.Total, MaxSample)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
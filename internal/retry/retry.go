@@ -0,0 +1,154 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrBudgetExhausted is returned when every attempt allowed by the policy has
+// already been used.
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// ErrDeadlineTooClose is returned by Wait when the context deadline would
+// expire before the backoff delay elapses, so waiting would be pointless.
+var ErrDeadlineTooClose = errors.New("overall deadline reached before next attempt")
+
+// Policy describes how a single generation retries failed requests. It is
+// shared by every parsing layer so that the total number of requests stays
+// bounded no matter which layer fails.
+type Policy struct {
+	MaxAttempts int           // Total requests allowed, including the first
+	BaseDelay   time.Duration // Delay before the first retry
+	MaxDelay    time.Duration // Upper bound for any computed delay
+	Jitter      float64       // Fraction of the delay randomized (0.0-1.0)
+}
+
+// NewPolicy builds a Policy from the user-facing retry count (retries after the
+// first attempt) using vibe's default backoff settings.
+func NewPolicy(maxRetries int) Policy {
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	return Policy{
+		MaxAttempts: maxRetries + 1,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    10 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Delay returns how long to wait before the given retry (1 = first retry).
+// The delay doubles each retry up to MaxDelay and is randomized by Jitter. A
+// positive retryAfter (from a Retry-After header) takes precedence, still
+// capped at MaxDelay.
+func (p Policy) Delay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return retryAfter
+	}
+
+	if retry < 1 {
+		retry = 1
+	}
+
+	d := p.BaseDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			d = p.MaxDelay
+			break
+		}
+	}
+
+	if p.Jitter > 0 {
+		spread := float64(d) * p.Jitter
+		d = time.Duration(float64(d) - spread + rand.Float64()*2*spread)
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// Budget tracks the attempts used by one generation against its Policy.
+// It is not safe for concurrent use.
+type Budget struct {
+	policy Policy
+	used   int
+}
+
+// NewBudget returns a fresh Budget for the policy.
+func (p Policy) NewBudget() *Budget {
+	return &Budget{policy: p}
+}
+
+// Take consumes one attempt. It returns ErrBudgetExhausted when none remain.
+func (b *Budget) Take() error {
+	if b.used >= b.policy.MaxAttempts {
+		return ErrBudgetExhausted
+	}
+	b.used++
+	return nil
+}
+
+// Used returns the number of attempts consumed so far.
+func (b *Budget) Used() int {
+	return b.used
+}
+
+// Remaining returns the number of attempts still available.
+func (b *Budget) Remaining() int {
+	return b.policy.MaxAttempts - b.used
+}
+
+// Max returns the total number of attempts the policy allows.
+func (b *Budget) Max() int {
+	return b.policy.MaxAttempts
+}
+
+// Policy returns the policy the budget was created from.
+func (b *Budget) Policy() Policy {
+	return b.policy
+}
+
+// Wait blocks for d, calling tick immediately and then once per second with
+// the time left so callers can show a countdown. It returns early with the
+// context error if ctx is done, or with ErrDeadlineTooClose if the context
+// deadline falls before d has elapsed.
+func Wait(ctx context.Context, d time.Duration, tick func(remaining time.Duration)) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return ErrDeadlineTooClose
+	}
+
+	end := time.Now().Add(d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	if tick != nil {
+		tick(d)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+			if tick != nil {
+				tick(time.Until(end))
+			}
+		}
+	}
+}
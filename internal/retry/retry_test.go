@@ -0,0 +1,119 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewPolicy(t *testing.T) {
+	p := NewPolicy(3)
+	if p.MaxAttempts != 4 {
+		t.Errorf("MaxAttempts = %d, want 4", p.MaxAttempts)
+	}
+
+	p = NewPolicy(-1)
+	if p.MaxAttempts != 1 {
+		t.Errorf("MaxAttempts for negative retries = %d, want 1", p.MaxAttempts)
+	}
+}
+
+func TestPolicyDelayExponential(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		retry int
+		want  time.Duration
+	}{
+		{1, 1 * time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.Delay(tt.retry, 0); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.retry, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyDelayJitter(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		got := p.Delay(1, 0)
+		if got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("Delay(1) = %v, want within 20%% of 1s", got)
+		}
+	}
+}
+
+func TestPolicyDelayRetryAfter(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+	if got := p.Delay(1, 3*time.Second); got != 3*time.Second {
+		t.Errorf("Delay with Retry-After 3s = %v, want 3s", got)
+	}
+	if got := p.Delay(1, time.Minute); got != 10*time.Second {
+		t.Errorf("Delay with Retry-After 1m = %v, want MaxDelay 10s", got)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := Policy{MaxAttempts: 2}.NewBudget()
+
+	if b.Remaining() != 2 {
+		t.Errorf("Remaining() = %d, want 2", b.Remaining())
+	}
+	if err := b.Take(); err != nil {
+		t.Fatalf("first Take() returned %v", err)
+	}
+	if err := b.Take(); err != nil {
+		t.Fatalf("second Take() returned %v", err)
+	}
+	if err := b.Take(); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("third Take() = %v, want ErrBudgetExhausted", err)
+	}
+	if b.Used() != 2 || b.Remaining() != 0 {
+		t.Errorf("Used() = %d, Remaining() = %d, want 2, 0", b.Used(), b.Remaining())
+	}
+}
+
+func TestWaitTicks(t *testing.T) {
+	var ticks []time.Duration
+	err := Wait(context.Background(), 50*time.Millisecond, func(remaining time.Duration) {
+		ticks = append(ticks, remaining)
+	})
+	if err != nil {
+		t.Fatalf("Wait returned %v", err)
+	}
+	if len(ticks) == 0 || ticks[0] != 50*time.Millisecond {
+		t.Errorf("first tick = %v, want the full delay", ticks)
+	}
+}
+
+func TestWaitDeadlineTooClose(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Wait(ctx, time.Second, nil)
+	if !errors.Is(err, ErrDeadlineTooClose) {
+		t.Errorf("Wait = %v, want ErrDeadlineTooClose", err)
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Error("Wait should return immediately when the deadline is too close")
+	}
+}
+
+func TestWaitCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := Wait(ctx, time.Second, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait = %v, want context.Canceled", err)
+	}
+}
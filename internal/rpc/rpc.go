@@ -0,0 +1,415 @@
+// Package rpc serves the command generator to editors over JSON-RPC 2.0.
+//
+// Messages are exchanged one JSON object per line on stdin and stdout. The
+// methods are:
+//
+//	generate      {"query": "..."}          -> schema.CommandResponse
+//	history.list  {"limit": 10}             -> []history.Entry, newest first
+//	cancel        {"id": <generate's id>}   -> {"cancelled": bool}
+//
+// While a generate request runs, the server sends "progress" notifications
+// with status messages, then "partial" notifications with the command and
+// each explanation line as they become available, before the final result.
+// Both carry the id of the request they belong to. Nothing but protocol
+// messages is written to the output.
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/logger"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+// JSON-RPC 2.0 error codes, plus the application codes vibe uses.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeGenerationFailed = -32000 // Data holds the exit code and a hint
+	CodePolicyBlocked    = -32001 // A policy rule blocks the command; data as above
+	CodeRequestCancelled = -32800 // As in the Language Server Protocol
+)
+
+// Methods and notifications.
+const (
+	MethodGenerate    = "generate"
+	MethodHistoryList = "history.list"
+	MethodCancel      = "cancel"
+
+	NotifyProgress = "progress"
+	NotifyPartial  = "partial"
+)
+
+// maxMessageSize bounds a single incoming line.
+const maxMessageSize = 1 << 20
+
+// Request is an incoming call. A request without an ID is a notification and
+// gets no reply.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response answers a Request with either Result or Error.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Notification is a message from the server about a running request.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// GenerateParams are the parameters of generate.
+type GenerateParams struct {
+	Query string `json:"query"`
+}
+
+// HistoryListParams are the parameters of history.list. A Limit of zero
+// returns every entry.
+type HistoryListParams struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// CancelParams are the parameters of cancel.
+type CancelParams struct {
+	ID json.RawMessage `json:"id"`
+}
+
+// CancelResult reports whether a running request was cancelled.
+type CancelResult struct {
+	Cancelled bool `json:"cancelled"`
+}
+
+// ProgressParams are the parameters of a progress notification.
+type ProgressParams struct {
+	ID      json.RawMessage `json:"id"`
+	Message string          `json:"message"`
+}
+
+// PartialParams are the parameters of a partial notification. Exactly one of
+// Command, Explanation and Warning is set.
+type PartialParams struct {
+	ID          json.RawMessage `json:"id"`
+	Command     string          `json:"command,omitempty"`
+	Explanation string          `json:"explanation,omitempty"`
+	Warning     string          `json:"warning,omitempty"`
+}
+
+// GenerationErrorData is the data of a CodeGenerationFailed or
+// CodePolicyBlocked error.
+type GenerationErrorData struct {
+	ExitCode int    `json:"exit_code"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+// Server answers JSON-RPC requests with a client and, if not nil, records
+// generated commands in a history. Commands are checked against a policy
+// before they are sent.
+type Server struct {
+	client  *client.Client
+	history *history.History
+	policy  *policy.Policy
+
+	// generating serializes generate requests: a client handles one query
+	// at a time.
+	generating sync.Mutex
+
+	outMu sync.Mutex
+	out   *json.Encoder
+
+	mu      sync.Mutex
+	pending map[string]context.CancelFunc // Running generate requests by ID
+	wg      sync.WaitGroup
+}
+
+// NewServer returns a server generating with c and applying pol. h may be
+// nil when history is disabled; history.list then returns no entries. A nil
+// pol allows everything.
+func NewServer(c *client.Client, h *history.History, pol *policy.Policy) *Server {
+	return &Server{
+		client:  c,
+		history: h,
+		policy:  pol,
+		pending: make(map[string]context.CancelFunc),
+	}
+}
+
+// Serve reads requests from in and writes replies to out until in is
+// exhausted or ctx is done. Requests still running when in ends are answered
+// before Serve returns; when ctx is done they are cancelled instead.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = json.NewEncoder(out)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		s.wg.Wait()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			s.wg.Wait()
+			return err
+		case line := <-lines:
+			if len(bytes.TrimSpace(line)) > 0 {
+				s.handle(ctx, line)
+			}
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, line []byte) {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		s.replyError(nil, CodeParseError, fmt.Sprintf("invalid JSON: %v", err), nil)
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		s.replyError(req.ID, CodeInvalidRequest, `expected a "jsonrpc": "2.0" request with a method`, nil)
+		return
+	}
+
+	switch req.Method {
+	case MethodGenerate:
+		var params GenerateParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.Query == "" {
+			s.replyError(req.ID, CodeInvalidParams, `generate needs a non-empty "query"`, nil)
+			return
+		}
+		s.startGenerate(ctx, req.ID, params.Query)
+	case MethodHistoryList:
+		var params HistoryListParams
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				s.replyError(req.ID, CodeInvalidParams, err.Error(), nil)
+				return
+			}
+		}
+		s.listHistory(req.ID, params)
+	case MethodCancel:
+		var params CancelParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ID) == 0 {
+			s.replyError(req.ID, CodeInvalidParams, `cancel needs the "id" of a generate request`, nil)
+			return
+		}
+		s.reply(req.ID, CancelResult{Cancelled: s.cancel(params.ID)})
+	default:
+		s.replyError(req.ID, CodeMethodNotFound, fmt.Sprintf("unknown method %q", req.Method), nil)
+	}
+}
+
+// startGenerate runs a generate request in the background, so cancel and
+// other requests are read while it runs.
+func (s *Server) startGenerate(ctx context.Context, id json.RawMessage, query string) {
+	ctx, cancel := context.WithCancel(ctx)
+	key := string(id)
+
+	s.mu.Lock()
+	if _, running := s.pending[key]; running && len(id) > 0 {
+		s.mu.Unlock()
+		cancel()
+		s.replyError(id, CodeInvalidRequest, "a request with this id is already running", nil)
+		return
+	}
+	if len(id) > 0 {
+		s.pending[key] = cancel
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.pending, key)
+			s.mu.Unlock()
+			cancel()
+		}()
+		s.generate(ctx, id, query)
+	}()
+}
+
+func (s *Server) generate(ctx context.Context, id json.RawMessage, query string) {
+	s.generating.Lock()
+	defer s.generating.Unlock()
+
+	if ctx.Err() != nil {
+		s.replyError(id, CodeRequestCancelled, "request cancelled", nil)
+		return
+	}
+
+	g, err := s.client.GenerateDetailed(ctx, query, &status{s: s, id: id})
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			s.replyError(id, CodeRequestCancelled, "request cancelled", nil)
+			return
+		}
+		s.replyError(id, CodeGenerationFailed, err.Error(), GenerationErrorData{
+			ExitCode: apierrors.ExitCode(err),
+			Hint:     apierrors.Hint(err),
+		})
+		return
+	}
+
+	// A blocked command, or one the audit log couldn't record, is never
+	// sent, not even as a partial.
+	if err := s.client.Suggest(s.policy, query, g); err != nil {
+		if errors.Is(err, apierrors.ErrPolicyBlocked) {
+			s.replyError(id, CodePolicyBlocked, err.Error(), GenerationErrorData{
+				ExitCode: apierrors.ExitCode(err),
+				Hint:     apierrors.Hint(err),
+			})
+		} else {
+			s.replyError(id, CodeInternalError, err.Error(), nil)
+		}
+		return
+	}
+	resp := g.Response
+
+	s.sendPartials(id, resp)
+
+	if s.history != nil && resp.Command != "" {
+		if err := s.history.Add(s.client.Scrub(query, resp.Command)); err != nil {
+			logger.Debug("Failed to save history: %v", err)
+		}
+	}
+	s.reply(id, resp)
+}
+
+// sendPartials sends the response piece by piece, the way the CLI streams it.
+func (s *Server) sendPartials(id json.RawMessage, resp *schema.CommandResponse) {
+	if len(id) == 0 {
+		return
+	}
+	if resp.Command != "" {
+		s.notify(NotifyPartial, PartialParams{ID: id, Command: resp.Command})
+	}
+	for _, line := range resp.Explanation {
+		s.notify(NotifyPartial, PartialParams{ID: id, Explanation: line})
+	}
+	if resp.Warning != "" {
+		s.notify(NotifyPartial, PartialParams{ID: id, Warning: resp.Warning})
+	}
+}
+
+// cancel stops the generate request with the given ID, if it is running.
+func (s *Server) cancel(id json.RawMessage) bool {
+	s.mu.Lock()
+	cancel, ok := s.pending[string(id)]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (s *Server) listHistory(id json.RawMessage, params HistoryListParams) {
+	entries := []history.Entry{}
+	if s.history != nil {
+		list, err := s.history.List()
+		if err != nil {
+			s.replyError(id, CodeInternalError, err.Error(), nil)
+			return
+		}
+		entries = list
+	}
+	if params.Limit > 0 && len(entries) > params.Limit {
+		entries = entries[:params.Limit]
+	}
+	s.reply(id, entries)
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}) {
+	if len(id) == 0 {
+		return
+	}
+	s.send(Response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// replyError answers a request with an error. Errors about a message that
+// could not be parsed are sent with a null ID, as the spec requires.
+func (s *Server) replyError(id json.RawMessage, code int, message string, data interface{}) {
+	if len(id) == 0 {
+		if code != CodeParseError && code != CodeInvalidRequest {
+			return
+		}
+		id = json.RawMessage("null")
+	}
+	s.send(Response{JSONRPC: "2.0", ID: id, Error: &Error{Code: code, Message: message, Data: data}})
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.send(Notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) send(v interface{}) {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+	if err := s.out.Encode(v); err != nil {
+		logger.Debug("RPC: failed to write message: %v", err)
+	}
+}
+
+// status sends a generate request's progress as notifications.
+type status struct {
+	s  *Server
+	id json.RawMessage
+}
+
+func (st *status) Start(_ context.Context, message string) { st.Update(message) }
+func (st *status) Stop()                                   {}
+
+func (st *status) Update(message string) {
+	if len(st.id) > 0 {
+		st.s.notify(NotifyProgress, ProgressParams{ID: st.id, Message: message})
+	}
+}
@@ -0,0 +1,256 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/client"
+	"github.com/skymoore/vibe-zsh/internal/config"
+	apierrors "github.com/skymoore/vibe-zsh/internal/errors"
+	"github.com/skymoore/vibe-zsh/internal/history"
+	"github.com/skymoore/vibe-zsh/internal/policy"
+)
+
+const validCompletion = `{"command":"ls -la","explanation":["ls: list directory contents","-la: all files, long format"]}`
+
+// chatServer answers every request with validCompletion. With block set it
+// instead waits until the request is abandoned.
+func chatServer(t *testing.T, block bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block {
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": validCompletion}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newServer(t *testing.T, url string) (*Server, *history.History) {
+	t.Helper()
+	t.Setenv("VIBE_CONFIG_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg := &config.Config{
+		Provider:             "vllm",
+		APIURL:               url,
+		Model:                "test-model",
+		Temperature:          0.2,
+		MaxTokens:            100,
+		Timeout:              5 * time.Second,
+		Deadline:             10 * time.Second,
+		MaxRetries:           1,
+		UseStructuredOutput:  true,
+		EnableJSONExtraction: true,
+		StrictValidation:     true,
+	}
+	h, err := history.New(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(client.New(cfg), h, nil), h
+}
+
+// message is any message the server writes.
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// roundTrip sends input to a server and returns everything it writes.
+func roundTrip(t *testing.T, s *Server, input string) []message {
+	t.Helper()
+	var out strings.Builder
+	if err := s.Serve(context.Background(), strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	return decodeAll(t, out.String())
+}
+
+func decodeAll(t *testing.T, output string) []message {
+	t.Helper()
+	var msgs []message
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "\x1b") {
+			t.Errorf("output contains an escape sequence: %q", line)
+		}
+		var m message
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid output line %q: %v", line, err)
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs
+}
+
+func TestGenerate(t *testing.T) {
+	s, h := newServer(t, chatServer(t, false).URL)
+	msgs := roundTrip(t, s, `{"jsonrpc":"2.0","id":1,"method":"generate","params":{"query":"list files"}}`+"\n")
+
+	var progress, partial int
+	for _, m := range msgs[:len(msgs)-1] {
+		switch m.Method {
+		case NotifyProgress:
+			progress++
+		case NotifyPartial:
+			partial++
+		default:
+			t.Errorf("unexpected message before the result: %+v", m)
+		}
+	}
+	if progress == 0 {
+		t.Error("no progress notifications")
+	}
+	if partial != 3 {
+		t.Errorf("got %d partial notifications, want 3 (command and two explanation lines)", partial)
+	}
+
+	last := msgs[len(msgs)-1]
+	if string(last.ID) != "1" || last.Error != nil {
+		t.Fatalf("final message = %+v, want the result for id 1", last)
+	}
+	var resp struct{ Command string }
+	if err := json.Unmarshal(last.Result, &resp); err != nil || resp.Command != "ls -la" {
+		t.Errorf("result = %s, want command %q", last.Result, "ls -la")
+	}
+
+	entries, _ := h.List()
+	if len(entries) != 1 || entries[0].Command != "ls -la" {
+		t.Errorf("history = %v, want the generated command", entries)
+	}
+}
+
+// TestGenerateBlocked checks that a command the policy blocks is answered
+// with an error and never sent, recorded or streamed.
+func TestGenerateBlocked(t *testing.T) {
+	s, h := newServer(t, chatServer(t, false).URL)
+	pol, err := policy.Parse([]byte(`{"rules": [{"name": "no-ls", "command": "ls", "action": "block"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.policy = pol
+
+	msgs := roundTrip(t, s, `{"jsonrpc":"2.0","id":1,"method":"generate","params":{"query":"list files"}}`+"\n")
+	for _, m := range msgs {
+		if m.Method == NotifyPartial {
+			t.Errorf("a blocked command was sent as a partial: %s", m.Params)
+		}
+	}
+	last := msgs[len(msgs)-1]
+	if last.Error == nil || last.Error.Code != CodePolicyBlocked || last.Result != nil {
+		t.Fatalf("final message = %+v, want a policy error", last)
+	}
+	data, _ := json.Marshal(last.Error.Data)
+	var got GenerationErrorData
+	if err := json.Unmarshal(data, &got); err != nil || got.ExitCode != apierrors.ExitPolicyBlocked {
+		t.Errorf("error data = %s, want exit code %d", data, apierrors.ExitPolicyBlocked)
+	}
+	if entries, _ := h.List(); len(entries) != 0 {
+		t.Errorf("history = %v, want nothing", entries)
+	}
+}
+
+func TestHistoryList(t *testing.T) {
+	s, h := newServer(t, chatServer(t, false).URL)
+	for _, cmd := range []string{"one", "two", "three"} {
+		if err := h.Add(cmd, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := roundTrip(t, s, `{"jsonrpc":"2.0","id":"h","method":"history.list","params":{"limit":2}}`+"\n")
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	var entries []history.Entry
+	if err := json.Unmarshal(msgs[0].Result, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Command != "three" {
+		t.Errorf("entries = %v, want the two newest", entries)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s, _ := newServer(t, chatServer(t, false).URL)
+	msgs := roundTrip(t, s, strings.Join([]string{
+		`not json`,
+		`{"jsonrpc":"2.0","id":1,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"generate","params":{}}`,
+		`{"jsonrpc":"2.0","method":"nope"}`, // A notification gets no reply
+		`{"id":3,"method":"generate"}`,
+	}, "\n")+"\n")
+
+	want := []int{CodeParseError, CodeMethodNotFound, CodeInvalidParams, CodeInvalidRequest}
+	if len(msgs) != len(want) {
+		t.Fatalf("got %d messages, want %d: %+v", len(msgs), len(want), msgs)
+	}
+	for i, m := range msgs {
+		if m.Error == nil || m.Error.Code != want[i] {
+			t.Errorf("message %d = %+v, want error code %d", i, m, want[i])
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	s, _ := newServer(t, chatServer(t, true).URL)
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":7,"method":"generate","params":{"query":"list files"}}`+"\n")
+
+	// Wait until generation is under way before cancelling it.
+	out := bufio.NewScanner(outR)
+	if !out.Scan() {
+		t.Fatal("no output before cancel")
+	}
+	io.WriteString(inW, `{"jsonrpc":"2.0","id":8,"method":"cancel","params":{"id":7}}`+"\n")
+	inW.Close()
+
+	var cancelled, result bool
+	for out.Scan() {
+		var m message
+		if err := json.Unmarshal(out.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+		switch string(m.ID) {
+		case "8":
+			cancelled = strings.Contains(string(m.Result), `"cancelled":true`)
+		case "7":
+			result = m.Error != nil && m.Error.Code == CodeRequestCancelled
+		}
+	}
+	if !cancelled {
+		t.Error("cancel did not report a cancelled request")
+	}
+	if !result {
+		t.Error("generate was not answered with CodeRequestCancelled")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
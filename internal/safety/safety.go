@@ -0,0 +1,640 @@
+// Package safety classifies how risky a generated command is by parsing it
+// with a shell parser, so the warning shown to the user does not depend on
+// the model choosing to give one.
+package safety
+
+import (
+	"bytes"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/schema"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Safety levels, as used in schema.CommandResponse.SafetyLevel.
+const (
+	Safe      = "safe"
+	Caution   = "caution"
+	Dangerous = "dangerous"
+)
+
+// Assessment is the result of analyzing a command.
+type Assessment struct {
+	Level   string   // Safe, Caution or Dangerous
+	Reasons []string // Why, for any level above Safe
+}
+
+// Rank orders levels from 0 (safe or unknown) to 2 (dangerous).
+func Rank(level string) int {
+	switch level {
+	case Dangerous:
+		return 2
+	case Caution:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Normalize maps the levels models tend to return onto Safe, Caution and
+// Dangerous. It returns "" for anything it doesn't recognize.
+func Normalize(level string) string {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "safe", "low", "none":
+		return Safe
+	case "caution", "warning", "medium", "moderate", "risky":
+		return Caution
+	case "dangerous", "danger", "high", "critical", "destructive":
+		return Dangerous
+	default:
+		return ""
+	}
+}
+
+// Apply analyzes resp.Command, with its placeholders masked, and records
+// the result in resp: SafetyLevel becomes the higher of the local and the
+// model's level, SafetyReason lists the local findings, and Warning keeps
+// the model's warning with the local findings added. The model's warning
+// and level are kept in ModelSafety the first time, so applying it again
+// starts from them: to the same response it changes nothing, and after the
+// command changes only the new command's findings are added.
+func Apply(resp *schema.CommandResponse) {
+	if strings.TrimSpace(resp.Command) == "" {
+		return
+	}
+	if resp.ModelSafety == nil {
+		resp.ModelSafety = &schema.ModelSafety{Warning: resp.Warning, SafetyLevel: resp.SafetyLevel}
+	}
+	a := Analyze(Mask(resp.Command, resp.Placeholders))
+
+	level := a.Level
+	model := Normalize(resp.ModelSafety.SafetyLevel)
+	if model == "" && strings.TrimSpace(resp.ModelSafety.Warning) != "" {
+		model = Caution
+	}
+	if Rank(model) > Rank(level) {
+		level = model
+	}
+
+	resp.SafetyLevel = level
+	resp.SafetyReason = strings.Join(a.Reasons, "; ")
+	resp.Warning = mergeWarning(resp.ModelSafety.Warning, a.Reasons)
+}
+
+// maskWord stands in for placeholders in a masked command.
+const maskWord = "PLACEHOLDER"
+
+// Mask replaces each of the placeholder tokens in command with a plain
+// word, so <container_id> parses as an argument rather than a redirection.
+func Mask(command string, tokens []string) string {
+	tokens = append([]string(nil), tokens...)
+	// Longer tokens first, so one inside another is masked with it.
+	sort.Slice(tokens, func(i, j int) bool { return len(tokens[i]) > len(tokens[j]) })
+	for _, token := range tokens {
+		if token != "" {
+			command = strings.ReplaceAll(command, token, maskWord)
+		}
+	}
+	return command
+}
+
+func mergeWarning(warning string, reasons []string) string {
+	parts := []string{}
+	if w := strings.TrimSpace(warning); w != "" {
+		parts = append(parts, w)
+	}
+	for _, r := range reasons {
+		if !strings.Contains(warning, r) {
+			parts = append(parts, r)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Analyze parses command as a shell program and classifies the risky things
+// it does. A command that can't be parsed can't be checked, so it is rated
+// Caution.
+func Analyze(command string) Assessment {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return Assessment{Level: Caution, Reasons: []string{"could not be parsed for a safety check"}}
+	}
+
+	a := &analysis{level: Safe}
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			a.redirects(n.Redirs)
+		case *syntax.BinaryCmd:
+			a.pipe(n)
+		case *syntax.CallExpr:
+			a.call(words(n.Args))
+			a.substitution(n)
+		}
+		return true
+	})
+	return Assessment{Level: a.level, Reasons: a.reasons}
+}
+
+// Commands returns the words of every simple command in command, including
+// those in pipelines, lists and substitutions. Wrappers such as sudo, env
+// and xargs are stripped, so "sudo kubectl delete ns x" yields
+// [kubectl delete ns x].
+func Commands(command string) ([][]string, error) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, err
+	}
+
+	var calls [][]string
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			if args := Unwrap(words(call.Args)); len(args) > 0 {
+				calls = append(calls, args)
+			}
+		}
+		return true
+	})
+	return calls, nil
+}
+
+// Target returns what a dangerous command acts on, for the user to type
+// back before running it: the paths rm -r deletes, dd's of= device, the disk
+// mkfs formats, a device a redirection overwrites. It returns "" when no
+// part of command is dangerous or the dangerous parts name more than one
+// target, or none (as in "ls | xargs rm -r").
+func Target(command string) string {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return ""
+	}
+
+	var targets []string
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			a := &analysis{level: Safe}
+			if a.redirects(n.Redirs); a.level == Dangerous {
+				for _, r := range n.Redirs {
+					if target := wordText(r.Word); isDevice(target) {
+						targets = append(targets, target)
+					}
+				}
+			}
+		case *syntax.CallExpr:
+			args := words(n.Args)
+			a := &analysis{level: Safe}
+			if a.call(args); a.level == Dangerous {
+				targets = append(targets, callTargets(Unwrap(args))...)
+			}
+		}
+		return true
+	})
+
+	if len(targets) == 0 {
+		return ""
+	}
+	for _, t := range targets[1:] {
+		if t != targets[0] {
+			return ""
+		}
+	}
+	return targets[0]
+}
+
+// callTargets returns the paths a command acts on.
+func callTargets(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	name := path.Base(args[0])
+	args = args[1:]
+	switch {
+	case name == "dd":
+		var targets []string
+		for _, arg := range args {
+			if target, ok := strings.CutPrefix(arg, "of="); ok {
+				targets = append(targets, target)
+			}
+		}
+		return targets
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		// The first operand is the mode or owner.
+		if ops := operands(args); len(ops) > 1 {
+			return ops[1:]
+		}
+		return nil
+	case name == "find":
+		var roots []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-") || arg == "(" || arg == "!" {
+				break
+			}
+			roots = append(roots, arg)
+		}
+		return roots
+	case name == "git":
+		return nil
+	default:
+		return operands(args)
+	}
+}
+
+// Unwrap strips commands that run another command, such as sudo, env and
+// xargs, along with their options, and returns the command they run.
+func Unwrap(args []string) []string {
+	return (&analysis{}).unwrap(args)
+}
+
+type analysis struct {
+	level   string
+	reasons []string
+}
+
+func (a *analysis) flag(level, reason string) {
+	if Rank(level) > Rank(a.level) {
+		a.level = level
+	}
+	for _, r := range a.reasons {
+		if r == reason {
+			return
+		}
+	}
+	a.reasons = append(a.reasons, reason)
+}
+
+// call checks a simple command, looking through wrappers such as sudo, env
+// and xargs to the command they run.
+func (a *analysis) call(args []string) {
+	args = a.unwrap(args)
+	if len(args) == 0 {
+		return
+	}
+
+	name := path.Base(args[0])
+	args = args[1:]
+	switch {
+	case name == "rm":
+		recursive := hasFlag(args, 'r', "--recursive") || hasFlag(args, 'R', "")
+		switch {
+		case recursive && anyBroad(args):
+			a.flag(Dangerous, "recursively deletes / or the home directory")
+		case recursive:
+			a.flag(Dangerous, "recursive delete (rm -r)")
+		case anyBroad(args):
+			a.flag(Dangerous, "deletes files at / or in the home directory")
+		default:
+			a.flag(Caution, "deletes files (rm)")
+		}
+	case name == "dd":
+		for _, arg := range args {
+			if target, ok := strings.CutPrefix(arg, "of="); ok {
+				if isDevice(target) {
+					a.flag(Dangerous, "dd writes directly to device "+target)
+				} else if !isHarmlessSink(target) {
+					a.flag(Caution, "dd overwrites "+target)
+				}
+			}
+		}
+	case name == "mkfs" || strings.HasPrefix(name, "mkfs.") || name == "mke2fs" || name == "mkswap" ||
+		name == "wipefs" || name == "fdisk" || name == "sfdisk" || name == "parted":
+		a.flag(Dangerous, "formats or repartitions a disk ("+name+")")
+	case name == "shred":
+		a.flag(Dangerous, "irrecoverably overwrites files (shred)")
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		a.permissions(name, args)
+	case name == "mv" && anyBroad(args):
+		a.flag(Dangerous, "moves / or the home directory")
+	case name == "find":
+		a.find(args)
+	case name == "git":
+		a.git(args)
+	case name == "tee" && !hasFlag(args, 'a', "--append"):
+		for _, arg := range operands(args) {
+			if !isHarmlessSink(arg) {
+				a.flag(Caution, "overwrites "+arg+" (tee)")
+			}
+		}
+	}
+}
+
+// unwrap strips commands that run another command, noting sudo on the way.
+func (a *analysis) unwrap(args []string) []string {
+	for len(args) > 0 {
+		switch path.Base(args[0]) {
+		case "sudo", "doas":
+			a.flag(Caution, "runs as root (sudo)")
+			args = skipOptions(args[1:], "-u", "-g", "-p", "-U", "-C", "-h", "-r", "-t")
+		case "env":
+			args = skipOptions(args[1:], "-u", "-C", "-S")
+			for len(args) > 0 && strings.Contains(args[0], "=") {
+				args = args[1:]
+			}
+		case "xargs":
+			args = skipOptions(args[1:], "-I", "-n", "-P", "-L", "-d", "-E", "-s", "-a")
+		case "nice":
+			args = skipOptions(args[1:], "-n")
+		case "nohup", "time", "exec", "command", "builtin":
+			args = skipOptions(args[1:])
+		default:
+			return args
+		}
+	}
+	return args
+}
+
+func (a *analysis) permissions(name string, args []string) {
+	recursive := hasFlag(args, 'R', "--recursive")
+	worldWritable := false
+	if name == "chmod" {
+		for _, arg := range operands(args) {
+			if isWorldWritable(arg) {
+				worldWritable = true
+				break
+			}
+		}
+	}
+
+	switch {
+	case recursive && anyBroad(args):
+		a.flag(Dangerous, "recursively changes permissions of / or the home directory ("+name+" -R)")
+	case recursive && worldWritable:
+		a.flag(Dangerous, "recursively makes files world-writable (chmod -R 777)")
+	case worldWritable:
+		a.flag(Caution, "makes files world-writable (chmod 777)")
+	case recursive:
+		a.flag(Caution, "recursively changes permissions ("+name+" -R)")
+	}
+}
+
+func (a *analysis) find(args []string) {
+	deletes := false
+	for i, arg := range args {
+		if arg == "-delete" {
+			deletes = true
+		}
+		if (arg == "-exec" || arg == "-execdir" || arg == "-ok") && i+1 < len(args) && path.Base(args[i+1]) == "rm" {
+			deletes = true
+		}
+	}
+	if !deletes {
+		return
+	}
+
+	var roots []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") || arg == "(" || arg == "!" {
+			break
+		}
+		roots = append(roots, arg)
+	}
+	if anyBroad(roots) {
+		a.flag(Dangerous, "deletes files found under / or the home directory (find)")
+	} else {
+		a.flag(Caution, "deletes the files it finds (find)")
+	}
+}
+
+func (a *analysis) git(args []string) {
+	if len(args) == 0 || args[0] != "push" {
+		return
+	}
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--force-with-lease" || strings.HasPrefix(arg, "--force-with-lease="):
+			a.flag(Caution, "force push (git push --force-with-lease)")
+		case arg == "--force" || (isShortFlags(arg) && strings.ContainsRune(arg, 'f')):
+			a.flag(Dangerous, "force push (git push --force)")
+		case strings.HasPrefix(arg, "+"):
+			a.flag(Dangerous, "force push ("+arg+")")
+		}
+	}
+}
+
+// redirects flags output redirections that replace a file's contents.
+func (a *analysis) redirects(redirs []*syntax.Redirect) {
+	for _, r := range redirs {
+		if r.Op != syntax.RdrOut && r.Op != syntax.ClbOut && r.Op != syntax.RdrAll {
+			continue
+		}
+		target := wordText(r.Word)
+		switch {
+		case isHarmlessSink(target):
+		case isDevice(target):
+			a.flag(Dangerous, "writes directly to device "+target)
+		default:
+			a.flag(Caution, "overwrites "+target+" (>)")
+		}
+	}
+}
+
+// pipe flags downloads piped into an interpreter (curl ... | sh).
+func (a *analysis) pipe(b *syntax.BinaryCmd) {
+	if b.Op != syntax.Pipe && b.Op != syntax.PipeAll {
+		return
+	}
+	if !downloads(b.X) {
+		return
+	}
+	if call, ok := b.Y.Cmd.(*syntax.CallExpr); ok {
+		args := Unwrap(words(call.Args))
+		if len(args) > 0 && isInterpreter(path.Base(args[0])) {
+			a.flag(Dangerous, "runs a script downloaded from the network ("+path.Base(args[0])+")")
+		}
+	}
+}
+
+// downloads reports whether node runs curl or wget anywhere, including in
+// command substitutions.
+func downloads(node syntax.Node) bool {
+	found := false
+	syntax.Walk(node, func(n syntax.Node) bool {
+		if call, ok := n.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+			switch path.Base(wordText(call.Args[0])) {
+			case "curl", "wget", "fetch":
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// substitution flags an interpreter fed a download through a substitution
+// (bash <(curl ...), sh -c "$(curl ...)"), which is as risky as a pipe.
+func (a *analysis) substitution(call *syntax.CallExpr) {
+	args := Unwrap(words(call.Args))
+	if len(args) == 0 || !isInterpreter(path.Base(args[0])) {
+		return
+	}
+	for _, w := range call.Args[1:] {
+		if downloads(w) {
+			a.flag(Dangerous, "runs a script downloaded from the network ("+path.Base(args[0])+")")
+			return
+		}
+	}
+}
+
+func isInterpreter(name string) bool {
+	switch name {
+	case "sh", "bash", "zsh", "dash", "ksh", "fish", "python", "python3", "perl", "ruby", "node":
+		return true
+	}
+	return false
+}
+
+// isBroad reports whether a path argument means the filesystem root or the
+// home directory, or everything directly in them.
+func isBroad(arg string) bool {
+	switch arg {
+	case "/", "/*", "/.",
+		"~", "~/", "~/*", "~/.",
+		"$HOME", "$HOME/", "$HOME/*", "$HOME/.":
+		return true
+	}
+	return false
+}
+
+func anyBroad(args []string) bool {
+	for _, arg := range operands(args) {
+		if isBroad(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDevice(target string) bool {
+	return strings.HasPrefix(target, "/dev/") && !isHarmlessSink(target)
+}
+
+// isHarmlessSink reports whether writing to target can't damage anything.
+func isHarmlessSink(target string) bool {
+	switch target {
+	case "/dev/null", "/dev/stdout", "/dev/stderr", "/dev/tty":
+		return true
+	}
+	return strings.HasPrefix(target, "/dev/fd/") || target == "-"
+}
+
+func isWorldWritable(mode string) bool {
+	if strings.Trim(mode, "01234567") == "" && len(mode) >= 3 {
+		other := mode[len(mode)-1] - '0'
+		return other&2 != 0
+	}
+	for _, clause := range strings.Split(mode, ",") {
+		who, perms, ok := strings.Cut(clause, "+")
+		if !ok {
+			who, perms, ok = strings.Cut(clause, "=")
+		}
+		if ok && (who == "" || strings.ContainsAny(who, "ao")) && strings.Contains(perms, "w") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFlag reports whether args contain the short flag (alone or combined, as
+// in -rf) or the long flag.
+func hasFlag(args []string, short rune, long string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if long != "" && arg == long {
+			return true
+		}
+		if isShortFlags(arg) && strings.ContainsRune(arg[1:], short) {
+			return true
+		}
+	}
+	return false
+}
+
+func isShortFlags(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && arg[1] != '-'
+}
+
+// operands returns the arguments that aren't options.
+func operands(args []string) []string {
+	var out []string
+	afterDashes := false
+	for _, arg := range args {
+		if !afterDashes && arg == "--" {
+			afterDashes = true
+			continue
+		}
+		if afterDashes || !strings.HasPrefix(arg, "-") || arg == "-" {
+			out = append(out, arg)
+		}
+	}
+	return out
+}
+
+// skipOptions drops leading options from args, along with the value of any
+// option listed in withValue.
+func skipOptions(args []string, withValue ...string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		}
+		for _, v := range withValue {
+			if opt == v && len(args) > 0 {
+				args = args[1:]
+				break
+			}
+		}
+	}
+	return args
+}
+
+func words(ws []*syntax.Word) []string {
+	out := make([]string, 0, len(ws))
+	for _, w := range ws {
+		out = append(out, wordText(w))
+	}
+	return out
+}
+
+// wordText renders a word with quotes removed and parameters kept as $NAME,
+// so "$HOME"/* and ~/* read alike to the checks.
+func wordText(w *syntax.Word) string {
+	if w == nil {
+		return ""
+	}
+	var b strings.Builder
+	writeParts(&b, w.Parts)
+	return b.String()
+}
+
+func writeParts(b *strings.Builder, parts []syntax.WordPart) {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			writeParts(b, p.Parts)
+		case *syntax.ParamExp:
+			if p.Param != nil && p.Exp == nil && p.Repl == nil && p.Index == nil && !p.Length && !p.Excl {
+				b.WriteString("$" + p.Param.Value)
+				continue
+			}
+			printNode(b, p)
+		default:
+			printNode(b, p)
+		}
+	}
+}
+
+func printNode(b *strings.Builder, node syntax.Node) {
+	var buf bytes.Buffer
+	if err := syntax.NewPrinter().Print(&buf, node); err == nil {
+		b.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,198 @@
+package safety
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skymoore/vibe-zsh/internal/schema"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"ls -la", Safe},
+		{"echo hi > /dev/null", Safe},
+		{"cat log >> out.txt", Safe},
+		{"find . -name '*.go' | xargs grep TODO", Safe},
+		{"git push origin main", Safe},
+		{"chmod 644 file", Safe},
+		{"dd if=disk.img bs=1M | gzip > disk.img.gz", Caution},
+
+		{"rm file.txt", Caution},
+		{"sudo apt update", Caution},
+		{"sort data > data.sorted", Caution},
+		{"chmod 777 script.sh", Caution},
+		{"find . -name '*.tmp' -delete", Caution},
+		{"git push --force-with-lease", Caution},
+		{"echo 'unterminated", Caution},
+
+		{"rm -rf node_modules", Dangerous},
+		{"rm -rf /", Dangerous},
+		{"sudo rm -fr ~/*", Dangerous},
+		{`rm -r "$HOME"`, Dangerous},
+		{"find / -name core -delete", Dangerous},
+		{"ls | xargs rm -r", Dangerous},
+		{"dd if=/dev/zero of=/dev/sda bs=1M", Dangerous},
+		{"cat image.iso > /dev/sdb", Dangerous},
+		{"mkfs.ext4 /dev/sdb1", Dangerous},
+		{"chmod -R 777 .", Dangerous},
+		{"sudo chown -R me ~", Dangerous},
+		{"curl -fsSL https://example.com/install.sh | sh", Dangerous},
+		{"wget -qO- https://example.com/x | sudo bash -s", Dangerous},
+		{`bash -c "$(curl -fsSL https://example.com/install.sh)"`, Dangerous},
+		{"bash <(curl -s https://example.com/x)", Dangerous},
+		{"git push -f origin main", Dangerous},
+		{"git push origin +main", Dangerous},
+		{"cd /tmp && rm -rf build", Dangerous},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			got := Analyze(tt.command)
+			if got.Level != tt.want {
+				t.Errorf("Analyze(%q) = %s %v, want %s", tt.command, got.Level, got.Reasons, tt.want)
+			}
+			if (got.Level == Safe) != (len(got.Reasons) == 0) {
+				t.Errorf("Analyze(%q) = %s with reasons %v", tt.command, got.Level, got.Reasons)
+			}
+		})
+	}
+}
+
+// TestGlobIsNotBroad checks that a glob of the current directory isn't
+// reported as / or the home directory.
+func TestGlobIsNotBroad(t *testing.T) {
+	for _, command := range []string{
+		"rm *",
+		"rm -r ./*",
+		"mv * dir/",
+		"chmod -R 755 *",
+	} {
+		for _, reason := range Analyze(command).Reasons {
+			if strings.Contains(reason, "/ or") {
+				t.Errorf("Analyze(%q) reports %q", command, reason)
+			}
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"rm -rf node_modules", "node_modules"},
+		{"cd /tmp && sudo rm -rf -- build", "build"},
+		{"rm -rf build && rm -rf build", "build"},
+		{"dd if=/dev/zero of=/dev/sda bs=1M", "/dev/sda"},
+		{"cat image.iso > /dev/sdb", "/dev/sdb"},
+		{"mkfs.ext4 /dev/sdb1", "/dev/sdb1"},
+		{"chmod -R 777 .", "."},
+		{"find / -name core -delete", "/"},
+
+		{"rm -rf build dist", ""},
+		{"ls | xargs rm -r", ""},
+		{"curl -fsSL https://example.com/install.sh | sh", ""},
+		{"git push -f origin main", ""},
+		{"rm file.txt", ""},
+		{"ls -la", ""},
+	}
+	for _, tt := range tests {
+		if got := Target(tt.command); got != tt.want {
+			t.Errorf("Target(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	resp := &schema.CommandResponse{
+		Command:     "rm -rf build",
+		Explanation: []string{"rm -rf build: delete the build directory"},
+		Warning:     "Deletes build outputs",
+		SafetyLevel: "safe",
+	}
+	Apply(resp)
+
+	if resp.SafetyLevel != Dangerous {
+		t.Errorf("SafetyLevel = %q, want %q despite the model", resp.SafetyLevel, Dangerous)
+	}
+	if resp.SafetyReason == "" {
+		t.Error("SafetyReason is empty")
+	}
+	if !strings.HasPrefix(resp.Warning, "Deletes build outputs; ") || !strings.Contains(resp.Warning, resp.SafetyReason) {
+		t.Errorf("Warning = %q, want the model's warning followed by %q", resp.Warning, resp.SafetyReason)
+	}
+
+	// Cached responses are analyzed again; that must not repeat anything.
+	before := *resp
+	Apply(resp)
+	if resp.Warning != before.Warning || resp.SafetyLevel != before.SafetyLevel {
+		t.Errorf("second Apply changed %+v to %+v", before, *resp)
+	}
+}
+
+// TestApplyAfterChange checks that a changed command, such as one with its
+// placeholders filled in, is analyzed afresh: the old command's findings
+// go, the model's warning and level stay.
+func TestApplyAfterChange(t *testing.T) {
+	resp := &schema.CommandResponse{
+		Command:      "rm -r <dir>",
+		Warning:      "Deletes the directory",
+		SafetyLevel:  "caution",
+		Placeholders: []string{"<dir>"},
+	}
+	Apply(resp)
+	if resp.SafetyLevel != Dangerous || strings.Contains(resp.Warning, "parsed") {
+		t.Fatalf("placeholder command: level %q, warning %q", resp.SafetyLevel, resp.Warning)
+	}
+
+	resp.Command, resp.Placeholders = "rmdir build", nil
+	Apply(resp)
+	if resp.SafetyLevel != Caution || resp.Warning != "Deletes the directory" || resp.SafetyReason != "" {
+		t.Errorf("filled command: level %q, warning %q, reason %q; want the model's caution and warning only", resp.SafetyLevel, resp.Warning, resp.SafetyReason)
+	}
+}
+
+func TestMask(t *testing.T) {
+	got := Mask("cp <path/to/file> <dir>/", []string{"<dir>", "<path/to/file>"})
+	if want := "cp PLACEHOLDER PLACEHOLDER/"; got != want {
+		t.Errorf("Mask = %q, want %q", got, want)
+	}
+}
+
+func TestApplyKeepsModelLevel(t *testing.T) {
+	resp := &schema.CommandResponse{Command: "kubectl delete namespace prod", SafetyLevel: "dangerous", Warning: "Deletes everything in prod"}
+	Apply(resp)
+	if resp.SafetyLevel != Dangerous || resp.Warning != "Deletes everything in prod" {
+		t.Errorf("got level %q warning %q, want the model's", resp.SafetyLevel, resp.Warning)
+	}
+
+	resp = &schema.CommandResponse{Command: "kubectl get pods", Warning: "Needs cluster access"}
+	Apply(resp)
+	if resp.SafetyLevel != Caution {
+		t.Errorf("a model warning without a level gave %q, want %q", resp.SafetyLevel, Caution)
+	}
+}
+
+func TestCheckSyntax(t *testing.T) {
+	tests := []struct {
+		command, shell string
+		ok             bool
+	}{
+		{"ls -la | grep go", "zsh", true},
+		{"echo 'unterminated", "zsh", false},
+		{"echo $(date", "/bin/bash", false},
+		{"if true; then echo x", "bash", false},
+		{"echo )", "bash", false},
+		{"print -l ${(f)lines}", "zsh", true}, // zsh-only syntax
+		{"echo 'unterminated", "fish", true},  // not checked
+		{"for f in *; do echo $f", "sh", false},
+	}
+	for _, tt := range tests {
+		err := CheckSyntax(tt.command, tt.shell)
+		if (err == nil) != tt.ok {
+			t.Errorf("CheckSyntax(%q, %q) = %v, want ok=%v", tt.command, tt.shell, err, tt.ok)
+		}
+	}
+}
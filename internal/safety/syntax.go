@@ -0,0 +1,35 @@
+package safety
+
+import (
+	"path"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// CheckSyntax parses command as the given shell (a name such as "zsh" or a
+// path such as /bin/bash) and returns the syntax error, if any.
+//
+// zsh is checked with the bash grammar, which rejects some valid zsh (glob
+// qualifiers, parameter flags), so for zsh only errors no shell would accept
+// are reported: unclosed quotes, substitutions and blocks. Shells without a
+// grammar here, such as fish, are not checked.
+func CheckSyntax(command, shell string) error {
+	var lang syntax.LangVariant
+	switch path.Base(shell) {
+	case "bash", "zsh":
+		lang = syntax.LangBash
+	case "sh", "dash", "ash", "posix":
+		lang = syntax.LangPOSIX
+	case "ksh", "mksh":
+		lang = syntax.LangMirBSDKorn
+	default:
+		return nil
+	}
+
+	_, err := syntax.NewParser(syntax.Variant(lang)).Parse(strings.NewReader(command), "")
+	if err != nil && path.Base(shell) == "zsh" && !syntax.IsIncomplete(err) {
+		return nil
+	}
+	return err
+}
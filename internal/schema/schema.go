@@ -11,6 +11,19 @@ type CommandResponse struct {
 	Warning      string   `json:"warning,omitempty"`
 	Alternatives []string `json:"alternatives,omitempty"`
 	SafetyLevel  string   `json:"safety_level,omitempty"`
+	Placeholders []string `json:"placeholders,omitempty"`  // Tokens in Command for the user to fill in
+	SafetyReason string   `json:"safety_reason,omitempty"` // Set by the local analyzer, not the model
+
+	// ModelSafety keeps the model's own warning and level, which the local
+	// analyzer merges its findings into, so a changed command (placeholders
+	// filled in) can be analyzed afresh.
+	ModelSafety *ModelSafety `json:"model_safety,omitempty"`
+}
+
+// ModelSafety is the warning and safety level as the model gave them.
+type ModelSafety struct {
+	Warning     string `json:"warning,omitempty"`
+	SafetyLevel string `json:"safety_level,omitempty"`
 }
 
 func (c *CommandResponse) Validate() error {
@@ -65,6 +78,13 @@ func GetJSONSchema() map[string]interface{} {
 				"type":        "string",
 				"description": "Safety level: safe, caution, or dangerous",
 			},
+			"placeholders": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+				"description": "Placeholders in the command the user must replace, exactly as written in it (e.g. <container_id>)",
+			},
 		},
 		"required":             []string{"command", "explanation"},
 		"additionalProperties": false,
@@ -106,6 +126,8 @@ STRICT RULES:
 11. Never warn about tool availability (jq, awk, etc.) - assume tools exist
 12. CRITICAL: Commands MUST work on %s - avoid GNU-specific flags on BSD systems
 13. CRITICAL: Explanations must be COMPLETE and READABLE - no "...", no "???", no truncation
+14. Tokens like __SECRET_1__ stand for values the user hid - copy them into the command exactly as written
+15. If the command needs a value you cannot know (an ID, a name, a path), write a placeholder such as <container_id> and list each one in a "placeholders" array, exactly as it appears in the command
 
 CORRECT OUTPUT:
 {"command":"find . -name '*.py' -mtime -7","explanation":["find: search for files",".: in current directory and subdirectories","-name '*.py': match Python files","-mtime -7: modified in last 7 days"]}
@@ -122,6 +144,20 @@ INCORRECT (Will cause parsing failure):
 Generate command for user query and respond with ONLY the JSON object.`, osName, shell, osName)
 }
 
+// GetRepairPrompt is the user turn asking the model to fix a command that
+// failed to parse, quoting the original request and the parser's error.
+func GetRepairPrompt(query, command, syntaxErr string) string {
+	return fmt.Sprintf(`The command you generated for this request has a shell syntax error.
+
+REQUEST: %s
+
+COMMAND: %s
+
+ERROR: %s
+
+Fix the syntax (unbalanced quotes, unclosed $(...), missing fi/done, etc.) without changing what the command does. Respond with the same JSON object format, containing the corrected command and its explanation.`, query, command, syntaxErr)
+}
+
 // Deprecated: Use GetSystemPrompt() instead
 const SystemPrompt = `You are VibeCLI, a precision shell command generator.
 
@@ -0,0 +1,314 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/skymoore/vibe-zsh/internal/safety"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// network lists programs that reach the network, and for tools that only
+// do so for some subcommands, which ones. A nil list means every use.
+var network = map[string][]string{
+	"curl": nil, "wget": nil, "aria2c": nil, "http": nil, "https": nil,
+	"ssh": nil, "scp": nil, "sftp": nil, "rsync": nil, "ftp": nil, "telnet": nil,
+	"nc": nil, "ncat": nil, "netcat": nil, "socat": nil,
+	"ping": nil, "dig": nil, "nslookup": nil, "host": nil, "traceroute": nil,
+	"git":    {"clone", "fetch", "pull", "push", "ls-remote", "submodule"},
+	"docker": {"pull", "push", "login", "run", "build"},
+	"podman": {"pull", "push", "login", "run", "build"},
+	"npm":    {"install", "i", "ci", "update", "publish", "exec"},
+	"pnpm":   {"install", "i", "add", "update", "publish", "dlx"},
+	"yarn":   {"install", "add", "upgrade", "publish", "dlx"},
+	"npx":    nil,
+	"pip":    {"install", "download"},
+	"pip3":   {"install", "download"},
+	"go":     {"get", "install", "mod"},
+	"cargo":  {"install", "fetch", "update", "publish"},
+	"gem":    {"install", "update", "push"},
+	"brew":   nil, "apt": nil, "apt-get": nil, "dnf": nil, "yum": nil, "pacman": nil,
+	"kubectl": nil, "helm": nil, "aws": nil, "gcloud": nil, "az": nil, "gh": nil,
+}
+
+// interpreters run code the check can't read: a script, or a program given
+// as an argument (python -c, perl -e, sh -c).
+var interpreters = regexp.MustCompile(`^(sh|bash|zsh|dash|ksh|mksh|csh|tcsh|fish|busybox|` +
+	`python[0-9.]*|pypy[0-9.]*|perl[0-9.]*|ruby[0-9.]*|irb|php[0-9.]*|lua[0-9.]*|luajit|` +
+	`node|nodejs|deno|bun|tclsh|wish|expect|Rscript|julia|pwsh|powershell|osascript)$`)
+
+// runners run code from their arguments or from files in the directory,
+// and for tools that only do so for some subcommands, which ones. A nil
+// list means every use.
+var runners = map[string][]string{
+	"eval": nil, "source": nil, ".": nil, "trap": nil, "watch": nil, "parallel": nil, "script": nil,
+	"make": nil, "just": nil, "rake": nil,
+	"npm":   {"run", "run-script", "test", "start"},
+	"pnpm":  {"run", "test", "start", "exec"},
+	"yarn":  {"run", "test", "start", "exec"},
+	"go":    {"run", "test", "generate"},
+	"cargo": {"run", "test", "build"},
+}
+
+// systemBin are the directories programs named by their path may come from;
+// anything else (./rename.sh) is a script the check can't read.
+var systemBin = map[string]bool{
+	"/bin": true, "/sbin": true, "/usr/bin": true, "/usr/sbin": true,
+	"/usr/local/bin": true, "/opt/homebrew/bin": true,
+}
+
+// awkUnchecked finds what lets an awk program run commands (system,
+// pipes) or write to files it names (print > "file").
+var awkUnchecked = regexp.MustCompile(`system|\||getline|>\s*[^\s0-9=(-]`)
+
+// devices are paths outside the snapshot commands may still use.
+var devices = map[string]bool{
+	"/dev/null": true, "/dev/zero": true, "/dev/random": true, "/dev/urandom": true,
+	"/dev/stdin": true, "/dev/stdout": true, "/dev/stderr": true, "/dev/tty": true,
+}
+
+// outsideVars are variables that point outside the working directory.
+var outsideVars = []string{"$HOME", "$TMPDIR", "$OLDPWD", "$XDG_"}
+
+// Check reports, wrapping ErrRefused, why command can't be tried in a
+// snapshot of dir: it names a path outside dir (or dir itself by its
+// absolute path, which would reach the real files), uses the network, runs
+// as root, changes to the home directory, or runs code the check can't
+// read (an interpreter, eval, a script, make). The check is made on the
+// command's text; it can't see what the programs it runs do.
+func Check(command, dir string) error {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil {
+		return refuse("it could not be parsed")
+	}
+
+	// Program names may be absolute paths (/usr/bin/sed); only their
+	// arguments are checked as paths.
+	programs := make(map[*syntax.Word]bool)
+	var reason string
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if reason != "" {
+			return false
+		}
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			if len(n.Args) > 0 {
+				programs[n.Args[0]] = true
+			}
+			reason = checkCall(words(n.Args))
+		case *syntax.Word:
+			if !programs[n] {
+				reason = checkPath(wordText(n), dir)
+			}
+		}
+		return true
+	})
+	if reason != "" {
+		return refuse(reason)
+	}
+	return nil
+}
+
+func refuse(reason string) error {
+	return fmt.Errorf("%w: %s", ErrRefused, reason)
+}
+
+func checkCall(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	switch filepath.Base(args[0]) {
+	case "sudo", "doas", "su", "pkexec":
+		return "it runs as root"
+	case "cd", "pushd":
+		if len(args) == 1 {
+			return "it changes to the home directory"
+		}
+		if args[1] == "-" {
+			return "it changes to the previous directory"
+		}
+	}
+
+	args = unwrap(args)
+	if len(args) == 0 {
+		return ""
+	}
+	name := filepath.Base(args[0])
+	switch {
+	case interpreters.MatchString(name):
+		return fmt.Sprintf("%s runs code that can't be checked", name)
+	case strings.Contains(args[0], "/") && !systemBin[filepath.Dir(filepath.Clean(args[0]))]:
+		return fmt.Sprintf("%s is a script or program that can't be checked", args[0])
+	case strings.HasSuffix(name, "awk"):
+		for _, arg := range args[1:] {
+			if arg == "-f" || strings.HasPrefix(arg, "--file") || awkUnchecked.MatchString(arg) {
+				return fmt.Sprintf("the %s program may run commands or write files", name)
+			}
+		}
+	case name == "find":
+		for i, arg := range args {
+			switch arg {
+			case "-exec", "-execdir", "-ok", "-okdir":
+				if reason := checkCall(execArgs(args[i+1:])); reason != "" {
+					return reason
+				}
+			}
+		}
+	}
+	if sub, ok := subcommand(name, args[1:], runners); ok {
+		return strings.TrimSpace(fmt.Sprintf("%s %s runs code that can't be checked", name, sub))
+	}
+	if sub, ok := subcommand(name, args[1:], network); ok {
+		return strings.TrimSpace(fmt.Sprintf("%s %s uses the network", name, sub))
+	}
+	return ""
+}
+
+// unwrap strips wrappers that run another command, those safety.Unwrap
+// knows and a few more, and returns the command they run.
+func unwrap(args []string) []string {
+	for {
+		args = safety.Unwrap(args)
+		if len(args) == 0 {
+			return args
+		}
+		switch filepath.Base(args[0]) {
+		case "timeout":
+			args = skipOptions(args[1:])
+			if len(args) > 0 {
+				args = args[1:] // The duration
+			}
+		case "setsid", "stdbuf", "ionice", "chrt", "flock":
+			args = skipOptions(args[1:])
+		default:
+			return args
+		}
+	}
+}
+
+func skipOptions(args []string) []string {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		args = args[1:]
+	}
+	return args
+}
+
+// subcommand reports whether the program name with arguments args is listed
+// in programs, for all its uses or for the subcommand it returns.
+func subcommand(name string, args []string, programs map[string][]string) (string, bool) {
+	subcommands, ok := programs[name]
+	if !ok {
+		return "", false
+	}
+	if subcommands == nil {
+		return "", true
+	}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		for _, sub := range subcommands {
+			if arg == sub {
+				return sub, true
+			}
+		}
+		break
+	}
+	return "", false
+}
+
+// execArgs returns the command a find -exec runs, up to its ; or +.
+func execArgs(args []string) []string {
+	for i, arg := range args {
+		if arg == ";" || arg == `\;` || arg == "+" {
+			return args[:i]
+		}
+	}
+	return args
+}
+
+// checkPath reports why an argument refers to somewhere outside the
+// snapshot. Absolute arguments only count as paths when they or their
+// parent exist, so sed expressions such as /^#/d pass.
+func checkPath(arg, dir string) string {
+	// Options carry paths too: --output=/tmp/x.
+	if strings.HasPrefix(arg, "-") {
+		if i := strings.Index(arg, "="); i >= 0 {
+			arg = arg[i+1:]
+		}
+	}
+	if arg == "" {
+		return ""
+	}
+	if strings.HasPrefix(arg, "~") {
+		return fmt.Sprintf("%s is outside the directory", arg)
+	}
+	for _, v := range outsideVars {
+		if strings.Contains(arg, v) {
+			return fmt.Sprintf("%s is outside the directory", arg)
+		}
+	}
+
+	if filepath.IsAbs(arg) {
+		clean := filepath.Clean(arg)
+		if devices[clean] {
+			return ""
+		}
+		if !exists(clean) && !exists(filepath.Dir(clean)) {
+			return ""
+		}
+		if clean == dir || strings.HasPrefix(clean, dir+string(filepath.Separator)) {
+			return fmt.Sprintf("%s names the real directory, not the snapshot; use a relative path", arg)
+		}
+		return fmt.Sprintf("%s is outside the directory", arg)
+	}
+
+	clean := filepath.Clean(arg)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Sprintf("%s is outside the directory", arg)
+	}
+	return ""
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func words(ws []*syntax.Word) []string {
+	out := make([]string, 0, len(ws))
+	for _, w := range ws {
+		out = append(out, wordText(w))
+	}
+	return out
+}
+
+// wordText renders a word with quotes removed and parameters kept as
+// written, so "$HOME"/x and ~/x are both seen to leave the directory.
+func wordText(w *syntax.Word) string {
+	var b strings.Builder
+	writeParts(&b, w.Parts)
+	return b.String()
+}
+
+func writeParts(b *strings.Builder, parts []syntax.WordPart) {
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(p.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(p.Value)
+		case *syntax.DblQuoted:
+			writeParts(b, p.Parts)
+		default:
+			// Substitutions are checked as commands of their own; keep
+			// parameters as $NAME.
+			if pe, ok := p.(*syntax.ParamExp); ok && pe.Param != nil {
+				b.WriteString("$" + pe.Param.Value)
+			}
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxDiffSize is the largest file a Change includes a diff for.
+const maxDiffSize = 256 << 10
+
+// maxDiffCells bounds the work a line diff may take (lines before times
+// lines after).
+const maxDiffCells = 4 << 20
+
+// diffContext is how many unchanged lines surround each hunk.
+const diffContext = 3
+
+// Kinds of change.
+const (
+	Created  = "created"
+	Modified = "modified"
+	Deleted  = "deleted"
+	Renamed  = "renamed"
+)
+
+// Change is one path the command changed.
+type Change struct {
+	Kind   string // Created, Modified, Deleted or Renamed
+	Path   string // Relative to the directory; directories end in /
+	From   string // The old path, for Renamed
+	Detail string // A mode or type change, or why there is no diff
+	Diff   string // Unified diff of a modified text file
+}
+
+// compare lists what changed between two scans, by path. A deleted file
+// whose content turns up at a new path is reported as renamed.
+func compare(before, after map[string]*entry) []Change {
+	var changes, created, deleted []Change
+	for rel, b := range before {
+		a, ok := after[rel]
+		if !ok {
+			deleted = append(deleted, Change{Kind: Deleted, Path: display(rel, b)})
+			continue
+		}
+		if c, changed := modified(rel, b, a); changed {
+			changes = append(changes, c)
+		}
+	}
+	for rel, a := range after {
+		if _, ok := before[rel]; !ok {
+			created = append(created, Change{Kind: Created, Path: display(rel, a)})
+		}
+	}
+
+	// Pair renames by content, oldest path first so the result is stable.
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Path < deleted[j].Path })
+	sort.Slice(created, func(i, j int) bool { return created[i].Path < created[j].Path })
+	paired := make(map[string]bool)
+	for _, d := range deleted {
+		b := before[d.Path]
+		if b == nil || !b.mode.IsRegular() {
+			changes = append(changes, d)
+			continue
+		}
+		renamed := false
+		for _, c := range created {
+			a := after[c.Path]
+			if paired[c.Path] || a == nil || !a.mode.IsRegular() || a.hash != b.hash {
+				continue
+			}
+			paired[c.Path] = true
+			changes = append(changes, Change{Kind: Renamed, Path: c.Path, From: d.Path})
+			renamed = true
+			break
+		}
+		if !renamed {
+			changes = append(changes, d)
+		}
+	}
+	for _, c := range created {
+		if !paired[c.Path] {
+			changes = append(changes, c)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func display(rel string, e *entry) string {
+	if e.mode.IsDir() {
+		return rel + "/"
+	}
+	return rel
+}
+
+func modified(rel string, b, a *entry) (Change, bool) {
+	c := Change{Kind: Modified, Path: display(rel, a)}
+	var details []string
+	if b.mode.Type() != a.mode.Type() {
+		details = append(details, fmt.Sprintf("%s -> %s", kind(b), kind(a)))
+	} else if b.mode.Perm() != a.mode.Perm() {
+		details = append(details, fmt.Sprintf("mode %04o -> %04o", b.mode.Perm(), a.mode.Perm()))
+	}
+	if b.link != a.link {
+		details = append(details, fmt.Sprintf("link %s -> %s", b.link, a.link))
+	}
+	contentChanged := b.mode.IsRegular() && a.mode.IsRegular() && b.hash != a.hash
+	if contentChanged {
+		switch {
+		case b.data == nil || a.data == nil:
+			details = append(details, "binary or large file changed")
+		default:
+			if d, ok := unifiedDiff(rel, string(b.data), string(a.data)); ok {
+				c.Diff = d
+			} else {
+				details = append(details, "too many changes to diff")
+			}
+		}
+	}
+	if len(details) == 0 && !contentChanged {
+		return c, false
+	}
+	c.Detail = strings.Join(details, ", ")
+	return c, true
+}
+
+func kind(e *entry) string {
+	switch {
+	case e.mode.IsDir():
+		return "directory"
+	case e.mode.IsRegular():
+		return "file"
+	case e.link != "":
+		return "symlink"
+	default:
+		return "special file"
+	}
+}
+
+// unifiedDiff renders the line changes between two versions of a file in
+// unified format. It gives up (returning false) when the files are too
+// large to compare.
+func unifiedDiff(name, from, to string) (string, bool) {
+	a, b := splitLines(from), splitLines(to)
+	if len(a)*len(b) > maxDiffCells {
+		return "", false
+	}
+
+	// Longest common subsequence, from the end, so the edit script can be
+	// read off front to back.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte // ' ', '-' or '+'
+		text string
+		i, j int // Line numbers in a and b before this line
+	}
+	var script []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			script = append(script, line{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			script = append(script, line{'-', a[i], i, j})
+			i++
+		default:
+			script = append(script, line{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", name, name)
+	for start := 0; start < len(script); {
+		// Find the next change and the end of its hunk: changes closer
+		// than twice the context share one.
+		for start < len(script) && script[start].op == ' ' {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+		first := max(start-diffContext, 0)
+		end, unchanged := start, 0
+		for end < len(script) && unchanged <= 2*diffContext {
+			if script[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		last := min(end-unchanged+diffContext, len(script))
+
+		hunk := script[first:last]
+		var oldLines, newLines int
+		for _, l := range hunk {
+			if l.op != '+' {
+				oldLines++
+			}
+			if l.op != '-' {
+				newLines++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunk[0].i, oldLines), hunkRange(hunk[0].j, newLines))
+		for _, l := range hunk {
+			out.WriteByte(l.op)
+			out.WriteString(l.text)
+			out.WriteByte('\n')
+		}
+		start = last
+	}
+	return out.String(), true
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
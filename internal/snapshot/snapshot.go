@@ -0,0 +1,350 @@
+// Package snapshot runs a command against a throwaway copy of a directory
+// and reports the files it created, modified and deleted, so a batch rename
+// or an in-place edit can be checked before it runs for real.
+//
+// The copy is not a sandbox: Check refuses commands that name paths outside
+// the directory, use the network, run as root or run code it can't read
+// (interpreters, eval, scripts), but a program the command starts can still
+// reach anything the user can.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMaxSize is how many bytes of files a snapshot may copy.
+const DefaultMaxSize int64 = 100 << 20
+
+// DefaultTimeout bounds how long the command may run in the snapshot.
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput bounds how much of the command's output is kept.
+const maxOutput = 64 << 10
+
+var (
+	// ErrRefused means the command can't be tried safely in a snapshot.
+	ErrRefused = errors.New("cannot try this command in a snapshot")
+
+	// ErrTooLarge means the directory holds more than the size limit.
+	ErrTooLarge = errors.New("directory is too large to snapshot")
+)
+
+// Options configures Try. Zero values use the defaults.
+type Options struct {
+	Shell   string        // Shell that runs the command (default sh)
+	MaxSize int64         // Bytes of files to copy at most (default DefaultMaxSize)
+	Timeout time.Duration // How long the command may run (default DefaultTimeout)
+}
+
+// Result is what running a command in a snapshot did.
+type Result struct {
+	Files    int      // Files copied into the snapshot
+	Size     int64    // Bytes copied
+	Output   []byte   // Combined stdout and stderr, cut at 64 KiB
+	ExitCode int      // The command's exit status, -1 if it was killed
+	TimedOut bool     // The command ran past the timeout
+	Changes  []Change // What changed, by path
+}
+
+// Try copies dir to a temporary directory, runs command there with its
+// working directory and $PWD pointed at the copy, and compares the copy
+// with what was copied. The copy is removed before Try returns.
+//
+// Commands that Check refuses are not run.
+func Try(ctx context.Context, command, dir string, opts Options) (*Result, error) {
+	if err := Check(command, dir); err != nil {
+		return nil, err
+	}
+	if opts.Shell == "" {
+		opts.Shell = "sh"
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	shell, err := exec.LookPath(opts.Shell)
+	if err != nil {
+		return nil, fmt.Errorf("shell %s: %w", opts.Shell, err)
+	}
+
+	tmp, err := os.MkdirTemp("", "vibe-try-")
+	if err != nil {
+		return nil, err
+	}
+	defer removeAll(tmp)
+
+	// Keep the directory's name so commands that look at it see the same.
+	root := filepath.Join(tmp, filepath.Base(dir))
+	before, size, err := copyTree(dir, root, opts.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Size: size}
+	for _, e := range before {
+		if e.mode.IsRegular() {
+			res.Files++
+		}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(runCtx, shell, "-c", command)
+	cmd.Dir = root
+	cmd.Env = environ(root)
+	out := &limitedBuffer{max: maxOutput}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+	res.Output = out.Bytes()
+	res.TimedOut = errors.Is(runCtx.Err(), context.DeadlineExceeded)
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	case err != nil && !res.TimedOut:
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	after, err := scan(root)
+	if err != nil {
+		return nil, err
+	}
+	res.Changes = compare(before, after)
+	return res, nil
+}
+
+// entry is what a snapshot records about one path.
+type entry struct {
+	mode fs.FileMode
+	hash [sha256.Size]byte // Regular files only
+	link string            // Symlinks only
+	data []byte            // Small text files only, for diffs
+}
+
+// copyTree copies src to dst, recording every path it copies. Symlinks are
+// copied as links and must stay inside src; sockets, pipes and devices are
+// skipped.
+func copyTree(src, dst string, maxSize int64) (map[string]*entry, int64, error) {
+	entries := make(map[string]*entry)
+	var size int64
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			// Owner write access is needed to fill the copy; the real
+			// mode is put back once the directory is done.
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			if rel != "." {
+				entries[rel] = &entry{mode: info.Mode()}
+			}
+			return nil
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if escapes(src, filepath.Dir(path), link) {
+				return refuse(fmt.Sprintf("%s links outside the directory", rel))
+			}
+			entries[rel] = &entry{mode: info.Mode(), link: link}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		size += info.Size()
+		if size > maxSize {
+			return fmt.Errorf("%w: more than %d MiB", ErrTooLarge, maxSize>>20)
+		}
+		e, err := copyFile(path, target, info.Mode())
+		if err != nil {
+			return err
+		}
+		entries[rel] = e
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Directory modes are applied deepest first, so a directory without
+	// write permission doesn't stop its children's modes being set.
+	var dirs []string
+	for rel, e := range entries {
+		if e.mode.IsDir() {
+			dirs = append(dirs, rel)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, rel := range dirs {
+		if err := os.Chmod(filepath.Join(dst, rel), entries[rel].mode.Perm()); err != nil {
+			return nil, 0, err
+		}
+	}
+	return entries, size, nil
+}
+
+func copyFile(src, dst string, mode fs.FileMode) (*entry, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	text := &limitedBuffer{max: maxDiffSize + 1}
+	if _, err := io.Copy(io.MultiWriter(out, h, text), in); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	e := &entry{mode: mode}
+	copy(e.hash[:], h.Sum(nil))
+	if isText(text) {
+		e.data = text.Bytes()
+	}
+	return e, nil
+}
+
+// scan records every path under root as copyTree would.
+func scan(root string) (map[string]*entry, error) {
+	entries := make(map[string]*entry)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entries[rel] = &entry{mode: info.Mode(), link: link}
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			text := &limitedBuffer{max: maxDiffSize + 1}
+			if _, err := io.Copy(io.MultiWriter(h, text), f); err != nil {
+				return err
+			}
+			e := &entry{mode: info.Mode()}
+			copy(e.hash[:], h.Sum(nil))
+			if isText(text) {
+				e.data = text.Bytes()
+			}
+			entries[rel] = e
+		default:
+			entries[rel] = &entry{mode: info.Mode()}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// escapes reports whether a symlink in dir pointing at link resolves
+// outside root.
+func escapes(root, dir, link string) bool {
+	if filepath.IsAbs(link) {
+		return true
+	}
+	rel, err := filepath.Rel(root, filepath.Join(dir, link))
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// environ is the user's environment with the working directory pointed at
+// root.
+func environ(root string) []string {
+	env := []string{"PWD=" + root}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "PWD=") || strings.HasPrefix(kv, "OLDPWD=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// removeAll removes dir even when the command left directories in it
+// without write permission.
+func removeAll(dir string) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			os.Chmod(path, 0700)
+		}
+		return nil
+	})
+	os.RemoveAll(dir)
+}
+
+func isText(b *limitedBuffer) bool {
+	return !b.full && bytes.IndexByte(b.Bytes(), 0) < 0
+}
+
+// limitedBuffer keeps the first max bytes written to it and discards the
+// rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max  int
+	full bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.full = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
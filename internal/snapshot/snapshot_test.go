@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tree creates files with the given contents under a temporary directory.
+func tree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTry(t *testing.T) {
+	dir := tree(t, map[string]string{
+		"a.jpeg":       "image a",
+		"b.jpeg":       "image b",
+		"app.conf":     "host=foo\nport=80\n",
+		"old/junk.txt": "junk",
+	})
+
+	command := `for f in *.jpeg; do mv "$f" "${f%.jpeg}.jpg"; done; sed -i.bak 's/foo/bar/' app.conf; rm -r old; touch new.txt`
+	res, err := Try(context.Background(), command, dir, Options{})
+	if err != nil {
+		t.Fatalf("Try: %v", err)
+	}
+	if res.ExitCode != 0 {
+		t.Fatalf("exit status %d: %s", res.ExitCode, res.Output)
+	}
+
+	var got []string
+	for _, c := range res.Changes {
+		s := c.Kind + " " + c.Path
+		if c.From != "" {
+			s = c.Kind + " " + c.From + " -> " + c.Path
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"renamed a.jpeg -> a.jpg",
+		"modified app.conf",
+		"created app.conf.bak",
+		"renamed b.jpeg -> b.jpg",
+		"created new.txt",
+		"deleted old/",
+		"deleted old/junk.txt",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for _, c := range res.Changes {
+		if c.Path == "app.conf" && !strings.Contains(c.Diff, "-host=foo\n+host=bar\n") {
+			t.Errorf("app.conf diff = %q", c.Diff)
+		}
+	}
+
+	// The real directory is untouched.
+	if _, err := os.Stat(filepath.Join(dir, "a.jpeg")); err != nil {
+		t.Error("the real a.jpeg was renamed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "app.conf")); string(data) != "host=foo\nport=80\n" {
+		t.Errorf("the real app.conf became %q", data)
+	}
+}
+
+func TestTryReportsFailure(t *testing.T) {
+	dir := tree(t, map[string]string{"a.txt": "a"})
+	res, err := Try(context.Background(), "echo oops; rm a.txt; exit 3", dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 3 || strings.TrimSpace(string(res.Output)) != "oops" {
+		t.Errorf("exit %d output %q, want 3 and oops", res.ExitCode, res.Output)
+	}
+	if len(res.Changes) != 1 || res.Changes[0].Kind != Deleted {
+		t.Errorf("changes = %+v, want a.txt deleted", res.Changes)
+	}
+}
+
+func TestTryLimitsSize(t *testing.T) {
+	dir := tree(t, map[string]string{"big": strings.Repeat("x", 2<<20)})
+	_, err := Try(context.Background(), "true", dir, Options{MaxSize: 1 << 20})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestTryRefusesEscapingSymlink(t *testing.T) {
+	dir := tree(t, map[string]string{"a.txt": "a"})
+	if err := os.Symlink("/etc", filepath.Join(dir, "etc")); err != nil {
+		t.Skip(err)
+	}
+	if _, err := Try(context.Background(), "true", dir, Options{}); !errors.Is(err, ErrRefused) {
+		t.Errorf("err = %v, want ErrRefused", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := tree(t, map[string]string{"a.txt": "a"})
+
+	ok := []string{
+		"sed -i 's/a/b/' *.txt",
+		"sed -i '/^#/d' a.txt",
+		"find . -name '*.txt' -exec mv {} {}.bak \\;",
+		"ls > /dev/null 2>&1",
+		"/usr/bin/env sort -o a.txt a.txt",
+		"cd sub && rm -rf build",
+		"git mv a.txt b.txt",
+		"/usr/bin/sed -i 's/a/b/' a.txt",
+		"awk '$1 > 5 { print $2 }' a.txt",
+		"timeout 5 sort -o a.txt a.txt",
+	}
+	for _, command := range ok {
+		if err := Check(command, dir); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", command, err)
+		}
+	}
+
+	refused := []string{
+		"rm -rf /tmp/build",
+		"cp a.txt ~/backup/",
+		`mv a.txt "$HOME/a.txt"`,
+		"mv a.txt ../",
+		"cat a.txt > " + filepath.Join(dir, "b.txt"),
+		"sort --output=/etc/x a.txt",
+		"curl -O https://example.com/x",
+		"git pull && make",
+		"sudo chown root a.txt",
+		"cd && ls",
+		"for f in *; do wget $f; done",
+		"echo 'unterminated",
+
+		// Code the check can't read.
+		`python3 -c 'import shutil; shutil.rmtree("/")'`,
+		"perl -e 'unlink glob q(~/*)'",
+		`sh -c "$(printf 'rm -rf ~')"`,
+		"/usr/bin/python rename.py",
+		"timeout 5 bash rename.sh",
+		"xargs -n1 sh -c 'echo $0' < a.txt",
+		`eval "$(cat a.txt)"`,
+		". ./env.sh",
+		"./rename.sh",
+		"scripts/rename *.txt",
+		"find . -name '*.txt' -exec bash -c 'mv $0 x' {} \\;",
+		`awk '{ system("rm " $1) }' a.txt`,
+		`awk '{ print > "out.txt" }' a.txt`,
+		"awk -f prog.awk a.txt",
+		"make clean",
+		"npm run build",
+		"go run ./cmd/rename",
+	}
+	for _, command := range refused {
+		if err := Check(command, dir); !errors.Is(err, ErrRefused) {
+			t.Errorf("Check(%q) = %v, want ErrRefused", command, err)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var before, after []string
+	for i := 1; i <= 20; i++ {
+		before = append(before, fmt.Sprint(i))
+	}
+	after = append(after, before...)
+	after[1] = "changed 2"
+	after[15] = "changed 16"
+	d, ok := unifiedDiff("f", strings.Join(before, "\n")+"\n", strings.Join(after, "\n")+"\n")
+	if !ok {
+		t.Fatal("no diff")
+	}
+	want := "--- a/f\n+++ b/f\n" +
+		"@@ -1,5 +1,5 @@\n 1\n-2\n+changed 2\n 3\n 4\n 5\n" +
+		"@@ -13,7 +13,7 @@\n 13\n 14\n 15\n-16\n+changed 16\n 17\n 18\n 19\n"
+	if d != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", d, want)
+	}
+}
@@ -0,0 +1,222 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// gollm sends requests with an http.Client that has no Transport set, so every
+// request goes through http.DefaultTransport. Wrapping it is the only way to
+// observe status codes and headers that gollm discards when it reports errors.
+
+// Outcome describes the most recent HTTP exchange made with a recorded context.
+type Outcome struct {
+	StatusCode int           // 0 if no response was received
+	RetryAfter time.Duration // Parsed Retry-After header, if any
+	Body       string        // Start of the body of an error response
+	Err        error         // Transport error (connection refused, timeout, ...)
+}
+
+// maxErrorBody bounds how much of an error response is kept. Provider error
+// messages are short; this only guards against huge HTML error pages.
+const maxErrorBody = 4096
+
+// Recorder captures the outcome of HTTP requests made with its context.
+type Recorder struct {
+	mu   sync.Mutex
+	last Outcome
+	seen bool
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context that records the outcome of every HTTP request
+// issued with it, and the Recorder holding those outcomes.
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{}
+	return context.WithValue(ctx, recorderKey{}, r), r
+}
+
+// Last returns the outcome of the most recent request and whether any request
+// has been recorded.
+func (r *Recorder) Last() (Outcome, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last, r.seen
+}
+
+// Reset forgets the previously recorded outcome.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = Outcome{}
+	r.seen = false
+}
+
+func (r *Recorder) record(o Outcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last = o
+	r.seen = true
+}
+
+// roundTripper wraps the real transport and reports outcomes to the Recorder
+// found in the request context, if any.
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+
+	if r, ok := req.Context().Value(recorderKey{}).(*Recorder); ok {
+		o := Outcome{Err: err}
+		if resp != nil {
+			o.StatusCode = resp.StatusCode
+			o.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+			if resp.StatusCode >= 400 {
+				o.Body = peekBody(resp)
+			}
+		}
+		r.record(o)
+	}
+
+	return resp, err
+}
+
+// peekBody reads the start of resp's body and puts it back, so gollm still
+// sees the complete response.
+func peekBody(resp *http.Response) string {
+	buf, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+	return string(buf)
+}
+
+var (
+	installMu sync.Mutex
+	installed bool
+
+	// defaultBase is the standard library transport every configured
+	// transport is cloned from, so Configure can be called more than once.
+	defaultBase = http.DefaultTransport.(*http.Transport)
+)
+
+// Install wraps http.DefaultTransport so requests made by gollm report their
+// outcome to a Recorder. It is safe to call multiple times, and keeps any
+// transport set up by Configure.
+func Install() {
+	installMu.Lock()
+	defer installMu.Unlock()
+	if !installed {
+		http.DefaultTransport = &roundTripper{base: http.DefaultTransport}
+		installed = true
+	}
+}
+
+// Options configures the transport shared by every HTTP request vibe makes.
+type Options struct {
+	CAFile     string // PEM bundle trusted in addition to the system roots
+	ClientCert string // PEM client certificate for mTLS
+	ClientKey  string // PEM private key for ClientCert
+	Proxy      string // Proxy URL; empty uses HTTPS_PROXY/HTTP_PROXY/NO_PROXY
+	Insecure   bool   // Skip server certificate verification
+}
+
+// Configure installs a transport built from opts as http.DefaultTransport.
+// gollm's clients, the updater and the model listing all use it, so one call
+// at startup applies the settings everywhere.
+func Configure(opts Options) error {
+	base, err := newTransport(opts)
+	if err != nil {
+		return err
+	}
+
+	installMu.Lock()
+	defer installMu.Unlock()
+	http.DefaultTransport = &roundTripper{base: base}
+	installed = true
+	return nil
+}
+
+// NewClient returns an http.Client with the given timeout that sends requests
+// through the shared transport.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: http.DefaultTransport}
+}
+
+func newTransport(opts Options) (*http.Transport, error) {
+	t := defaultBase.Clone()
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	tlsConfig.InsecureSkipVerify = opts.Insecure
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// parseRetryAfter understands both forms of the Retry-After header: a number
+// of seconds or an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,267 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// restoreDefaultTransport undoes Configure/Install after a test.
+func restoreDefaultTransport(t *testing.T) {
+	saved := http.DefaultTransport
+	t.Cleanup(func() {
+		installMu.Lock()
+		defer installMu.Unlock()
+		http.DefaultTransport = saved
+		installed = false
+	})
+}
+
+// testCA is a throwaway certificate authority for issuing test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vibe test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSServer starts a server with a certificate issued by ca, optionally
+// requiring client certificates from the same CA.
+func newTLSServer(t *testing.T, ca *testCA, requireClientCert bool) *httptest.Server {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, 2, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	if requireClientCert {
+		pool := x509.NewCertPool()
+		pool.AddCert(ca.cert)
+		srv.TLS.ClientCAs = pool
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(url string) error {
+	resp, err := NewClient(5 * time.Second).Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestConfigureCAFile(t *testing.T) {
+	restoreDefaultTransport(t)
+	ca := newTestCA(t)
+	srv := newTLSServer(t, ca, false)
+
+	if err := Configure(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(srv.URL); err == nil {
+		t.Fatal("request to a server signed by an unknown CA succeeded")
+	}
+
+	if err := Configure(Options{CAFile: writeFile(t, "ca.pem", ca.pem)}); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if err := get(srv.URL); err != nil {
+		t.Errorf("request with VIBE_CA_FILE failed: %v", err)
+	}
+}
+
+func TestConfigureClientCert(t *testing.T) {
+	restoreDefaultTransport(t)
+	ca := newTestCA(t)
+	srv := newTLSServer(t, ca, true)
+	caFile := writeFile(t, "ca.pem", ca.pem)
+
+	if err := Configure(Options{CAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(srv.URL); err == nil {
+		t.Fatal("request without a client certificate succeeded")
+	}
+
+	certPEM, keyPEM := ca.issue(t, 3, x509.ExtKeyUsageClientAuth)
+	err := Configure(Options{
+		CAFile:     caFile,
+		ClientCert: writeFile(t, "client.pem", certPEM),
+		ClientKey:  writeFile(t, "client-key.pem", keyPEM),
+	})
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	if err := get(srv.URL); err != nil {
+		t.Errorf("request with a client certificate failed: %v", err)
+	}
+}
+
+func TestConfigureInsecure(t *testing.T) {
+	restoreDefaultTransport(t)
+	srv := newTLSServer(t, newTestCA(t), false)
+
+	if err := Configure(Options{Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get(srv.URL); err != nil {
+		t.Errorf("insecure request failed: %v", err)
+	}
+}
+
+func TestConfigureProxy(t *testing.T) {
+	restoreDefaultTransport(t)
+
+	var proxiedHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxiedHost = r.URL.Host
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	if err := Configure(Options{Proxy: proxy.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := get("http://llm.internal.example/v1/models"); err != nil {
+		t.Fatalf("request through proxy failed: %v", err)
+	}
+	if proxiedHost != "llm.internal.example" {
+		t.Errorf("proxy saw host %q, want llm.internal.example", proxiedHost)
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	restoreDefaultTransport(t)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"missing CA file", Options{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", Options{CAFile: writeFile(t, "empty.pem", []byte("not a cert"))}},
+		{"cert without key", Options{ClientCert: "client.pem"}},
+		{"invalid proxy", Options{Proxy: "::not a url"}},
+	}
+	for _, tt := range tests {
+		if err := Configure(tt.opts); err == nil {
+			t.Errorf("%s: Configure succeeded, want an error", tt.name)
+		}
+	}
+}
+
+func TestRecorderCapturesErrorBody(t *testing.T) {
+	restoreDefaultTransport(t)
+	Install()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":"slow down"}`)
+	}))
+	defer srv.Close()
+
+	ctx, rec := WithRecorder(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	o, ok := rec.Last()
+	if !ok {
+		t.Fatal("no outcome recorded")
+	}
+	if o.StatusCode != http.StatusTooManyRequests || o.RetryAfter != 2*time.Second {
+		t.Errorf("outcome = %+v, want 429 with 2s Retry-After", o)
+	}
+	if o.Body != `{"error":"slow down"}` {
+		t.Errorf("recorded body = %q", o.Body)
+	}
+	if string(body) != `{"error":"slow down"}` {
+		t.Errorf("caller read body %q, want it intact", body)
+	}
+}
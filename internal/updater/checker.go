@@ -7,6 +7,8 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/transport"
 )
 
 const (
@@ -40,9 +42,7 @@ func shouldCheckForUpdates(state *State) bool {
 }
 
 func checkLatestVersion() (string, error) {
-	client := &http.Client{
-		Timeout: requestTimeout,
-	}
+	client := transport.NewClient(requestTimeout)
 
 	req, err := http.NewRequest("GET", githubAPIURL, nil)
 	if err != nil {
@@ -13,6 +13,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/skymoore/vibe-zsh/internal/transport"
 )
 
 func getArchiveName(version string) string {
@@ -41,9 +43,7 @@ func getCurrentBinaryPath() (string, error) {
 }
 
 func downloadFile(url string, dest string) error {
-	client := &http.Client{
-		Timeout: 2 * time.Minute,
-	}
+	client := transport.NewClient(2 * time.Minute)
 
 	resp, err := client.Get(url)
 	if err != nil {
@@ -254,9 +254,7 @@ func computeChecksum(path string) (string, error) {
 }
 
 func downloadChecksums(version string) (map[string]string, error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	client := transport.NewClient(30 * time.Second)
 
 	url := getChecksumsURL(version)
 	resp, err := client.Get(url)